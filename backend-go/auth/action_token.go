@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"smartfarm-api/utils"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purposes of the tokens mailed to users. Each purpose is its own audience,
+// so a token only works for the link it was sent in.
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+	PurposeChangeEmail   = "change_email"
+)
+
+const actionAudiencePrefix = "smartfarm:"
+
+// ActionClaims are carried by a token sent by email. Email is the address it
+// was sent to; the token stops working once the user's email is another one.
+type ActionClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	Email   string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// GenerateActionToken issues a token for one purpose that expires after ttl.
+// Its ID (the jti claim) is recorded by the caller so it can be used once.
+func GenerateActionToken(userID uint, purpose string, email string, ttl time.Duration) (string, *ActionClaims, error) {
+	ks, err := currentKeys()
+	if err != nil {
+		return "", nil, err
+	}
+
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &ActionClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{actionAudiencePrefix + purpose},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	token := jwt.NewWithClaims(ks.current.method, claims)
+	token.Header["kid"] = ks.current.id
+	signed, err := token.SignedString(ks.current.sign)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// ParseActionToken verifies a token sent by email for the given purpose.
+func ParseActionToken(tokenString string, purpose string) (*ActionClaims, error) {
+	ks, err := currentKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &ActionClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, ks.verificationKey,
+		jwt.WithValidMethods(ks.algorithms()),
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(actionAudiencePrefix+purpose),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Purpose != purpose || claims.ID == "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionToken_BoundToPurpose(t *testing.T) {
+	useKeys(t, map[string]string{"JWT_SECRET": "action-token-test-secret-0123456789"})
+
+	token, issued, err := GenerateActionToken(7, PurposeResetPassword, "tani@example.com", time.Minute)
+	assert.NoError(t, err)
+
+	claims, err := ParseActionToken(token, PurposeResetPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+	assert.Equal(t, "tani@example.com", claims.Email)
+	assert.Equal(t, issued.ID, claims.ID)
+
+	_, err = ParseActionToken(token, PurposeVerifyEmail)
+	assert.Error(t, err)
+
+	// Not an access token either
+	_, err = ParseToken(token)
+	assert.Error(t, err)
+
+	access, _, err := GenerateToken(7, "petani", 1, time.Minute)
+	assert.NoError(t, err)
+	_, err = ParseActionToken(access, PurposeResetPassword)
+	assert.Error(t, err)
+}
+
+func TestActionToken_Expired(t *testing.T) {
+	useKeys(t, map[string]string{"JWT_SECRET": "action-token-test-secret-0123456789"})
+
+	token, _, err := GenerateActionToken(7, PurposeVerifyEmail, "tani@example.com", -time.Minute)
+	assert.NoError(t, err)
+	_, err = ParseActionToken(token, PurposeVerifyEmail)
+	assert.Error(t, err)
+}
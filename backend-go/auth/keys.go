@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// key is one signing key. Tokens name the key they were signed with in their
+// kid header, and a token is only accepted with the algorithm of its key.
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{} // nil for keys kept only to verify older tokens
+	verify interface{}
+}
+
+type keySet struct {
+	current *key
+	byID    map[string]*key
+}
+
+var (
+	keysMu sync.Mutex
+	keys   *keySet
+)
+
+// LoadKeys reads the signing keys from the environment. main calls it once
+// the .env file is loaded and refuses to start when it fails; until then the
+// first token issued or parsed loads them.
+//
+//   - JWT_ALGORITHM: HS256 (default), RS256 or EdDSA
+//   - JWT_KEY_ID: kid of the current key (default "default")
+//   - JWT_SECRET: the HS256 secret; must not be empty
+//   - JWT_PRIVATE_KEY_FILE: PEM private key for RS256 or EdDSA
+//   - JWT_PREVIOUS_KEYS: keys still accepted after a rotation, as a comma
+//     separated list of kid:HS256:secret, kid:RS256:/path/public.pem or
+//     kid:EdDSA:/path/public.pem
+func LoadKeys() error {
+	ks, err := loadKeySet(os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	keysMu.Lock()
+	keys = ks
+	keysMu.Unlock()
+	return nil
+}
+
+func currentKeys() (*keySet, error) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	if keys == nil {
+		ks, err := loadKeySet(os.Getenv)
+		if err != nil {
+			return nil, err
+		}
+		keys = ks
+	}
+	return keys, nil
+}
+
+func loadKeySet(getenv func(string) string) (*keySet, error) {
+	id := getenv("JWT_KEY_ID")
+	if id == "" {
+		id = "default"
+	}
+
+	var current *key
+	var err error
+	switch alg := getenv("JWT_ALGORITHM"); alg {
+	case "", "HS256":
+		current, err = hmacKey(id, getenv("JWT_SECRET"))
+		if err != nil {
+			return nil, fmt.Errorf("JWT_SECRET: %v", err)
+		}
+	case "RS256", "EdDSA":
+		path := getenv("JWT_PRIVATE_KEY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", alg)
+		}
+		current, err = privateKeyFromFile(id, alg, path)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("JWT_ALGORITHM %q is not supported: use HS256, RS256 or EdDSA", alg)
+	}
+
+	ks := &keySet{current: current, byID: map[string]*key{current.id: current}}
+
+	if previous := getenv("JWT_PREVIOUS_KEYS"); previous != "" {
+		for _, entry := range strings.Split(previous, ",") {
+			k, err := previousKey(strings.TrimSpace(entry))
+			if err != nil {
+				return nil, fmt.Errorf("JWT_PREVIOUS_KEYS: %v", err)
+			}
+			if _, ok := ks.byID[k.id]; ok {
+				return nil, fmt.Errorf("JWT_PREVIOUS_KEYS: key id %q is used twice", k.id)
+			}
+			ks.byID[k.id] = k
+		}
+	}
+	return ks, nil
+}
+
+func hmacKey(id string, secret string) (*key, error) {
+	if secret == "" {
+		return nil, errors.New("must not be empty")
+	}
+	if len(secret) < 32 {
+		log.Printf("⚠️  JWT key %q is shorter than 32 bytes", id)
+	}
+	return &key{id: id, method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}, nil
+}
+
+func privateKeyFromFile(id string, alg string, path string) (*key, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case "RS256":
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		return &key{id: id, method: jwt.SigningMethodRS256, sign: private, verify: &private.PublicKey}, nil
+	default:
+		private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		return &key{id: id, method: jwt.SigningMethodEdDSA, sign: private, verify: private.(crypto.Signer).Public()}, nil
+	}
+}
+
+// previousKey parses one kid:alg:value entry of JWT_PREVIOUS_KEYS.
+func previousKey(entry string) (*key, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("%q is not kid:alg:value", entry)
+	}
+	id, alg, value := parts[0], parts[1], parts[2]
+
+	switch alg {
+	case "HS256":
+		k, err := hmacKey(id, value)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+		k.sign = nil
+		return k, nil
+	case "RS256":
+		pem, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+		return &key{id: id, method: jwt.SigningMethodRS256, verify: public}, nil
+	case "EdDSA":
+		pem, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+		if _, ok := public.(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("key %q: not an Ed25519 public key", id)
+		}
+		return &key{id: id, method: jwt.SigningMethodEdDSA, verify: public}, nil
+	default:
+		return nil, fmt.Errorf("key %q: algorithm %q is not supported", id, alg)
+	}
+}
+
+// verificationKey picks the key a token names and checks the token uses that
+// key's algorithm, so e.g. an RS256 public key can never be used as an HS256
+// secret. Tokens issued before keys had ids are checked with the current key.
+func (ks *keySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	if id == "" {
+		id = ks.current.id
+	}
+
+	k, ok := ks.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", id)
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return k.verify, nil
+}
+
+func (ks *keySet) algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, k := range ks.byID {
+		if !seen[k.method.Alg()] {
+			seen[k.method.Alg()] = true
+			algs = append(algs, k.method.Alg())
+		}
+	}
+	return algs
+}
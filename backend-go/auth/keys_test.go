@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// useKeys loads a key set from env as if it were the environment, for the
+// rest of the test.
+func useKeys(t *testing.T, env map[string]string) {
+	ks, err := loadKeySet(func(k string) string { return env[k] })
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	keysMu.Lock()
+	old := keys
+	keys = ks
+	keysMu.Unlock()
+	t.Cleanup(func() {
+		keysMu.Lock()
+		keys = old
+		keysMu.Unlock()
+	})
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+func TestLoadKeySet_RefusesEmptySecret(t *testing.T) {
+	_, err := loadKeySet(func(string) string { return "" })
+	assert.EqualError(t, err, "JWT_SECRET: must not be empty")
+
+	_, err = loadKeySet(func(k string) string { return map[string]string{"JWT_ALGORITHM": "RS256"}[k] })
+	assert.EqualError(t, err, "JWT_PRIVATE_KEY_FILE is required for RS256")
+
+	_, err = loadKeySet(func(k string) string { return map[string]string{"JWT_ALGORITHM": "none"}[k] })
+	assert.Error(t, err)
+}
+
+func TestRotation_AcceptsPreviousKeysByKID(t *testing.T) {
+	useKeys(t, map[string]string{"JWT_KEY_ID": "2025", "JWT_SECRET": "old-secret-0123456789abcdef0123456789"})
+	oldToken, _, err := GenerateToken(1, "pembeli", 1, time.Minute)
+	assert.NoError(t, err)
+
+	useKeys(t, map[string]string{
+		"JWT_KEY_ID":        "2026",
+		"JWT_SECRET":        "new-secret-0123456789abcdef0123456789",
+		"JWT_PREVIOUS_KEYS": "2025:HS256:old-secret-0123456789abcdef0123456789",
+	})
+	newToken, _, err := GenerateToken(2, "petani", 2, time.Minute)
+	assert.NoError(t, err)
+
+	claims, err := ParseToken(oldToken)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), claims.UserID)
+	claims, err = ParseToken(newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), claims.UserID)
+
+	// Once the old key is retired its tokens stop working
+	useKeys(t, map[string]string{"JWT_KEY_ID": "2026", "JWT_SECRET": "new-secret-0123456789abcdef0123456789"})
+	_, err = ParseToken(oldToken)
+	assert.Error(t, err)
+}
+
+func TestParseToken_PinsSigningMethod(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	assert.NoError(t, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	useKeys(t, map[string]string{
+		"JWT_ALGORITHM":        "RS256",
+		"JWT_KEY_ID":           "rsa",
+		"JWT_PRIVATE_KEY_FILE": writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private)),
+	})
+
+	token, _, err := GenerateToken(1, "admin", 1, time.Minute)
+	assert.NoError(t, err)
+	_, err = ParseToken(token)
+	assert.NoError(t, err)
+
+	claims := Claims{UserID: 1, Role: "admin", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}}
+
+	// HS256 signed with the public key as the secret must not pass for the RSA key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa"
+	forgedString, err := forged.SignedString(publicPEM)
+	assert.NoError(t, err)
+	_, err = ParseToken(forgedString)
+	assert.Error(t, err)
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	unsignedString, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(t, err)
+	_, err = ParseToken(unsignedString)
+	assert.Error(t, err)
+}
+
+func TestEdDSAKeyFromFile(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	assert.NoError(t, err)
+
+	useKeys(t, map[string]string{
+		"JWT_ALGORITHM":        "EdDSA",
+		"JWT_PRIVATE_KEY_FILE": writePEM(t, "PRIVATE KEY", der),
+	})
+
+	token, _, err := GenerateToken(3, "petani", 4, time.Minute)
+	assert.NoError(t, err)
+	claims, err := ParseToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(4), claims.SessionID)
+}
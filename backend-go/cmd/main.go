@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"log"
 
 	"os"
+	"smartfarm-api/auth"
 	"smartfarm-api/config"
 	"smartfarm-api/controllers"
 	"smartfarm-api/routes"
@@ -41,14 +44,73 @@ func main() {
 			seeders.CleanOldProducts(config.DB)
 			return
 		}
+		if os.Args[1] == "backfill-fulfillments" {
+			seeders.BackfillFulfillments(config.DB)
+			return
+		}
+		if os.Args[1] == "backfill-payment-channels" {
+			seeders.BackfillPaymentChannels(config.DB)
+			return
+		}
+		if os.Args[1] == "create-admin" {
+			createAdmin(os.Args[2:])
+			return
+		}
+	}
+
+	// Signing keys come from the environment loaded above
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatalf("❌ JWT keys: %v", err)
 	}
 
 	// Init services/controllers
+	services.InitSessionService()
+	services.InitMailSender()
 	controllers.InitProductController()
 	controllers.InitOrderController()
+	controllers.InitCartController()
+	controllers.InitPreOrderController()
+	controllers.InitNotificationController()
 	controllers.InitAnalyticsController()
+	controllers.InitLedgerController()
+	controllers.InitFeeController()
 	services.InitPaymentService()
+	controllers.InitRefundController() // needs the payment gateway
+	controllers.InitPaymentProofController()
+
+	// Background jobs
+	services.StartOrderExpirySweeper()
+	services.StartSubscriptionScheduler()
+	services.StartPaymentReconciler()
 
 	r := routes.SetupRoutes()
 	r.Run(":8080")
 }
+
+// createAdmin makes an admin account, the only way to get the first one now
+// that signup is limited to buyers and farmers:
+//
+//	ADMIN_PASSWORD=... go run ./cmd create-admin -name "Admin" -email admin@example.com
+//
+// Without ADMIN_PASSWORD the password is read from the first line of stdin,
+// so it stays out of the shell history.
+func createAdmin(args []string) {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	name := fs.String("name", "", "admin's name")
+	email := fs.String("email", "", "admin's email")
+	fs.Parse(args)
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		scanner := bufio.NewScanner(os.Stdin)
+		if scanner.Scan() {
+			password = scanner.Text()
+		}
+	}
+
+	user, err := services.CreateAdmin(*name, *email, password)
+	if err != nil {
+		log.Fatalf("❌ create-admin: %v", err)
+	}
+	log.Printf("✅ Admin %s created (id %d)", user.Email, user.ID)
+}
@@ -24,7 +24,10 @@ func ConnectDatabase() {
 		os.Getenv("DB_NAME"),
 	)
 
-	database, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	database, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		// unique index violations come back as gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
 	if err != nil {
 		log.Fatal("❌ gagal koneksi database")
 	}
@@ -33,13 +36,33 @@ func ConnectDatabase() {
 
 	database.AutoMigrate(
 		&models.User{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.ActionToken{},
 		&models.Product{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderFulfillment{},
+		&models.OrderStatusLog{},
 		&models.Subscription{},
 		&models.ProductView{},
 		&models.Address{},
 		&models.Payment{},
+		&models.PaymentNotification{},
+		&models.PaymentReconciliation{},
+		&models.Refund{},
+		&models.RefundItem{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.Notification{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.PayoutBatch{},
+		&models.Payout{},
+		&models.FeeSchedule{},
+		&models.FeeRule{},
+		&models.OrderFee{},
 	)
 
 	log.Println("✅ database terkoneksi")
@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 	"smartfarm-api/dto"
+	"smartfarm-api/middleware"
 	"smartfarm-api/services"
 	"strconv"
 
@@ -57,7 +58,7 @@ func UpdateAddress(c *gin.Context) {
 	address, err := services.UpdateAddressService(userID, uint(addressID), req)
 	if err != nil {
 		if err.Error() == "unauthorized" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			middleware.Forbidden(c, err.Error())
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -79,7 +80,7 @@ func DeleteAddress(c *gin.Context) {
 	err = services.DeleteAddressService(userID, uint(addressID))
 	if err != nil {
 		if err.Error() == "unauthorized" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			middleware.Forbidden(c, err.Error())
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -101,7 +102,7 @@ func SetDefaultAddress(c *gin.Context) {
 	err = services.SetDefaultAddressService(userID, uint(addressID))
 	if err != nil {
 		if err.Error() == "unauthorized" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			middleware.Forbidden(c, err.Error())
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"log"
 	"net/http"
 	"smartfarm-api/config"
 	"smartfarm-api/repositories"
@@ -28,15 +27,6 @@ func GetTrendingProducts(c *gin.Context) {
 
 func GetFarmerDashboard(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
-	role := c.MustGet("role").(string)
-
-	// DEBUG LOG
-	log.Printf("[Dashboard] Access attempt - UserID: %d, Role: %s", userID, role)
-
-	if role != "petani" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "access denied: farmers only", "your_role": role})
-		return
-	}
 
 	data, err := analyticsService.GetFarmerDashboardData(userID)
 	if err != nil {
@@ -1,11 +1,14 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"smartfarm-api/dto"
 	"smartfarm-api/services"
-	"smartfarm-api/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,25 +32,15 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT for Auto-Login
-	token, err := utils.GenerateToken(user.ID, user.Role)
+	// Start a session for Auto-Login
+	tokens, err := services.StartSession(*user, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to generate token",
 		})
 		return
 	}
-
-	// Set Cookie
-	c.SetCookie(
-		"access_token",
-		token,
-		3600*24,
-		"/",
-		"",
-		false,
-		true,
-	)
+	setAuthCookies(c, tokens)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "registrasi berhasil",
@@ -67,8 +60,8 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// login service (cek user + password + buat JWT)
-	token, err := services.LoginUser(req)
+	// login service (cek user + password)
+	user, err := services.LoginUser(req)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": err.Error(),
@@ -76,16 +69,15 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// set cookie (simpan JWT di browser)
-	c.SetCookie(
-		"access_token", // nama cookie
-		token,          // nilai JWT
-		3600*24,        // maxAge (detik) = 1 hari
-		"/",            // path
-		"",             // domain (kosong = current domain)
-		false,          // secure (true kalau HTTPS)
-		true,           // httpOnly (tidak bisa diakses JS)
-	)
+	// session baru untuk perangkat ini (access + refresh token)
+	tokens, err := services.StartSession(*user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate token",
+		})
+		return
+	}
+	setAuthCookies(c, tokens)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "login berhasil",
@@ -122,8 +114,16 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	err := services.UpdateUserProfile(userID.(uint), req)
+	pendingEmail, err := services.UpdateUserProfile(userID.(uint), req)
 	if err != nil {
+		if err.Error() == "email sudah terdaftar" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -134,23 +134,258 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	if pendingEmail != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"data":          user,
+			"pending_email": pendingEmail,
+			"message":       "Profile updated; open the link sent to " + pendingEmail + " to change your email",
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"data": user, "message": "Profile updated successfully"})
 }
 
-func Logout(c *gin.Context) {
+// ChangePassword sets a new password and logs out the user's other devices.
+func ChangePassword(c *gin.Context) {
+	var req dto.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// hapus cookie dengan maxAge negatif
-	c.SetCookie(
-		"access_token", // nama cookie
-		"",             // value dikosongkan
-		-1,             // maxAge negatif = hapus
-		"/",            // path
-		"",             // domain
-		false,          // secure (true kalau HTTPS)
-		true,           // httpOnly
-	)
+	ended, err := services.ChangePassword(c.MustGet("userID").(uint), c.GetUint("sessionID"), req)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password berhasil diubah",
+		"data":    gin.H{"sessions_ended": ended},
+	})
+}
 
+// ConfirmEmailChange moves the account to the new email with the token from
+// the link mailed to it.
+func ConfirmEmailChange(c *gin.Context) {
+	var req dto.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.ConfirmEmailChange(req.Token); err != nil {
+		if err.Error() == "invalid or expired token" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "email sudah terdaftar" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email berhasil diubah"})
+}
+
+// Logout ends the session of this device. It works without a valid access
+// token too, through the refresh_token cookie.
+func Logout(c *gin.Context) {
+	if sessionID := c.GetUint("sessionID"); sessionID != 0 {
+		if err := services.EndSession(c.GetUint("userID"), sessionID); err != nil {
+			log.Printf("[Logout] Failed to end session %d: %v", sessionID, err)
+		}
+	} else if refreshToken, err := c.Cookie("refresh_token"); err == nil && refreshToken != "" {
+		if err := services.EndSessionByRefreshToken(refreshToken); err != nil {
+			log.Printf("[Logout] Failed to end session by refresh token: %v", err)
+		}
+	}
+
+	clearAuthCookies(c)
 	c.JSON(200, gin.H{
 		"message": "logout berhasil",
 	})
 }
+
+// LogoutAll ends every session of the user, this device included.
+func LogoutAll(c *gin.Context) {
+	ended, err := services.EndAllSessions(c.MustGet("userID").(uint), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "logout dari semua perangkat berhasil",
+		"data":    gin.H{"sessions_ended": ended},
+	})
+}
+
+// RefreshToken rotates the refresh token from the cookie (or the JSON body for
+// clients without cookies) and issues a new access token.
+func RefreshToken(c *gin.Context) {
+	refreshToken, _ := c.Cookie("refresh_token")
+	if refreshToken == "" && c.Request.ContentLength > 0 {
+		var req dto.RefreshTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		refreshToken = req.RefreshToken
+	}
+
+	tokens, err := services.RefreshSession(refreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		if err.Error() == "invalid refresh token" {
+			clearAuthCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		// Another tab refreshed first; keep the cookies it was sent
+		if err.Error() == "refresh token already rotated" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setAuthCookies(c, tokens)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "token diperbarui",
+		"data": gin.H{
+			"access_expires_at":  tokens.AccessExpiresAt.Format(time.RFC3339),
+			"refresh_expires_at": tokens.RefreshExpiresAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// GetMySessions lists the devices the user is signed in on.
+func GetMySessions(c *gin.Context) {
+	res, err := services.GetSessions(c.MustGet("userID").(uint), c.GetUint("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
+
+// EndMySession logs one of the user's other devices out.
+func EndMySession(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := services.EndSession(c.MustGet("userID").(uint), uint(sessionID)); err != nil {
+		if err.Error() == "session not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session ended"})
+}
+
+// VerifyEmail confirms the user's email with the token from the link mailed
+// at signup.
+func VerifyEmail(c *gin.Context) {
+	var req dto.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.VerifyEmail(req.Token); err != nil {
+		if err.Error() == "invalid or expired token" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email terverifikasi"})
+}
+
+// ResendVerification mails the signed-in user a new verification link.
+func ResendVerification(c *gin.Context) {
+	if err := services.ResendEmailVerification(c.MustGet("userID").(uint)); err != nil {
+		if err.Error() == "email is already verified" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email verifikasi dikirim"})
+}
+
+// ForgotPassword mails a reset link. It answers the same whether or not the
+// email has an account.
+func ForgotPassword(c *gin.Context) {
+	var req dto.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	services.RequestPasswordReset(req.Email)
+	c.JSON(http.StatusOK, gin.H{"message": "jika email terdaftar, link reset password telah dikirim"})
+}
+
+// ResetPassword sets a new password with the token from a reset link and logs
+// every device out.
+func ResetPassword(c *gin.Context) {
+	var req dto.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.ResetPassword(req.Token, req.Password); err != nil {
+		if err.Error() == "invalid or expired token" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "password berhasil direset, silakan login kembali"})
+}
+
+// setAuthCookies stores both tokens in HttpOnly cookies. The refresh token is
+// only sent to the /auth routes.
+func setAuthCookies(c *gin.Context, tokens services.AuthTokens) {
+	// access token untuk semua route, umurnya pendek
+	c.SetCookie(
+		"access_token",     // nama cookie
+		tokens.AccessToken, // nilai JWT
+		int(time.Until(tokens.AccessExpiresAt).Seconds()), // maxAge (detik)
+		"/",   // path
+		"",    // domain (kosong = current domain)
+		false, // secure (true kalau HTTPS)
+		true,  // httpOnly (tidak bisa diakses JS)
+	)
+	// refresh token hanya dikirim ke /auth
+	c.SetCookie("refresh_token", tokens.RefreshToken, int(time.Until(tokens.RefreshExpiresAt).Seconds()), "/auth", "", false, true)
+}
+
+func clearAuthCookies(c *gin.Context) {
+	// hapus cookie dengan maxAge negatif
+	c.SetCookie("access_token", "", -1, "/", "", false, true)
+	c.SetCookie("refresh_token", "", -1, "/auth", "", false, true)
+}
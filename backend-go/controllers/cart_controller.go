@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/repositories"
+	"smartfarm-api/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var cartService services.CartService
+
+func InitCartController() {
+	db := config.DB
+	cartService = services.NewCartService(
+		repositories.NewCartRepository(db),
+		repositories.NewOrderRepository(db),
+		repositories.NewProductRepository(db),
+		repositories.NewFeeRepository(db),
+	)
+}
+
+func GetCart(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	cart, err := cartService.GetCart(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cart})
+}
+
+func AddCartItem(c *gin.Context) {
+	var req dto.AddCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	cart, err := cartService.AddItem(userID, req)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cart})
+}
+
+func UpdateCartItem(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req dto.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	cart, err := cartService.UpdateItem(userID, uint(productID), req)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cart})
+}
+
+func RemoveCartItem(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	cart, err := cartService.RemoveItem(userID, uint(productID))
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cart})
+}
+
+func ClearCart(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	if err := cartService.ClearCart(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cart cleared"})
+}
+
+func CheckoutCart(c *gin.Context) {
+	var req dto.CheckoutCartRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.MustGet("userID").(uint)
+	res, err := cartService.Checkout(userID, req)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": res})
+}
+
+func respondCartError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch {
+	case errMsg == "product not found" || errMsg == "item not in cart":
+		c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
+	case errMsg == "cart is empty" || strings.HasPrefix(errMsg, "insufficient stock"):
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+	default:
+		log.Printf("[CartController] Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"net/http"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/repositories"
+	"smartfarm-api/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var feeService services.FeeService
+
+func InitFeeController() {
+	feeService = services.NewFeeService(repositories.NewFeeRepository(config.DB))
+}
+
+// CreateFeeSchedule publishes a new version of the fee rules.
+func CreateFeeSchedule(c *gin.Context) {
+	var req dto.CreateFeeScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := feeService.CreateSchedule(c.MustGet("userID").(uint), req)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid fee") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": res})
+}
+
+func GetFeeSchedules(c *gin.Context) {
+	res, err := feeService.GetSchedules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
+
+// GetActiveFeeSchedule shows the fees new orders are priced with.
+func GetActiveFeeSchedule(c *gin.Context) {
+	res, err := feeService.GetActiveSchedule()
+	if err != nil {
+		if err.Error() == "fee schedule not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/repositories"
+	"smartfarm-api/services"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ledgerService services.LedgerService
+
+func InitLedgerController() {
+	ledgerService = services.NewLedgerService(repositories.NewLedgerRepository(config.DB))
+}
+
+func GetFarmerBalance(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	res, err := ledgerService.GetFarmerBalance(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
+
+// GetFarmerStatement returns the farmer's statement of ?month=YYYY-MM
+// (default this month). ?format=csv downloads it.
+func GetFarmerStatement(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	month := c.DefaultQuery("month", time.Now().Format("2006-01"))
+	statement, err := ledgerService.GetFarmerStatement(userID, month)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid month") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		data, err := services.FarmerStatementCSV(statement)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=statement-%d-%s.csv", userID, statement.Month))
+		c.Data(http.StatusOK, "text/csv", data)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": statement})
+}
+
+// RunPayoutBatch records a payout of every farmer balance due. The transfers
+// themselves are made outside the system.
+func RunPayoutBatch(c *gin.Context) {
+	var req dto.RunPayoutBatchRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	res, err := ledgerService.RunPayoutBatch(c.MustGet("userID").(uint), req.MinAmount)
+	if err != nil {
+		if err.Error() == "no balances due" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": res})
+}
+
+func GetPayoutBatches(c *gin.Context) {
+	res, err := ledgerService.GetPayoutBatches()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"net/http"
+	"smartfarm-api/config"
+	"smartfarm-api/repositories"
+	"smartfarm-api/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var notificationService services.NotificationService
+
+func InitNotificationController() {
+	notificationService = services.NewNotificationService(repositories.NewNotificationRepository(config.DB))
+}
+
+func GetMyNotifications(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	notifications, err := notificationService.GetMyNotifications(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": notifications})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	if err := notificationService.MarkRead(uint(id), userID); err != nil {
+		if err.Error() == "notification not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
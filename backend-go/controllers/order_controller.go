@@ -5,8 +5,10 @@ import (
 	"net/http"
 	"smartfarm-api/config"
 	"smartfarm-api/dto"
+	"smartfarm-api/middleware"
 	"smartfarm-api/repositories"
 	"smartfarm-api/services"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -18,7 +20,7 @@ func InitOrderController() {
 	db := config.DB
 	orderRepo := repositories.NewOrderRepository(db)
 	productRepo := repositories.NewProductRepository(db) // Need product repo too
-	orderService = services.NewOrderService(orderRepo, productRepo)
+	orderService = services.NewOrderService(orderRepo, productRepo, repositories.NewLedgerRepository(db), repositories.NewFeeRepository(db))
 }
 
 func CreateOrder(c *gin.Context) {
@@ -60,6 +62,60 @@ func GetMyOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": orders})
 }
 
+func ShipOrder(c *gin.Context) {
+	updateOrderStatus(c, orderService.ShipOrder)
+}
+
+func CompleteOrder(c *gin.Context) {
+	updateOrderStatus(c, orderService.CompleteOrder)
+}
+
+func CancelOrder(c *gin.Context) {
+	updateOrderStatus(c, orderService.CancelOrder)
+}
+
+// updateOrderStatus is shared by the ship/complete/cancel handlers; the body
+// with a note is optional.
+func updateOrderStatus(c *gin.Context, apply func(uint, services.OrderActor, string) (dto.OrderResponse, error)) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req dto.UpdateOrderStatusRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	actor := services.OrderActor{
+		UserID: c.MustGet("userID").(uint),
+		Role:   c.MustGet("role").(string),
+	}
+
+	res, err := apply(uint(orderID), actor, req.Note)
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "order not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
+		case errMsg == "unauthorized":
+			middleware.Forbidden(c, errMsg)
+		case strings.HasPrefix(errMsg, "invalid status transition"):
+			c.JSON(http.StatusConflict, gin.H{"error": errMsg})
+		default:
+			log.Printf("[OrderController] updateOrderStatus Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
+
 // Subscriptions
 func CreateSubscription(c *gin.Context) {
 	var req dto.CreateSubscriptionRequest
@@ -70,7 +126,15 @@ func CreateSubscription(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
 	res, err := orderService.CreateSubscription(req, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		errMsg := err.Error()
+		switch {
+		case errMsg == "product not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
+		case strings.HasPrefix(errMsg, "this product"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+		}
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"data": res})
@@ -85,3 +149,68 @@ func GetMySubscriptions(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"data": subs})
 }
+
+func GetSubscriptionSchedule(c *gin.Context) {
+	subID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	schedule, err := orderService.GetSubscriptionSchedule(uint(subID), userID)
+	if err != nil {
+		switch err.Error() {
+		case "unauthorized":
+			middleware.Forbidden(c, err.Error())
+		case "subscription not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": schedule})
+}
+
+func PauseSubscription(c *gin.Context) {
+	updateSubscription(c, orderService.PauseSubscription)
+}
+
+func ResumeSubscription(c *gin.Context) {
+	updateSubscription(c, orderService.ResumeSubscription)
+}
+
+func SkipSubscriptionDelivery(c *gin.Context) {
+	updateSubscription(c, orderService.SkipNextDelivery)
+}
+
+func CancelSubscription(c *gin.Context) {
+	updateSubscription(c, orderService.CancelSubscription)
+}
+
+func updateSubscription(c *gin.Context, apply func(uint, uint) (dto.SubscriptionResponse, error)) {
+	subID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	res, err := apply(uint(subID), userID)
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "unauthorized":
+			middleware.Forbidden(c, errMsg)
+		case errMsg == "subscription not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
+		case strings.HasPrefix(errMsg, "subscription is"):
+			c.JSON(http.StatusConflict, gin.H{"error": errMsg})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
@@ -4,8 +4,11 @@ import (
 	"log"
 	"net/http"
 	"smartfarm-api/dto"
+	"smartfarm-api/middleware"
 	"smartfarm-api/services"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,7 +25,13 @@ func CreatePayment(c *gin.Context) {
 	payment, token, err := services.CreatePayment(userID, req)
 	if err != nil {
 		if err.Error() == "unauthorized" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to pay for this order"})
+			middleware.Forbidden(c, "Unauthorized to pay for this order")
+		} else if strings.HasPrefix(err.Error(), "amount mismatch") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "amount_mismatch"})
+		} else if err.Error() == "order is not awaiting payment" || err.Error() == "a payment proof is already awaiting review" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "order_not_payable"})
+		} else if err.Error() == "order not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		} else {
 			// Pass the specific error message (e.g. from Midtrans or Address check)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -40,14 +49,23 @@ func CreatePayment(c *gin.Context) {
 }
 
 func PaymentWebhook(c *gin.Context) {
-	var webhookData map[string]interface{}
-	if err := c.BindJSON(&webhookData); err != nil {
+	var req dto.PaymentWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := services.ProcessPaymentWebhook(webhookData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := services.ProcessPaymentWebhook(req); err != nil {
+		switch err.Error() {
+		case "invalid signature":
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case "invalid webhook payload", "gross amount mismatch":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case "payment not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
@@ -63,23 +81,17 @@ func GetPaymentStatus(c *gin.Context) {
 
 	userID := c.MustGet("userID").(uint)
 
-	payment, err := services.GetPaymentByOrderID(userID, uint(orderID))
+	res, err := services.GetOrderPayments(userID, uint(orderID))
 	if err != nil {
 		if err.Error() == "unauthorized" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			middleware.Forbidden(c, err.Error())
 		} else {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": gin.H{
-			"payment_id": payment.ID,
-			"status":     payment.Status,
-			"amount":     payment.Amount,
-		},
-	})
+	c.JSON(http.StatusOK, gin.H{"data": res})
 }
 
 func MockPaymentSuccess(c *gin.Context) {
@@ -104,3 +116,31 @@ func MockPaymentSuccess(c *gin.Context) {
 	log.Printf("[MockPaymentSuccess] Success for PaymentID: %d", req.PaymentID)
 	c.JSON(http.StatusOK, gin.H{"message": "Mock payment confirmed successfully"})
 }
+
+// GetReconciliationReport returns the payment reconciliation report of
+// ?date=YYYY-MM-DD (default today). ?format=csv downloads it.
+func GetReconciliationReport(c *gin.Context) {
+	date := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	report, err := services.GetReconciliationReport(date)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid date") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		data, err := services.ReconciliationReportCSV(report)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=reconciliation-"+report.Date+".csv")
+		c.Data(http.StatusOK, "text/csv", data)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/middleware"
+	"smartfarm-api/repositories"
+	"smartfarm-api/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var paymentProofService services.PaymentProofService
+
+func InitPaymentProofController() {
+	db := config.DB
+	paymentProofService = services.NewPaymentProofService(
+		repositories.NewOrderRepository(db),
+		repositories.NewProductRepository(db),
+		repositories.NewPaymentRepository(db),
+		repositories.NewNotificationRepository(db),
+	)
+}
+
+func UploadPaymentProof(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req dto.UploadPaymentProofRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+
+	res, err := paymentProofService.UploadProof(uint(orderID), userID, req)
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "order not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
+		case errMsg == "unauthorized":
+			middleware.Forbidden(c, errMsg)
+		case strings.HasPrefix(errMsg, "invalid payment proof"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		case strings.HasPrefix(errMsg, "amount mismatch"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg, "code": "amount_mismatch"})
+		case errMsg == "order is not awaiting payment" || errMsg == "a payment proof is already awaiting review":
+			c.JSON(http.StatusConflict, gin.H{"error": errMsg, "code": "order_not_payable"})
+		default:
+			log.Printf("[PaymentProofController] Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": res})
+}
+
+func GetPaymentProofQueue(c *gin.Context) {
+	actor := services.OrderActor{
+		UserID: c.MustGet("userID").(uint),
+		Role:   c.MustGet("role").(string),
+	}
+
+	res, err := paymentProofService.GetReviewQueue(actor)
+	if err != nil {
+		if err.Error() == "unauthorized" {
+			middleware.Forbidden(c, err.Error())
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
+
+// GetPaymentProofFile sends the transfer receipt to the buyer, the order's
+// farmers and admins; receipts are not in the public uploads.
+func GetPaymentProofFile(c *gin.Context) {
+	paymentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	actor := services.OrderActor{
+		UserID: c.MustGet("userID").(uint),
+		Role:   c.MustGet("role").(string),
+	}
+
+	path, err := paymentProofService.GetProofFile(uint(paymentID), actor)
+	if err != nil {
+		respondPaymentProofReviewError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.File(path)
+}
+
+func ApprovePaymentProof(c *gin.Context) {
+	paymentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	actor := services.OrderActor{
+		UserID: c.MustGet("userID").(uint),
+		Role:   c.MustGet("role").(string),
+	}
+
+	res, err := paymentProofService.ApproveProof(uint(paymentID), actor)
+	if err != nil {
+		respondPaymentProofReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
+
+func RejectPaymentProof(c *gin.Context) {
+	paymentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var req dto.RejectPaymentProofRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor := services.OrderActor{
+		UserID: c.MustGet("userID").(uint),
+		Role:   c.MustGet("role").(string),
+	}
+
+	res, err := paymentProofService.RejectProof(uint(paymentID), actor, req.Reason)
+	if err != nil {
+		respondPaymentProofReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
+
+func respondPaymentProofReviewError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch {
+	case errMsg == "payment not found" || errMsg == "order not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
+	case errMsg == "unauthorized":
+		middleware.Forbidden(c, errMsg)
+	case strings.HasPrefix(errMsg, "invalid rejection"):
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+	case errMsg == "payment proof is not awaiting review" || strings.HasPrefix(errMsg, "invalid status transition"):
+		c.JSON(http.StatusConflict, gin.H{"error": errMsg})
+	default:
+		log.Printf("[PaymentProofController] Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+	}
+}
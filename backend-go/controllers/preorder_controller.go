@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/middleware"
+	"smartfarm-api/repositories"
+	"smartfarm-api/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var preOrderService services.PreOrderService
+
+func InitPreOrderController() {
+	db := config.DB
+	preOrderService = services.NewPreOrderService(
+		repositories.NewProductRepository(db),
+		repositories.NewOrderRepository(db),
+		repositories.NewNotificationRepository(db),
+	)
+}
+
+func RescheduleHarvest(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req dto.RescheduleHarvestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	res, err := preOrderService.RescheduleHarvest(uint(id), userID, req)
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "product not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
+		case errMsg == "unauthorized":
+			middleware.Forbidden(c, errMsg)
+		case errMsg == "product is not a pre-order" || strings.HasPrefix(errMsg, "invalid harvest date"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		default:
+			log.Printf("[PreOrderController] Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
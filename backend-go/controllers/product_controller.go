@@ -4,9 +4,11 @@ import (
 	"net/http"
 	"smartfarm-api/config"
 	"smartfarm-api/dto"
+	"smartfarm-api/middleware"
 	"smartfarm-api/repositories"
 	"smartfarm-api/services"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,16 +35,19 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
-	// Assuming Auth middleware sets "userID"
-	// For testing without auth, we might hardcode or check header
-	// userID := c.GetUint("userID")
-	// For now, let's hardcode active user or get from context if available
-
-	// Simulate user ID 1 (Farmer) for now if middleware not ready
-	userID := uint(1)
+	// The farmer creating the product, from AuthMiddleware
+	userID := c.MustGet("userID").(uint)
 
 	res, err := productService.CreateProduct(req, userID)
 	if err != nil {
+		if err.Error() == "unauthorized" || strings.HasPrefix(err.Error(), "farmer account") {
+			middleware.Forbidden(c, err.Error())
+			return
+		}
+		if strings.HasPrefix(err.Error(), "invalid subscription") || strings.HasPrefix(err.Error(), "invalid pre-order") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -80,14 +85,10 @@ func GetProductByID(c *gin.Context) {
 		return
 	}
 
-	// Log View (Async to not block response)
-	// Mock UserID 1 or 0 (Guest)
-	userID := uint(1)
-	go func() {
-		if analyticsService != nil {
-			analyticsService.LogView(product.ID, userID)
-		}
-	}()
+	// Log View (Async to not block response). OptionalAuthMiddleware sets
+	// userID for signed-in viewers; guests are logged as 0.
+	userID := c.GetUint("userID")
+	go LogProductView(product.ID, userID)
 
 	c.JSON(http.StatusOK, gin.H{"data": product})
 }
@@ -144,6 +145,14 @@ func UpdateProduct(c *gin.Context) {
 
 	res, err := productService.UpdateProduct(uint(id), req, userID)
 	if err != nil {
+		if err.Error() == "unauthorized" || strings.HasPrefix(err.Error(), "farmer account") {
+			middleware.Forbidden(c, err.Error())
+			return
+		}
+		if strings.HasPrefix(err.Error(), "invalid subscription") || strings.HasPrefix(err.Error(), "invalid pre-order") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -164,6 +173,10 @@ func DeleteProduct(c *gin.Context) {
 
 	err = productService.DeleteProduct(uint(id), userID)
 	if err != nil {
+		if err.Error() == "unauthorized" {
+			middleware.Forbidden(c, err.Error())
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
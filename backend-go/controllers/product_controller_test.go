@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"smartfarm-api/auth"
+	"smartfarm-api/dto"
+	"smartfarm-api/middleware"
+	"smartfarm-api/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProductService struct {
+	services.ProductService
+	createdBy uint
+}
+
+func (s *fakeProductService) CreateProduct(req dto.CreateProductRequest, farmerID uint) (dto.ProductResponse, error) {
+	s.createdBy = farmerID
+	return dto.ProductResponse{ID: 1, Name: req.Name, FarmerID: farmerID}, nil
+}
+
+func (s *fakeProductService) FindByID(id uint) (dto.ProductResponse, error) {
+	return dto.ProductResponse{ID: id}, nil
+}
+
+type fakeAnalyticsService struct {
+	services.AnalyticsService
+	views chan uint
+}
+
+func (s *fakeAnalyticsService) LogView(productID uint, userID uint) error {
+	s.views <- userID
+	return nil
+}
+
+func withFakeServices(t *testing.T) (*fakeProductService, *fakeAnalyticsService) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "controller-test-secret-0123456789abcdef")
+	assert.NoError(t, auth.LoadKeys())
+
+	products := &fakeProductService{}
+	analytics := &fakeAnalyticsService{views: make(chan uint, 1)}
+	oldProducts, oldAnalytics := productService, analyticsService
+	productService, analyticsService = products, analytics
+	oldTokenRevoked := middleware.TokenRevoked
+	middleware.TokenRevoked = func(jti string) (bool, error) { return false, nil }
+	t.Cleanup(func() {
+		productService, analyticsService = oldProducts, oldAnalytics
+		middleware.TokenRevoked = oldTokenRevoked
+	})
+	return products, analytics
+}
+
+func TestCreateProductUsesAuthenticatedFarmer(t *testing.T) {
+	products, _ := withFakeServices(t)
+
+	r := gin.New()
+	r.POST("/products", middleware.AuthMiddleware(), CreateProduct)
+
+	token, _, err := auth.GenerateToken(42, "petani", 1, time.Minute)
+	assert.NoError(t, err)
+
+	form := url.Values{"name": {"Tomat"}, "price": {"12000"}, "stock": {"5"}}
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, uint(42), products.createdBy)
+}
+
+func TestGetProductByIDLogsViewer(t *testing.T) {
+	_, analytics := withFakeServices(t)
+
+	r := gin.New()
+	r.GET("/products/:id", middleware.OptionalAuthMiddleware(), GetProductByID)
+
+	view := func(token string) uint {
+		req := httptest.NewRequest(http.MethodGet, "/products/3", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		select {
+		case userID := <-analytics.views:
+			return userID
+		case <-time.After(time.Second):
+			t.Fatal("product view was not logged")
+			return 0
+		}
+	}
+
+	token, _, err := auth.GenerateToken(7, "pembeli", 2, time.Minute)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint(7), view(token))
+	assert.Equal(t, uint(0), view(""))
+	// A bad token is browsed as a guest rather than rejected
+	assert.Equal(t, uint(0), view("not-a-token"))
+}
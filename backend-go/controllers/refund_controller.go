@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/middleware"
+	"smartfarm-api/repositories"
+	"smartfarm-api/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var refundService services.RefundService
+
+func InitRefundController() {
+	db := config.DB
+	refundService = services.NewRefundService(
+		repositories.NewOrderRepository(db),
+		repositories.NewProductRepository(db),
+		repositories.NewPaymentRepository(db),
+		repositories.NewRefundRepository(db),
+		repositories.NewLedgerRepository(db),
+		services.ActivePaymentGateway(),
+	)
+}
+
+func RefundOrder(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req dto.RefundOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor := services.OrderActor{
+		UserID: c.MustGet("userID").(uint),
+		Role:   c.MustGet("role").(string),
+	}
+
+	res, err := refundService.RefundOrder(uint(orderID), actor, req)
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "order not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
+		case errMsg == "unauthorized":
+			middleware.Forbidden(c, errMsg)
+		case errMsg == "nothing to refund" || strings.HasPrefix(errMsg, "invalid refund"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		case strings.HasPrefix(errMsg, "invalid status transition"):
+			c.JSON(http.StatusConflict, gin.H{"error": errMsg})
+		case strings.HasPrefix(errMsg, "refund failed"):
+			log.Printf("[RefundController] Gateway Error: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": errMsg})
+		default:
+			log.Printf("[RefundController] Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"net/http"
+	"smartfarm-api/dto"
+	"smartfarm-api/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateUser lets an admin open an account of any role, admins included.
+func CreateUser(c *gin.Context) {
+	var req dto.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := services.CreateUserByAdmin(req)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "email sudah terdaftar" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": user})
+}
+
+// GetFarmers lists farmers for verification, filtered by ?status=pending,
+// verified or rejected.
+func GetFarmers(c *gin.Context) {
+	farmers, err := services.GetFarmers(c.Query("status"))
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": farmers})
+}
+
+func ApproveFarmer(c *gin.Context) {
+	farmerID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID"})
+		return
+	}
+
+	farmer, err := services.ApproveFarmer(c.MustGet("userID").(uint), uint(farmerID))
+	if err != nil {
+		respondFarmerVerificationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Farmer verified", "data": farmer})
+}
+
+func RejectFarmer(c *gin.Context) {
+	farmerID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID"})
+		return
+	}
+
+	var req dto.RejectFarmerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	farmer, err := services.RejectFarmer(c.MustGet("userID").(uint), uint(farmerID), req.Reason)
+	if err != nil {
+		respondFarmerVerificationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Farmer rejected", "data": farmer})
+}
+
+func respondFarmerVerificationError(c *gin.Context, err error) {
+	switch {
+	case err.Error() == "farmer not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err.Error() == "farmer is not awaiting verification":
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case strings.HasPrefix(err.Error(), "invalid"):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
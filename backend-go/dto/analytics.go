@@ -12,12 +12,15 @@ type FarmerStatsResponse struct {
 }
 
 type FarmerRecentOrder struct {
-	ID          uint    `json:"id"`
-	ProductName string  `json:"product_name"`
-	Category    string  `json:"category"`
-	Price       float64 `json:"price"`
-	Status      string  `json:"status"`
-	ImageURL    string  `json:"image_url"`
+	ID            uint    `json:"id"`
+	FulfillmentID uint    `json:"fulfillment_id"`
+	ProductName   string  `json:"product_name"`
+	Category      string  `json:"category"`
+	Price         float64 `json:"price"`
+	ItemCount     int     `json:"item_count"`
+	SubTotal      float64 `json:"sub_total"` // This farmer's share of the order
+	Status        string  `json:"status"`
+	ImageURL      string  `json:"image_url"`
 }
 
 type FarmerDashboardResponse struct {
@@ -0,0 +1,33 @@
+package dto
+
+type AddCartItemRequest struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Quantity  int  `json:"quantity" binding:"required,min=1"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1"`
+}
+
+type CheckoutCartRequest struct {
+	AddressID uint `json:"address_id"`
+}
+
+type CartResponse struct {
+	ID         uint               `json:"id"`
+	Items      []CartItemResponse `json:"items"`
+	TotalPrice float64            `json:"total_price"`
+	HasIssues  bool               `json:"has_issues"` // True if any item has a warning and checkout may fail
+}
+
+type CartItemResponse struct {
+	ProductID   uint    `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	ImageURL    string  `json:"image_url"`
+	Price       float64 `json:"price"` // Current product price
+	PriceAtAdd  float64 `json:"price_at_add"`
+	Quantity    int     `json:"quantity"`
+	SubTotal    float64 `json:"sub_total"`
+	Stock       int     `json:"stock"`
+	Warning     string  `json:"warning,omitempty"`
+}
@@ -0,0 +1,46 @@
+package dto
+
+type CreateFeeScheduleRequest struct {
+	EffectiveFrom string                 `json:"effective_from"` // RFC3339, defaults to now
+	Note          string                 `json:"note"`
+	Rules         []CreateFeeRuleRequest `json:"rules" binding:"required,dive"`
+}
+
+type CreateFeeRuleRequest struct {
+	Type          string  `json:"type" binding:"required,oneof=commission payment_method service shipping"`
+	Category      string  `json:"category"`
+	FarmerID      *uint   `json:"farmer_id"`
+	PaymentMethod string  `json:"payment_method"` // gateway or bank_transfer
+	Percent       float64 `json:"percent" binding:"min=0,max=100"`
+	FixedAmount   float64 `json:"fixed_amount" binding:"min=0"`
+}
+
+type FeeScheduleResponse struct {
+	ID            uint              `json:"id"`
+	Version       int               `json:"version"`
+	EffectiveFrom string            `json:"effective_from"`
+	CreatedBy     uint              `json:"created_by"`
+	Note          string            `json:"note,omitempty"`
+	Rules         []FeeRuleResponse `json:"rules"`
+}
+
+type FeeRuleResponse struct {
+	ID            uint    `json:"id"`
+	Type          string  `json:"type"`
+	Category      string  `json:"category,omitempty"`
+	FarmerID      *uint   `json:"farmer_id,omitempty"`
+	PaymentMethod string  `json:"payment_method,omitempty"`
+	Percent       float64 `json:"percent"`
+	FixedAmount   float64 `json:"fixed_amount"`
+}
+
+// OrderFeeResponse is one fee line of an order receipt
+type OrderFeeResponse struct {
+	Type          string  `json:"type"`
+	Payer         string  `json:"payer"`
+	Description   string  `json:"description"`
+	Percent       float64 `json:"percent,omitempty"`
+	Amount        float64 `json:"amount"`
+	FulfillmentID *uint   `json:"fulfillment_id,omitempty"`
+	PaymentID     *uint   `json:"payment_id,omitempty"`
+}
@@ -0,0 +1,51 @@
+package dto
+
+type FarmerBalanceResponse struct {
+	FarmerID        uint    `json:"farmer_id"`
+	Balance         float64 `json:"balance"`          // Owed now, paid out in the next batch
+	PendingEarnings float64 `json:"pending_earnings"` // Paid orders not completed yet
+	TotalEarned     float64 `json:"total_earned"`
+	TotalCommission float64 `json:"total_commission"`
+	TotalRefunded   float64 `json:"total_refunded"`
+	TotalPaidOut    float64 `json:"total_paid_out"`
+}
+
+type FarmerStatement struct {
+	FarmerID       uint                  `json:"farmer_id"`
+	Month          string                `json:"month"` // YYYY-MM
+	OpeningBalance float64               `json:"opening_balance"`
+	TotalCredits   float64               `json:"total_credits"`
+	TotalDebits    float64               `json:"total_debits"`
+	ClosingBalance float64               `json:"closing_balance"`
+	Lines          []FarmerStatementLine `json:"lines"`
+}
+
+type FarmerStatementLine struct {
+	Date        string  `json:"date"`
+	Kind        string  `json:"kind"`
+	Reference   string  `json:"reference"`
+	OrderID     *uint   `json:"order_id,omitempty"`
+	Description string  `json:"description"`
+	Debit       float64 `json:"debit"`
+	Credit      float64 `json:"credit"`
+	Balance     float64 `json:"balance"`
+}
+
+type RunPayoutBatchRequest struct {
+	MinAmount float64 `json:"min_amount" binding:"omitempty,min=0"` // Defaults to PAYOUT_MIN_AMOUNT
+}
+
+type PayoutBatchResponse struct {
+	ID          uint             `json:"id"`
+	CreatedBy   uint             `json:"created_by"`
+	TotalAmount float64          `json:"total_amount"`
+	CreatedAt   string           `json:"created_at"`
+	Payouts     []PayoutResponse `json:"payouts"`
+}
+
+type PayoutResponse struct {
+	ID         uint    `json:"id"`
+	FarmerID   uint    `json:"farmer_id"`
+	FarmerName string  `json:"farmer_name,omitempty"`
+	Amount     float64 `json:"amount"`
+}
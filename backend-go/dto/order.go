@@ -10,38 +10,84 @@ type OrderItemRequest struct {
 	Quantity  int  `json:"quantity" binding:"required,min=1"`
 }
 
+type UpdateOrderStatusRequest struct {
+	Note string `json:"note"`
+}
+
 type OrderResponse struct {
-	ID           uint                `json:"id"`
-	UserID       uint                `json:"user_id"`
-	TotalPrice   float64             `json:"total_price"`
-	Status       string              `json:"status"`
-	Type         string              `json:"type"`
-	PaymentProof string              `json:"payment_proof"`
-	Items        []OrderItemResponse `json:"items"`
-	CreatedAt    string              `json:"created_at"`
+	ID               uint                  `json:"id"`
+	UserID           uint                  `json:"user_id"`
+	TotalPrice       float64               `json:"total_price"`
+	DepositAmount    float64               `json:"deposit_amount,omitempty"`
+	AmountPaid       float64               `json:"amount_paid"`
+	RefundDue        float64               `json:"refund_due,omitempty"`
+	ServiceFee       float64               `json:"service_fee,omitempty"`
+	Status           string                `json:"status"`
+	Type             string                `json:"type"`
+	PaymentProof     string                `json:"payment_proof"`
+	HarvestChangedAt string                `json:"harvest_changed_at,omitempty"`
+	Items            []OrderItemResponse   `json:"items"`
+	Fulfillments     []FulfillmentResponse `json:"fulfillments"`
+	Fees             []OrderFeeResponse    `json:"fees,omitempty"`
+	CreatedAt        string                `json:"created_at"`
+}
+
+// FulfillmentResponse is one farmer's part of an order
+type FulfillmentResponse struct {
+	ID           uint    `json:"id"`
+	FarmerID     uint    `json:"farmer_id"`
+	Status       string  `json:"status"`
+	SubTotal     float64 `json:"sub_total"`
+	ShippingCost float64 `json:"shipping_cost"`
+	Commission   float64 `json:"commission,omitempty"` // Taken from the farmer's payout
+	ShippedAt    string  `json:"shipped_at,omitempty"`
 }
 
 type OrderItemResponse struct {
-	ProductID   uint    `json:"product_id"`
-	ProductName string  `json:"product_name"`
-	Quantity    int     `json:"quantity"`
-	Price       float64 `json:"price"`
-	SubTotal    float64 `json:"sub_total"`
+	ID            uint    `json:"id"`
+	ProductID     uint    `json:"product_id"`
+	FulfillmentID *uint   `json:"fulfillment_id,omitempty"`
+	ProductName   string  `json:"product_name"`
+	Quantity      int     `json:"quantity"`
+	Price         float64 `json:"price"`
+	SubTotal      float64 `json:"sub_total"`
+
+	RefundedQuantity int `json:"refunded_quantity,omitempty"`
 }
 
 // Subscription DTOs
 type CreateSubscriptionRequest struct {
 	ProductID uint   `json:"product_id" binding:"required"`
 	Frequency string `json:"frequency" binding:"required,oneof=weekly monthly"`
-	Duration  int    `json:"duration" binding:"required,min=1"` // Number of periods (e.g., 4 weeks)
+	Duration  int    `json:"duration" binding:"required,min=1"`  // Number of periods (e.g., 4 weeks)
+	Quantity  int    `json:"quantity" binding:"omitempty,min=1"` // Per delivery, defaults to 1
+	AddressID uint   `json:"address_id"`
 }
 
 type SubscriptionResponse struct {
-	ID          uint   `json:"id"`
-	UserID      uint   `json:"user_id"`
-	ProductName string `json:"product_name"`
-	Frequency   string `json:"frequency"`
-	StartDate   string `json:"start_date"`
-	EndDate     string `json:"end_date"`
-	Status      string `json:"status"`
+	ID           uint    `json:"id"`
+	UserID       uint    `json:"user_id"`
+	ProductName  string  `json:"product_name"`
+	Frequency    string  `json:"frequency"`
+	StartDate    string  `json:"start_date"`
+	EndDate      string  `json:"end_date"`
+	Status       string  `json:"status"`
+	Quantity     int     `json:"quantity"`
+	Price        float64 `json:"price"`
+	NextDelivery string  `json:"next_delivery,omitempty"`
+}
+
+type SubscriptionScheduleResponse struct {
+	SubscriptionID     uint                   `json:"subscription_id"`
+	Frequency          string                 `json:"frequency"`
+	Status             string                 `json:"status"`
+	EndDate            string                 `json:"end_date"`
+	UpcomingDeliveries []string               `json:"upcoming_deliveries"`
+	PastDeliveries     []SubscriptionDelivery `json:"past_deliveries"`
+}
+
+type SubscriptionDelivery struct {
+	OrderID uint   `json:"order_id"`
+	Date    string `json:"date"`
+	Status  string `json:"status"`
 }
@@ -1,9 +1,11 @@
 package dto
 
+import "mime/multipart"
+
 type CreatePaymentRequest struct {
 	OrderID   uint    `json:"order_id" binding:"required"`
 	AddressID uint    `json:"address_id" binding:"required"`
-	Amount    float64 `json:"amount" binding:"required"`
+	Amount    float64 `json:"amount"` // optional; priced from the order and checked when given
 }
 
 type PaymentWebhookRequest struct {
@@ -15,4 +17,71 @@ type PaymentWebhookRequest struct {
 	PaymentType       string `json:"payment_type"`
 	TransactionStatus string `json:"transaction_status"`
 	FraudStatus       string `json:"fraud_status"`
+	SignatureKey      string `json:"signature_key"`
+}
+
+type PaymentAttemptResponse struct {
+	PaymentID      uint    `json:"payment_id"`
+	AttemptNumber  int     `json:"attempt_number"`
+	Status         string  `json:"status"`
+	Amount         float64 `json:"amount"`
+	RefundedAmount float64 `json:"refunded_amount,omitempty"`
+	FeeAmount      float64 `json:"fee_amount,omitempty"`
+	PaymentMethod  string  `json:"payment_method,omitempty"`
+	TransactionID  string  `json:"transaction_id"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+// OrderPaymentsResponse keeps the top-level fields of the latest attempt so
+// existing clients reading payment_id/status/amount keep working.
+type OrderPaymentsResponse struct {
+	PaymentID     uint                     `json:"payment_id"`
+	AttemptNumber int                      `json:"attempt_number"`
+	Status        string                   `json:"status"`
+	Amount        float64                  `json:"amount"`
+	SnapToken     string                   `json:"snap_token,omitempty"`
+	Attempts      []PaymentAttemptResponse `json:"attempts"`
+}
+
+type ReconciliationReport struct {
+	Date      string                `json:"date"`
+	Matched   int                   `json:"matched"`
+	Corrected int                   `json:"corrected"`
+	Orphaned  int                   `json:"orphaned"`
+	Entries   []ReconciliationEntry `json:"entries"`
+}
+
+type ReconciliationEntry struct {
+	PaymentID     uint    `json:"payment_id"`
+	OrderID       uint    `json:"order_id"`
+	TransactionID string  `json:"transaction_id"`
+	Amount        float64 `json:"amount"`
+	LocalStatus   string  `json:"local_status"`
+	GatewayStatus string  `json:"gateway_status"`
+	Outcome       string  `json:"outcome"`
+	Note          string  `json:"note,omitempty"`
+	CheckedAt     string  `json:"checked_at"`
+}
+
+type UploadPaymentProofRequest struct {
+	Proof  *multipart.FileHeader `form:"proof" binding:"required"`
+	Amount float64               `form:"amount"` // optional; priced from the order like CreatePaymentRequest
+}
+
+type RejectPaymentProofRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type PaymentProofResponse struct {
+	PaymentID    uint    `json:"payment_id"`
+	OrderID      uint    `json:"order_id"`
+	BuyerID      uint    `json:"buyer_id"`
+	Amount       float64 `json:"amount"`
+	Status       string  `json:"status"`
+	OrderStatus  string  `json:"order_status,omitempty"`
+	ProofURL     string  `json:"proof_url"`
+	RejectReason string  `json:"reject_reason,omitempty"`
+	ReviewedBy   *uint   `json:"reviewed_by,omitempty"`
+	ReviewedAt   string  `json:"reviewed_at,omitempty"`
+	CreatedAt    string  `json:"created_at"`
 }
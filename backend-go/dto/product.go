@@ -3,46 +3,62 @@ package dto
 import "mime/multipart"
 
 type CreateProductRequest struct {
-	Name               string                `form:"name" binding:"required"`
-	Description        string                `form:"description"`
-	Price              float64               `form:"price" binding:"required"`
-	Stock              int                   `form:"stock" binding:"required"`
-	Image              *multipart.FileHeader `form:"image"`
-	Category           string                `form:"category"`
-	IsPreOrder         bool                  `form:"is_pre_order"`
-	HarvestDate        string                `form:"harvest_date"` // YYYY-MM-DD
-	IsSubscription     bool                  `form:"is_subscription"`
-	SubscriptionPeriod string                `form:"subscription_period"`
+	Name                     string                `form:"name" binding:"required"`
+	Description              string                `form:"description"`
+	Price                    float64               `form:"price" binding:"required"`
+	Stock                    int                   `form:"stock" binding:"required"`
+	Image                    *multipart.FileHeader `form:"image"`
+	Category                 string                `form:"category"`
+	IsPreOrder               bool                  `form:"is_pre_order"`
+	HarvestDate              string                `form:"harvest_date"` // YYYY-MM-DD
+	HarvestQuantity          int                   `form:"harvest_quantity"`
+	PreOrderDepositPercent   float64               `form:"pre_order_deposit_percent"` // 0 means pay in full
+	IsSubscription           bool                  `form:"is_subscription"`
+	SubscriptionPeriod       string                `form:"subscription_period"` // weekly, monthly or weekly,monthly
+	SubscriptionPriceWeekly  float64               `form:"subscription_price_weekly"`
+	SubscriptionPriceMonthly float64               `form:"subscription_price_monthly"`
+	SubscriptionMinPeriods   int                   `form:"subscription_min_periods"`
 }
 
 type UpdateProductRequest struct {
-	Name               string                `form:"name"`
-	Description        string                `form:"description"`
-	Price              float64               `form:"price"`
-	Stock              int                   `form:"stock"`
-	Image              *multipart.FileHeader `form:"image"`
-	Category           string                `form:"category"`
-	IsPreOrder         bool                  `form:"is_pre_order"`
-	HarvestDate        string                `form:"harvest_date"`
-	IsSubscription     bool                  `form:"is_subscription"`
-	SubscriptionPeriod string                `form:"subscription_period"`
+	Name                     string                `form:"name"`
+	Description              string                `form:"description"`
+	Price                    float64               `form:"price"`
+	Stock                    int                   `form:"stock"`
+	Image                    *multipart.FileHeader `form:"image"`
+	Category                 string                `form:"category"`
+	IsPreOrder               bool                  `form:"is_pre_order"`
+	HarvestDate              string                `form:"harvest_date"`
+	HarvestQuantity          int                   `form:"harvest_quantity"`
+	PreOrderDepositPercent   float64               `form:"pre_order_deposit_percent"`
+	IsSubscription           bool                  `form:"is_subscription"`
+	SubscriptionPeriod       string                `form:"subscription_period"` // weekly, monthly or weekly,monthly
+	SubscriptionPriceWeekly  float64               `form:"subscription_price_weekly"`
+	SubscriptionPriceMonthly float64               `form:"subscription_price_monthly"`
+	SubscriptionMinPeriods   int                   `form:"subscription_min_periods"`
 }
 
 type ProductResponse struct {
-	ID                 uint    `json:"id"`
-	Name               string  `json:"name"`
-	Description        string  `json:"description"`
-	Price              float64 `json:"price"`
-	Stock              int     `json:"stock"`
-	ImageURL           string  `json:"image_url"`
-	Category           string  `json:"category"`
-	FarmerID           uint    `json:"farmer_id"`
-	FarmerName         string  `json:"farmer_name"`
-	IsPreOrder         bool    `json:"is_pre_order"`
-	HarvestDate        string  `json:"harvest_date,omitempty"`
-	IsSubscription     bool    `json:"is_subscription"`
-	SubscriptionPeriod string  `json:"subscription_period,omitempty"`
-	Views              int     `json:"views,omitempty"`
+	ID                       uint    `json:"id"`
+	Name                     string  `json:"name"`
+	Description              string  `json:"description"`
+	Price                    float64 `json:"price"`
+	Stock                    int     `json:"stock"`
+	ImageURL                 string  `json:"image_url"`
+	Category                 string  `json:"category"`
+	FarmerID                 uint    `json:"farmer_id"`
+	FarmerName               string  `json:"farmer_name"`
+	IsPreOrder               bool    `json:"is_pre_order"`
+	HarvestDate              string  `json:"harvest_date,omitempty"`
+	HarvestQuantity          int     `json:"harvest_quantity,omitempty"`
+	ReservedQuantity         int     `json:"reserved_quantity,omitempty"`
+	PreOrderDepositPercent   float64 `json:"pre_order_deposit_percent,omitempty"`
+	IsSubscription           bool    `json:"is_subscription"`
+	SubscriptionPeriod       string  `json:"subscription_period,omitempty"`
+	SubscriptionPriceWeekly  float64 `json:"subscription_price_weekly,omitempty"`
+	SubscriptionPriceMonthly float64 `json:"subscription_price_monthly,omitempty"`
+	SubscriptionMinPeriods   int     `json:"subscription_min_periods,omitempty"`
+	Views                    int     `json:"views,omitempty"`
 }
 
 type PaginatedProductResponse struct {
@@ -52,3 +68,8 @@ type PaginatedProductResponse struct {
 	Limit      int               `json:"limit"`
 	TotalPages int               `json:"total_pages"`
 }
+
+type RescheduleHarvestRequest struct {
+	HarvestDate string `json:"harvest_date" binding:"required"` // YYYY-MM-DD
+	Note        string `json:"note"`
+}
@@ -0,0 +1,39 @@
+package dto
+
+type RefundOrderRequest struct {
+	IdempotencyKey string              `json:"idempotency_key" binding:"required,max=64"` // chosen by the client, the same on a retry
+	Reason         string              `json:"reason" binding:"required"`
+	Items          []RefundItemRequest `json:"items"`   // empty refunds everything still refundable
+	Restock        bool                `json:"restock"` // return the refunded items to stock
+}
+
+type RefundItemRequest struct {
+	OrderItemID uint   `json:"order_item_id" binding:"required"`
+	Quantity    int    `json:"quantity" binding:"required,min=1"`
+	Reason      string `json:"reason"`
+}
+
+type RefundResponse struct {
+	ID        uint                 `json:"id"`
+	OrderID   uint                 `json:"order_id"`
+	PaymentID uint                 `json:"payment_id"`
+	Amount    float64              `json:"amount"`
+	Status    string               `json:"status"`
+	Reason    string               `json:"reason"`
+	Restocked bool                 `json:"restocked"`
+	Items     []RefundItemResponse `json:"items"`
+	CreatedAt string               `json:"created_at"`
+}
+
+type RefundItemResponse struct {
+	OrderItemID uint    `json:"order_item_id"`
+	ProductID   uint    `json:"product_id"`
+	Quantity    int     `json:"quantity"`
+	Amount      float64 `json:"amount"`
+	Reason      string  `json:"reason,omitempty"`
+}
+
+type RefundOrderResponse struct {
+	Order   OrderResponse    `json:"order"`
+	Refunds []RefundResponse `json:"refunds"`
+}
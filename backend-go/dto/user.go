@@ -0,0 +1,14 @@
+package dto
+
+// CreateUserRequest is an admin creating an account of any role, admins
+// included.
+type CreateUserRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type RejectFarmerRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
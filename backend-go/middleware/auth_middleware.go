@@ -1,49 +1,95 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"smartfarm-api/utils"
+	"smartfarm-api/auth"
+	"smartfarm-api/services"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// TokenRevoked looks an access token up on the revocation list. Tests swap it
+// for a stub.
+var TokenRevoked = services.IsTokenRevoked
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var tokenString string
-
-		// 1. Cek Cookie
-		cookie, err := c.Cookie("access_token")
-		if err == nil {
-			tokenString = cookie
-		}
-
-		// 2. Cek Header Authorization (Bearer ...)
-		if tokenString == "" {
-			authHeader := c.GetHeader("Authorization")
-			if authHeader != "" {
-				split := strings.Split(authHeader, " ")
-				if len(split) == 2 {
-					tokenString = split[1]
-				}
-			}
-		}
-
+		tokenString := tokenFromRequest(c)
 		if tokenString == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			return
 		}
 
-		claims, err := utils.ParseToken(tokenString)
+		claims, err := authenticate(tokenString)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
 
-		// Set context
-		c.Set("userID", claims.UserID)
-		c.Set("role", claims.Role)
+		setIdentity(c, claims)
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware is for public routes that behave the same for
+// everyone but want to know who is asking. A valid token sets userID and role
+// like AuthMiddleware; without one, or with an expired one, the request goes
+// on as a guest and userID is not set.
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tokenString := tokenFromRequest(c); tokenString != "" {
+			if claims, err := authenticate(tokenString); err == nil {
+				setIdentity(c, claims)
+			}
+		}
 
 		c.Next()
 	}
 }
+
+// authenticate parses the access token and checks it has not been revoked by
+// a logout. Tokens without an ID cannot be revoked and are refused.
+func authenticate(tokenString string) (*auth.Claims, error) {
+	claims, err := auth.ParseToken(tokenString)
+	if err != nil || claims.ID == "" {
+		return nil, errors.New("Invalid token")
+	}
+
+	revoked, err := TokenRevoked(claims.ID)
+	if err != nil {
+		log.Printf("[AuthMiddleware] Revocation check failed: %v", err)
+		return nil, errors.New("Invalid token")
+	}
+	if revoked {
+		return nil, errors.New("Token revoked")
+	}
+	return claims, nil
+}
+
+func setIdentity(c *gin.Context, claims *auth.Claims) {
+	c.Set("userID", claims.UserID)
+	c.Set("role", claims.Role)
+	c.Set("sessionID", claims.SessionID)
+}
+
+// tokenFromRequest reads the JWT from the access_token cookie, falling back to
+// an "Authorization: Bearer ..." header.
+func tokenFromRequest(c *gin.Context) string {
+	// 1. Cek Cookie
+	if cookie, err := c.Cookie("access_token"); err == nil && cookie != "" {
+		return cookie
+	}
+
+	// 2. Cek Header Authorization (Bearer ...)
+	authHeader := c.GetHeader("Authorization")
+	if authHeader != "" {
+		split := strings.Split(authHeader, " ")
+		if len(split) == 2 {
+			return split[1]
+		}
+	}
+	return ""
+}
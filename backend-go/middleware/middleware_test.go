@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"smartfarm-api/auth"
+	"smartfarm-api/policies"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	call := func(role string) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			if role != "" {
+				c.Set("role", role)
+			}
+		})
+		r.POST("/products", RequireRole(policies.RoleFarmer), func(c *gin.Context) {
+			c.Status(http.StatusCreated)
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/products", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, call(policies.RoleFarmer).Code)
+
+	w := call(policies.RoleBuyer)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error":"access denied: farmers only","code":"forbidden"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusForbidden, call(policies.RoleAdmin).Code)
+	assert.Equal(t, http.StatusForbidden, call("").Code)
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldEmailVerified := EmailVerified
+	t.Cleanup(func() { EmailVerified = oldEmailVerified })
+	EmailVerified = func(userID uint) (bool, error) { return userID == 5, nil }
+
+	call := func(userID uint) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.Use(func(c *gin.Context) { c.Set("userID", userID) })
+		r.POST("/orders", RequireVerifiedEmail(), func(c *gin.Context) {
+			c.Status(http.StatusCreated)
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, call(5).Code)
+
+	w := call(6)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error":"verify your email first","code":"email_unverified"}`, w.Body.String())
+}
+
+func TestAuthMiddleware_RejectsRevokedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "middleware-test-secret-0123456789abcdef")
+	assert.NoError(t, auth.LoadKeys())
+
+	oldTokenRevoked := TokenRevoked
+	t.Cleanup(func() { TokenRevoked = oldTokenRevoked })
+
+	revokedJTI := ""
+	TokenRevoked = func(jti string) (bool, error) { return jti == revokedJTI, nil }
+
+	r := gin.New()
+	r.GET("/me", AuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"session": c.GetUint("sessionID")})
+	})
+	r.GET("/products/1", OptionalAuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user": c.GetUint("userID")})
+	})
+
+	token, claims, err := auth.GenerateToken(5, policies.RoleBuyer, 9, time.Minute)
+	assert.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/me")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"session":9}`, w.Body.String())
+
+	revokedJTI = claims.ID
+	w = get("/me")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error":"Token revoked"}`, w.Body.String())
+
+	// A revoked token browses public routes as a guest
+	w = get("/products/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"user":0}`, w.Body.String())
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"smartfarm-api/policies"
+	"smartfarm-api/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var roleNames = map[string]string{
+	policies.RoleAdmin:  "admins",
+	policies.RoleFarmer: "farmers",
+	policies.RoleBuyer:  "buyers",
+}
+
+// RequireRole only lets the request through when AuthMiddleware put one of
+// the given roles in the context. It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	allowed := map[string]bool{}
+	names := []string{}
+	for _, role := range roles {
+		allowed[role] = true
+		names = append(names, roleNames[role])
+	}
+	message := "access denied: " + strings.Join(names, " and ") + " only"
+
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		if name, ok := role.(string); !ok || !allowed[name] {
+			Forbidden(c, message)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Forbidden aborts the request with the 403 every handler answers with when
+// a signed-in user may not do something.
+func Forbidden(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": message, "code": "forbidden"})
+}
+
+// EmailVerified looks up whether the user confirmed their email. Tests swap
+// it for a stub.
+var EmailVerified = services.IsEmailVerified
+
+// RequireVerifiedEmail keeps users who have not confirmed their email from
+// placing orders or listing products. It must run after AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verified, err := EmailVerified(c.GetUint("userID"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check email verification"})
+			return
+		}
+		if !verified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "verify your email first", "code": "email_unverified"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,46 +0,0 @@
-package middlewares
-
-import (
-	"net/http"
-	"os"
-
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-)
-
-func JWTAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-
-		// ambil token dari cookie (HttpOnly)
-		tokenString, err := c.Cookie("access_token")
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "belum login",
-			})
-			c.Abort()
-			return
-		}
-
-		// parse token (verifikasi JWT)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "token tidak valid",
-			})
-			c.Abort()
-			return
-		}
-
-		// ambil claims (isi token)
-		claims := token.Claims.(jwt.MapClaims)
-
-		// simpan ke context
-		c.Set("user_id", claims["user_id"])
-		c.Set("role", claims["role"])
-
-		c.Next()
-	}
-}
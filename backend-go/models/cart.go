@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Cart is the server-side shopping cart; each user has at most one.
+type Cart struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID uint       `gorm:"uniqueIndex" json:"user_id"`
+	Items  []CartItem `gorm:"foreignKey:CartID" json:"items"`
+}
+
+type CartItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	CartID     uint    `gorm:"uniqueIndex:idx_cart_product" json:"cart_id"`
+	ProductID  uint    `gorm:"uniqueIndex:idx_cart_product" json:"product_id"`
+	Product    Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Quantity   int     `json:"quantity"`
+	PriceAtAdd float64 `gorm:"type:decimal(10,2)" json:"price_at_add"` // Used to warn when the price changed since adding
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// FeeSchedule is one version of the marketplace fee rules. Rules are never
+// edited: a change is a new version, and every order keeps the version it was
+// priced with.
+type FeeSchedule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Version       int       `gorm:"uniqueIndex" json:"version"`
+	EffectiveFrom time.Time `gorm:"index" json:"effective_from"`
+	CreatedBy     uint      `json:"created_by"`
+	Note          string    `gorm:"type:varchar(255)" json:"note"`
+
+	Rules []FeeRule `gorm:"foreignKey:ScheduleID" json:"rules"`
+}
+
+// FeeRule is one fee of a schedule:
+//   - commission: Percent of item sales taken from the farmer, for every item
+//     or only a Category and/or a FarmerID
+//   - payment_method: FixedAmount the buyer pays per payment made with PaymentMethod
+//   - service: Percent of the items plus FixedAmount the buyer pays per order
+//   - shipping: FixedAmount the buyer pays per farmer shipping the order, for
+//     every farmer or only a FarmerID
+type FeeRule struct {
+	ID         uint `gorm:"primaryKey" json:"id"`
+	ScheduleID uint `gorm:"index" json:"schedule_id"`
+
+	Type          string  `gorm:"type:enum('commission','payment_method','service','shipping')" json:"type"`
+	Category      string  `gorm:"type:varchar(100)" json:"category,omitempty"`
+	FarmerID      *uint   `json:"farmer_id,omitempty"`
+	PaymentMethod string  `gorm:"type:varchar(50)" json:"payment_method,omitempty"`
+	Percent       float64 `gorm:"type:decimal(5,2)" json:"percent"`
+	FixedAmount   float64 `gorm:"type:decimal(15,2)" json:"fixed_amount"`
+}
+
+// OrderFee is one fee line of an order, as priced when the order was placed
+// (or, for payment method fees, when the payment succeeded). Payer is buyer
+// for fees added to what the buyer pays and farmer for commission.
+type OrderFee struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	OrderID       uint  `gorm:"index" json:"order_id"`
+	FulfillmentID *uint `json:"fulfillment_id,omitempty"`
+	FarmerID      *uint `json:"farmer_id,omitempty"`
+	PaymentID     *uint `json:"payment_id,omitempty"`
+	FeeRuleID     *uint `json:"fee_rule_id,omitempty"`
+
+	Type        string  `gorm:"type:enum('commission','payment_method','service')" json:"type"`
+	Payer       string  `gorm:"type:enum('buyer','farmer')" json:"payer"`
+	Description string  `gorm:"type:varchar(255)" json:"description"`
+	Percent     float64 `gorm:"type:decimal(5,2)" json:"percent"`
+	Amount      float64 `gorm:"type:decimal(15,2)" json:"amount"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// LedgerTransaction is one movement of money between ledger accounts. Its
+// entries always balance: the debits add up to the credits. Reference is
+// unique so the same sale, refund or payout is never posted twice.
+type LedgerTransaction struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	Kind          string `gorm:"type:enum('sale','commission','refund','commission_reversal','buyer_fees','payout')" json:"kind"`
+	Reference     string `gorm:"uniqueIndex;type:varchar(100)" json:"reference"`
+	OrderID       *uint  `gorm:"index" json:"order_id,omitempty"`
+	FulfillmentID *uint  `json:"fulfillment_id,omitempty"`
+	RefundID      *uint  `json:"refund_id,omitempty"`
+	PayoutID      *uint  `gorm:"index" json:"payout_id,omitempty"`
+	Description   string `gorm:"type:varchar(255)" json:"description"`
+
+	Entries []LedgerEntry `gorm:"foreignKey:TransactionID" json:"entries,omitempty"`
+}
+
+// LedgerEntry is one side of a LedgerTransaction. FarmerID is set on entries
+// of the farmer_payable account, which holds what the platform owes each
+// farmer: credits raise the balance, debits lower it.
+type LedgerEntry struct {
+	ID            uint               `gorm:"primaryKey" json:"id"`
+	CreatedAt     time.Time          `gorm:"index" json:"created_at"`
+	TransactionID uint               `gorm:"index" json:"transaction_id"`
+	Transaction   *LedgerTransaction `gorm:"foreignKey:TransactionID" json:"transaction,omitempty"`
+
+	Account  string  `gorm:"type:varchar(30);index:idx_ledger_account_farmer" json:"account"`
+	FarmerID *uint   `gorm:"index:idx_ledger_account_farmer" json:"farmer_id,omitempty"`
+	Debit    float64 `gorm:"type:decimal(15,2)" json:"debit"`
+	Credit   float64 `gorm:"type:decimal(15,2)" json:"credit"`
+}
+
+// PayoutBatch pays out every farmer balance due at the time it runs; the
+// transfers themselves happen outside the system.
+type PayoutBatch struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	CreatedBy   uint     `json:"created_by"`
+	TotalAmount float64  `gorm:"type:decimal(15,2)" json:"total_amount"`
+	Payouts     []Payout `gorm:"foreignKey:BatchID" json:"payouts,omitempty"`
+}
+
+type Payout struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	BatchID  uint    `gorm:"index" json:"batch_id"`
+	FarmerID uint    `gorm:"index" json:"farmer_id"`
+	Farmer   *User   `gorm:"foreignKey:FarmerID" json:"farmer,omitempty"`
+	Amount   float64 `gorm:"type:decimal(15,2)" json:"amount"`
+}
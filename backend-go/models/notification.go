@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Notification is an in-app message for a user, e.g. when a farmer moves the
+// harvest date of a pre-ordered product.
+type Notification struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID  uint       `gorm:"index" json:"user_id"`
+	Type    string     `gorm:"type:varchar(50)" json:"type"`
+	Title   string     `gorm:"type:varchar(255)" json:"title"`
+	Message string     `gorm:"type:text" json:"message"`
+	OrderID *uint      `json:"order_id,omitempty"`
+	ReadAt  *time.Time `json:"read_at"`
+}
@@ -15,16 +15,56 @@ type Order struct {
 	UserID uint `json:"user_id"`
 	User   User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 
-	TotalPrice   float64  `gorm:"type:decimal(15,2)" json:"total_price"`
-	Status       string   `gorm:"type:enum('pending','paid','shipped','completed','cancelled');default:'pending'" json:"status"`
-	Type         string   `gorm:"type:enum('regular','preorder');default:'regular'" json:"type"`
-	PaymentProof string   `gorm:"type:varchar(255)" json:"payment_proof"`
-	AddressID    *uint    `json:"address_id"`
-	Address      *Address `gorm:"foreignKey:AddressID" json:"address,omitempty"`
-	PaymentID    *uint    `json:"payment_id"`
-	Payment      *Payment `gorm:"foreignKey:PaymentID" json:"payment,omitempty"`
-
-	OrderItems []OrderItem `gorm:"foreignKey:OrderID" json:"items"`
+	TotalPrice   float64    `gorm:"type:decimal(15,2)" json:"total_price"`
+	Status       string     `gorm:"type:enum('pending','reserved','paid','shipped','completed','cancelled','refunded');default:'pending'" json:"status"`
+	Type         string     `gorm:"type:enum('regular','preorder');default:'regular'" json:"type"`
+	PaymentProof string     `gorm:"type:varchar(255)" json:"payment_proof"`
+	AddressID    *uint      `json:"address_id"`
+	Address      *Address   `gorm:"foreignKey:AddressID" json:"address,omitempty"`
+	PaymentID    *uint      `json:"payment_id"`
+	Payment      *Payment   `gorm:"foreignKey:PaymentID" json:"payment,omitempty"`
+	RestockedAt  *time.Time `json:"restocked_at,omitempty"` // Set once cancelled items are returned to stock
+
+	SubscriptionID *uint `gorm:"index" json:"subscription_id,omitempty"` // Set for orders generated by a subscription delivery
+
+	// Pre-order payments: a deposit moves the order to "reserved", the balance to "paid"
+	DepositAmount    float64    `gorm:"type:decimal(15,2)" json:"deposit_amount"`
+	AmountPaid       float64    `gorm:"type:decimal(15,2)" json:"amount_paid"`
+	RefundDue        float64    `gorm:"type:decimal(15,2)" json:"refund_due"`
+	HarvestChangedAt *time.Time `json:"harvest_changed_at,omitempty"` // Farmer moved the harvest date; buyer may cancel for a refund
+
+	// Fees are priced with one fee schedule version; ServiceFee is added to what the buyer pays
+	FeeScheduleID *uint        `json:"fee_schedule_id,omitempty"`
+	FeeSchedule   *FeeSchedule `gorm:"foreignKey:FeeScheduleID" json:"fee_schedule,omitempty"`
+	ServiceFee    float64      `gorm:"type:decimal(15,2)" json:"service_fee"`
+
+	OrderItems   []OrderItem        `gorm:"foreignKey:OrderID" json:"items"`
+	Fulfillments []OrderFulfillment `gorm:"foreignKey:OrderID" json:"fulfillments,omitempty"`
+	Fees         []OrderFee         `gorm:"foreignKey:OrderID" json:"fees,omitempty"`
+}
+
+// OrderFulfillment is the part of an order supplied by a single farmer. Each
+// farmer ships their own fulfillment and is paid out from its subtotal; the
+// parent order's status follows once every fulfillment has caught up.
+type OrderFulfillment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	OrderID  uint   `gorm:"index" json:"order_id"`
+	Order    *Order `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	FarmerID uint   `gorm:"index" json:"farmer_id"`
+	Farmer   User   `gorm:"foreignKey:FarmerID" json:"farmer,omitempty"`
+
+	Status       string     `gorm:"type:enum('pending','reserved','paid','shipped','completed','cancelled','refunded');default:'pending'" json:"status"`
+	SubTotal     float64    `gorm:"type:decimal(15,2)" json:"sub_total"`
+	ShippingCost float64    `gorm:"type:decimal(15,2)" json:"shipping_cost"`
+	ShippedAt    *time.Time `json:"shipped_at,omitempty"`
+	RestockedAt  *time.Time `json:"restocked_at,omitempty"`
+
+	CreditedAt *time.Time `json:"credited_at,omitempty"` // Set once the farmer is credited in the ledger
+
+	Items []OrderItem `gorm:"foreignKey:FulfillmentID" json:"items,omitempty"`
 }
 
 type OrderItem struct {
@@ -33,9 +73,30 @@ type OrderItem struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	OrderID   uint    `json:"order_id"`
-	ProductID uint    `json:"product_id"`
-	Product   Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `gorm:"type:decimal(10,2)" json:"price"`
+	OrderID       uint    `json:"order_id"`
+	FulfillmentID *uint   `gorm:"index" json:"fulfillment_id"`
+	ProductID     uint    `json:"product_id"`
+	Product       Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Quantity      int     `json:"quantity"`
+	Price         float64 `gorm:"type:decimal(10,2)" json:"price"`
+	IsReservation bool    `json:"is_reservation"` // Reserved against the expected harvest instead of taken from stock
+
+	RefundedQuantity int     `json:"refunded_quantity"`
+	CommissionRate   float64 `gorm:"type:decimal(5,2)" json:"commission_rate"` // Percent taken from the farmer, fixed when ordered
+}
+
+// OrderStatusLog records every status change of an order so disputes can be
+// reconstructed later. ActorID 0 with role "system" means the change came from
+// a webhook or background job.
+type OrderStatusLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	OrderID       uint   `gorm:"index" json:"order_id"`
+	FulfillmentID *uint  `json:"fulfillment_id,omitempty"` // Set when only one farmer's part changed
+	FromStatus    string `gorm:"type:varchar(20)" json:"from_status"`
+	ToStatus      string `gorm:"type:varchar(20)" json:"to_status"`
+	ActorID       uint   `json:"actor_id"`
+	ActorRole     string `gorm:"type:varchar(20)" json:"actor_role"`
+	Note          string `gorm:"type:text" json:"note"`
 }
@@ -1,22 +1,67 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Payment struct {
-	ID            uint      `gorm:"primaryKey" json:"id"`
-	OrderID       uint      `gorm:"index" json:"order_id"`
-	Order         *Order    `gorm:"foreignKey:OrderID" json:"order,omitempty"`
-	UserID        uint      `gorm:"index" json:"user_id"`
-	Amount        float64   `json:"amount"`
-	Status        string    `gorm:"type:enum('pending','success','failed','expired')" json:"status"`
-	PaymentMethod string    `gorm:"type:varchar(50)" json:"payment_method"` // credit_card, bank_transfer, ewallet, etc
-	TransactionID string    `gorm:"unique;type:varchar(255)" json:"transaction_id"`
-	SnapToken     string    `gorm:"type:text" json:"snap_token"` // Midtrans snap token
-	SnapURL       string    `gorm:"type:text" json:"snap_url"`   // Midtrans snap URL
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID             uint    `gorm:"primaryKey" json:"id"`
+	OrderID        uint    `gorm:"index" json:"order_id"`
+	Order          *Order  `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	UserID         uint    `gorm:"index" json:"user_id"`
+	Amount         float64 `json:"amount"`
+	Status         string  `gorm:"type:enum('pending','success','failed','expired','partially_refunded','refunded')" json:"status"`
+	PaymentMethod  string  `gorm:"type:varchar(50)" json:"payment_method"` // credit_card, bank_transfer, ewallet, etc
+	TransactionID  string  `gorm:"unique;type:varchar(255)" json:"transaction_id"`
+	SnapToken      string  `gorm:"type:text" json:"snap_token"` // Midtrans snap token
+	SnapURL        string  `gorm:"type:text" json:"snap_url"`   // Midtrans snap URL
+	RefundedAmount float64 `gorm:"type:decimal(15,2)" json:"refunded_amount"`
+	FeeAmount      float64 `gorm:"type:decimal(15,2)" json:"fee_amount"` // Payment method fee included in Amount
+	AttemptNumber  int     `json:"attempt_number"`
+	ActiveKey      *string `gorm:"uniqueIndex;type:varchar(50)" json:"-"` // Set only while pending: one active attempt per order
+
+	// Manual payments are bank transfers paid outside the gateway and
+	// reviewed by hand; only Channel tells them apart
+	Channel      string     `gorm:"type:enum('gateway','manual');default:'gateway';index" json:"channel"`
+	ProofURL     string     `gorm:"type:varchar(255)" json:"-"` // File name under PAYMENT_PROOF_DIR
+	ReviewedBy   *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	RejectReason string     `gorm:"type:text" json:"reject_reason,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 func (Payment) TableName() string {
 	return "payments"
 }
+
+// BeforeSave keeps ActiveKey in step with Status.
+func (p *Payment) BeforeSave(tx *gorm.DB) error {
+	if p.Status == "pending" {
+		key := fmt.Sprintf("order-%d", p.OrderID)
+		p.ActiveKey = &key
+	} else {
+		p.ActiveKey = nil
+	}
+	return nil
+}
+
+// PaymentNotification is a webhook delivery from the payment gateway, stored
+// so that a notification delivered twice is only applied once.
+type PaymentNotification struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	PaymentID         uint      `gorm:"index" json:"payment_id"`
+	DedupKey          string    `gorm:"uniqueIndex;type:varchar(255)" json:"dedup_key"`
+	TransactionStatus string    `gorm:"type:varchar(50)" json:"transaction_status"`
+	StatusCode        string    `gorm:"type:varchar(10)" json:"status_code"`
+	GrossAmount       string    `gorm:"type:varchar(50)" json:"gross_amount"`
+	Payload           string    `gorm:"type:text" json:"payload"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+func (PaymentNotification) TableName() string {
+	return "payment_notifications"
+}
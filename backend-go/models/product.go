@@ -24,11 +24,17 @@ type Product struct {
 	Farmer   User `gorm:"foreignKey:FarmerID" json:"farmer,omitempty"`
 
 	// Features
-	IsPreOrder  bool       `json:"is_pre_order"`
-	HarvestDate *time.Time `json:"harvest_date"` // Nullable, only for pre-order
-
-	IsSubscription     bool   `json:"is_subscription"`
-	SubscriptionPeriod string `json:"subscription_period"` // "weekly", "monthly"
+	IsPreOrder             bool       `json:"is_pre_order"`
+	HarvestDate            *time.Time `json:"harvest_date"`                                       // Nullable, only for pre-order
+	HarvestQuantity        int        `json:"harvest_quantity"`                                   // Expected harvest; pre-orders reserve against this instead of Stock
+	ReservedQuantity       int        `json:"reserved_quantity"`                                  // Already reserved by pre-orders
+	PreOrderDepositPercent float64    `gorm:"type:decimal(5,2)" json:"pre_order_deposit_percent"` // 0 = pay in full up front
+
+	IsSubscription           bool    `json:"is_subscription"`
+	SubscriptionPeriod       string  `json:"subscription_period"`                                  // Allowed periods: "weekly", "monthly" or "weekly,monthly"
+	SubscriptionPriceWeekly  float64 `gorm:"type:decimal(10,2)" json:"subscription_price_weekly"`  // 0 = use Price
+	SubscriptionPriceMonthly float64 `gorm:"type:decimal(10,2)" json:"subscription_price_monthly"` // 0 = use Price
+	SubscriptionMinPeriods   int     `json:"subscription_min_periods"`                             // Minimum commitment in periods, 0 = none
 
 	Views int `gorm:"-" json:"views"` // Transient field for analytics
 }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PaymentReconciliation is the outcome of checking one pending payment against
+// the payment gateway. A payment appears at most once per day with its latest
+// outcome; the rows of a day make up that day's report.
+type PaymentReconciliation struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ReportDate    string  `gorm:"type:char(10);uniqueIndex:idx_reconciliation_day_payment" json:"report_date"` // YYYY-MM-DD
+	PaymentID     uint    `gorm:"uniqueIndex:idx_reconciliation_day_payment" json:"payment_id"`
+	OrderID       uint    `json:"order_id"`
+	TransactionID string  `gorm:"type:varchar(255)" json:"transaction_id"`
+	Amount        float64 `gorm:"type:decimal(15,2)" json:"amount"`
+	LocalStatus   string  `gorm:"type:varchar(30)" json:"local_status"`
+	GatewayStatus string  `gorm:"type:varchar(50)" json:"gateway_status"`
+	Outcome       string  `gorm:"type:enum('matched','corrected','orphaned')" json:"outcome"`
+	Note          string  `gorm:"type:text" json:"note"`
+}
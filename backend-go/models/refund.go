@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Refund is money given back for an order through the payment gateway. A
+// refund larger than the payment it starts from is split into one Refund per
+// payment; the refunded items are recorded on the first of them.
+//
+// A refund is recorded as pending before the gateway is called and then
+// marked succeeded or failed. A refund of a manual bank transfer never goes
+// through the gateway: it is marked manual and the money is sent back by
+// transfer outside the system. The caller's IdempotencyKey makes a repeated
+// request return the refunds already made instead of refunding twice.
+type Refund struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	OrderID   uint     `gorm:"index" json:"order_id"`
+	PaymentID uint     `gorm:"index;uniqueIndex:idx_refund_idempotency" json:"payment_id"`
+	Payment   *Payment `gorm:"foreignKey:PaymentID" json:"payment,omitempty"`
+
+	Status         string  `gorm:"type:enum('pending','succeeded','failed','manual');default:'succeeded'" json:"status"`
+	IdempotencyKey *string `gorm:"type:varchar(64);uniqueIndex:idx_refund_idempotency" json:"-"`
+
+	Amount    float64 `gorm:"type:decimal(15,2)" json:"amount"`
+	Reason    string  `gorm:"type:text" json:"reason"`
+	Restocked bool    `json:"restocked"`
+	Gateway   string  `gorm:"type:varchar(20)" json:"gateway"`
+
+	ActorID   uint   `json:"actor_id"`
+	ActorRole string `gorm:"type:varchar(20)" json:"actor_role"`
+
+	Items []RefundItem `gorm:"foreignKey:RefundID" json:"items,omitempty"`
+}
+
+type RefundItem struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	RefundID    uint    `gorm:"index" json:"refund_id"`
+	OrderItemID uint    `gorm:"index" json:"order_item_id"`
+	ProductID   uint    `json:"product_id"`
+	Quantity    int     `json:"quantity"`
+	Amount      float64 `gorm:"type:decimal(15,2)" json:"amount"`
+	Reason      string  `gorm:"type:text" json:"reason"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Session is one signed-in device. It lives as long as its refresh tokens
+// keep being rotated, until it expires or the user logs it out.
+type Session struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID     uint       `gorm:"index" json:"user_id"`
+	UserAgent  string     `gorm:"type:varchar(255)" json:"user_agent"`
+	IP         string     `gorm:"type:varchar(45)" json:"ip"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+
+	// The access token most recently issued to the device, so logging the
+	// session out can revoke it too.
+	AccessJTI       string    `gorm:"type:varchar(64)" json:"-"`
+	AccessExpiresAt time.Time `json:"-"`
+}
+
+// RefreshToken is one link of a session's rotation chain. Only a hash of the
+// token is stored; a token is good for a single refresh.
+type RefreshToken struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+
+	SessionID uint   `gorm:"index"`
+	TokenHash string `gorm:"type:char(64);uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// RevokedToken lists an access token that must no longer be accepted. Rows
+// can go once the token would have expired anyway.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(64)"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// ActionToken records a token sent by email, such as a password reset link,
+// so each one can be used only once. The token itself is signed and not
+// stored; it is found by its ID.
+type ActionToken struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+
+	JTI       string `gorm:"type:varchar(64);uniqueIndex"`
+	UserID    uint   `gorm:"index"`
+	Purpose   string `gorm:"type:varchar(32)"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -21,5 +21,13 @@ type Subscription struct {
 	Frequency string    `gorm:"type:enum('weekly','monthly')" json:"frequency"`
 	StartDate time.Time `json:"start_date"`
 	EndDate   time.Time `json:"end_date"`
-	Status    string    `gorm:"type:enum('active','cancelled','expired');default:'active'" json:"status"`
+	Status    string    `gorm:"type:enum('active','paused','cancelled','expired');default:'active'" json:"status"`
+
+	// Delivery schedule
+	Quantity          int        `gorm:"default:1" json:"quantity"`
+	Price             float64    `gorm:"type:decimal(10,2)" json:"price"` // Per-unit subscription price locked in when subscribing
+	AddressID         *uint      `json:"address_id"`
+	NextDeliveryAt    *time.Time `gorm:"index" json:"next_delivery_at"` // Nil for subscriptions created before scheduling; treated as StartDate
+	LastDeliveryError string     `gorm:"type:varchar(255)" json:"last_delivery_error,omitempty"`
+	PausedAt          *time.Time `json:"paused_at,omitempty"`
 }
@@ -3,11 +3,24 @@ package models
 import "time"
 
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `gorm:"type:varchar(100)" json:"name"`
-	Email     string    `gorm:"type:varchar(100);unique" json:"email"`
-	Password  string    `gorm:"type:varchar(255)" json:"-"`
-	Role      string    `gorm:"type:enum('petani','pembeli','admin')" json:"role"`
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Name     string `gorm:"type:varchar(100)" json:"name"`
+	Email    string `gorm:"type:varchar(100);unique" json:"email"`
+	Password string `gorm:"type:varchar(255)" json:"-"`
+	Role     string `gorm:"type:enum('petani','pembeli','admin')" json:"role"`
+
+	// Farmers who sign up themselves wait for an admin before they can sell.
+	// Everyone else, and farmers from before verification existed, is verified.
+	VerificationStatus string     `gorm:"type:enum('pending','verified','rejected');default:'verified'" json:"verification_status"`
+	VerifiedBy         *uint      `json:"verified_by,omitempty"`
+	VerifiedAt         *time.Time `json:"verified_at,omitempty"`
+	RejectReason       string     `gorm:"type:text" json:"reject_reason,omitempty"`
+
+	// Self-service signups confirm their address through a mailed link before
+	// they can order or sell. Accounts from before that, or made by an admin,
+	// are verified.
+	EmailStatus string `gorm:"type:enum('unverified','verified');default:'verified'" json:"email_status"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
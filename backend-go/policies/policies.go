@@ -0,0 +1,132 @@
+package policies
+
+import (
+	"errors"
+	"smartfarm-api/models"
+)
+
+// Roles a user can have; AuthMiddleware puts one of them in the context.
+const (
+	RoleAdmin  = "admin"
+	RoleFarmer = "petani"
+	RoleBuyer  = "pembeli"
+)
+
+// ErrForbidden is returned when the actor is signed in but may not touch the
+// resource. Controllers answer it with a 403.
+var ErrForbidden = errors.New("unauthorized")
+
+// Actor identifies who is acting on a resource.
+type Actor struct {
+	UserID uint
+	Role   string
+}
+
+func (a Actor) IsAdmin() bool {
+	return a.Role == RoleAdmin
+}
+
+// OwnsProduct reports whether the farmer listed the product.
+func OwnsProduct(farmerID uint, product models.Product) bool {
+	return product.FarmerID == farmerID
+}
+
+// OwnsAddress reports whether the address is in the user's address book.
+func OwnsAddress(userID uint, address models.Address) bool {
+	return address.UserID == userID
+}
+
+// OwnsSubscription reports whether the user subscribed.
+func OwnsSubscription(userID uint, sub models.Subscription) bool {
+	return sub.UserID == userID
+}
+
+// OwnsOrder reports whether the user placed the order.
+func OwnsOrder(userID uint, order models.Order) bool {
+	return order.UserID == userID
+}
+
+// IsOrderBuyer reports whether the actor is the buyer who placed the order.
+func IsOrderBuyer(actor Actor, order models.Order) bool {
+	return actor.Role == RoleBuyer && OwnsOrder(actor.UserID, order)
+}
+
+// IsOrderFarmer reports whether the actor is a farmer supplying the order.
+func IsOrderFarmer(actor Actor, order models.Order) bool {
+	return actor.Role == RoleFarmer && OrderHasFarmer(order, actor.UserID)
+}
+
+// OrderHasFarmer reports whether the farmer supplies any of the order,
+// through a fulfillment or, for orders placed before fulfillments, an item.
+func OrderHasFarmer(order models.Order, farmerID uint) bool {
+	for _, f := range order.Fulfillments {
+		if f.FarmerID == farmerID {
+			return true
+		}
+	}
+	for _, item := range order.OrderItems {
+		if item.Product.FarmerID == farmerID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanReviewOrder lets admins and the order's farmers make seller-side
+// decisions on it, such as refunds and bank transfer reviews.
+func CanReviewOrder(actor Actor, order models.Order) bool {
+	return actor.IsAdmin() || IsOrderFarmer(actor, order)
+}
+
+// CanReviewPayment lets admins decide on a manual payment, and a farmer only
+// when they supply the whole order: a transfer that pays several farmers is
+// not one farmer's to accept.
+func CanReviewPayment(actor Actor, order models.Order) bool {
+	if actor.IsAdmin() {
+		return true
+	}
+	if !IsOrderFarmer(actor, order) {
+		return false
+	}
+	for _, f := range order.Fulfillments {
+		if f.FarmerID != actor.UserID {
+			return false
+		}
+	}
+	for _, item := range order.OrderItems {
+		if item.FulfillmentID == nil && item.Product.FarmerID != actor.UserID {
+			return false
+		}
+	}
+	return true
+}
+
+// CanRefundItem lets farmers refund only what they supplied.
+func CanRefundItem(actor Actor, order models.Order, item models.OrderItem) bool {
+	if actor.IsAdmin() {
+		return true
+	}
+	if item.FulfillmentID != nil {
+		for _, f := range order.Fulfillments {
+			if f.ID == *item.FulfillmentID {
+				return f.FarmerID == actor.UserID
+			}
+		}
+	}
+	return item.Product.FarmerID == actor.UserID
+}
+
+// CanSell lets a farmer list and edit products once an admin has verified
+// their account. The error says why not, for the farmer to see.
+func CanSell(user models.User) error {
+	if user.Role != RoleFarmer {
+		return ErrForbidden
+	}
+	switch user.VerificationStatus {
+	case "pending":
+		return errors.New("farmer account is pending verification")
+	case "rejected":
+		return errors.New("farmer account was rejected")
+	}
+	return nil
+}
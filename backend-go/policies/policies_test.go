@@ -0,0 +1,64 @@
+package policies
+
+import (
+	"smartfarm-api/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderPolicies(t *testing.T) {
+	fulfillmentID := uint(10)
+	order := models.Order{
+		UserID:       5,
+		Fulfillments: []models.OrderFulfillment{{ID: 10, FarmerID: 7}},
+		OrderItems:   []models.OrderItem{{ID: 100, FulfillmentID: &fulfillmentID}},
+	}
+
+	buyer := Actor{UserID: 5, Role: RoleBuyer}
+	farmer := Actor{UserID: 7, Role: RoleFarmer}
+	otherFarmer := Actor{UserID: 8, Role: RoleFarmer}
+	admin := Actor{UserID: 1, Role: RoleAdmin}
+
+	assert.True(t, IsOrderBuyer(buyer, order))
+	assert.False(t, IsOrderBuyer(Actor{UserID: 5, Role: RoleFarmer}, order))
+	assert.True(t, IsOrderFarmer(farmer, order))
+	assert.False(t, IsOrderFarmer(otherFarmer, order))
+
+	assert.True(t, CanReviewOrder(admin, order))
+	assert.True(t, CanReviewOrder(farmer, order))
+	assert.False(t, CanReviewOrder(otherFarmer, order))
+	assert.False(t, CanReviewOrder(buyer, order))
+
+	assert.True(t, CanReviewPayment(admin, order))
+	assert.True(t, CanReviewPayment(farmer, order))
+	assert.False(t, CanReviewPayment(otherFarmer, order))
+
+	// A transfer paying several farmers is reviewed by an admin
+	shared := order
+	shared.Fulfillments = append(shared.Fulfillments, models.OrderFulfillment{ID: 20, FarmerID: 8})
+	assert.True(t, CanReviewOrder(farmer, shared))
+	assert.False(t, CanReviewPayment(farmer, shared))
+	assert.False(t, CanReviewPayment(otherFarmer, shared))
+	assert.True(t, CanReviewPayment(admin, shared))
+
+	assert.True(t, CanRefundItem(farmer, order, order.OrderItems[0]))
+	assert.False(t, CanRefundItem(otherFarmer, order, order.OrderItems[0]))
+	assert.True(t, CanRefundItem(admin, order, order.OrderItems[0]))
+}
+
+func TestOwnership(t *testing.T) {
+	assert.True(t, OwnsProduct(7, models.Product{FarmerID: 7}))
+	assert.False(t, OwnsProduct(8, models.Product{FarmerID: 7}))
+	assert.True(t, OwnsAddress(5, models.Address{UserID: 5}))
+	assert.False(t, OwnsAddress(6, models.Address{UserID: 5}))
+	assert.True(t, OwnsSubscription(5, models.Subscription{UserID: 5}))
+	assert.False(t, OwnsOrder(6, models.Order{UserID: 5}))
+}
+
+func TestCanSell(t *testing.T) {
+	assert.NoError(t, CanSell(models.User{Role: RoleFarmer, VerificationStatus: "verified"}))
+	assert.EqualError(t, CanSell(models.User{Role: RoleFarmer, VerificationStatus: "pending"}), "farmer account is pending verification")
+	assert.EqualError(t, CanSell(models.User{Role: RoleFarmer, VerificationStatus: "rejected"}), "farmer account was rejected")
+	assert.Equal(t, ErrForbidden, CanSell(models.User{Role: RoleBuyer, VerificationStatus: "verified"}))
+}
@@ -0,0 +1,28 @@
+package repositories
+
+import (
+	"smartfarm-api/config"
+	"smartfarm-api/models"
+	"time"
+)
+
+func CreateActionToken(token *models.ActionToken) error {
+	return config.DB.Create(token).Error
+}
+
+// UseActionToken spends the token and reports whether it was still unused
+// and unexpired. Two requests racing with the same link get one true.
+func UseActionToken(jti string, at time.Time) (bool, error) {
+	result := config.DB.Model(&models.ActionToken{}).
+		Where("jti = ? AND used_at IS NULL AND expires_at > ?", jti, at).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// DiscardActionTokens spends the user's unused tokens for the purpose, so
+// only the most recently mailed link works.
+func DiscardActionTokens(userID uint, purpose string, at time.Time) error {
+	return config.DB.Model(&models.ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", at).Error
+}
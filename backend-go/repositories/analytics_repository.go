@@ -11,7 +11,7 @@ type AnalyticsRepository interface {
 	LogView(view *models.ProductView) error
 	GetTrendingProducts(limit int) ([]models.Product, error)
 	GetFarmerStats(farmerID uint) (float64, int, int, int, error)
-	GetFarmerRecentOrders(farmerID uint, limit int) ([]models.Order, error)
+	GetFarmerRecentFulfillments(farmerID uint, limit int) ([]models.OrderFulfillment, error)
 }
 
 type analyticsRepository struct {
@@ -51,26 +51,24 @@ func (r *analyticsRepository) GetFarmerStats(farmerID uint) (float64, int, int,
 	var totalCustomers int64
 	var totalProducts int64
 
+	// Each farmer has their own fulfillment per order, so revenue is exactly
+	// what they sold and not a share of mixed orders
+	paidStatuses := []string{"paid", "shipped", "completed"}
+
 	// Revenue and Orders
-	r.db.Table("order_items").
-		Joins("join products on products.id = order_items.product_id").
-		Joins("join orders on orders.id = order_items.order_id").
-		Where("products.farmer_id = ? AND orders.status = ?", farmerID, "paid").
-		Select("SUM(order_items.price * order_items.quantity)").
+	r.db.Table("order_fulfillments").
+		Where("farmer_id = ? AND status IN ?", farmerID, paidStatuses).
+		Select("COALESCE(SUM(sub_total), 0)").
 		Scan(&totalRevenue)
 
-	r.db.Table("order_items").
-		Joins("join products on products.id = order_items.product_id").
-		Joins("join orders on orders.id = order_items.order_id").
-		Where("products.farmer_id = ? AND orders.status = ?", farmerID, "paid").
-		Distinct("order_items.order_id").
+	r.db.Table("order_fulfillments").
+		Where("farmer_id = ? AND status IN ?", farmerID, paidStatuses).
 		Count(&totalOrders)
 
 	// Unique Customers
-	r.db.Table("order_items").
-		Joins("join products on products.id = order_items.product_id").
-		Joins("join orders on orders.id = order_items.order_id").
-		Where("products.farmer_id = ? AND orders.status = ?", farmerID, "paid").
+	r.db.Table("order_fulfillments").
+		Joins("join orders on orders.id = order_fulfillments.order_id").
+		Where("order_fulfillments.farmer_id = ? AND order_fulfillments.status IN ?", farmerID, paidStatuses).
 		Distinct("orders.user_id").
 		Count(&totalCustomers)
 
@@ -80,18 +78,13 @@ func (r *analyticsRepository) GetFarmerStats(farmerID uint) (float64, int, int,
 	return totalRevenue, int(totalOrders), int(totalCustomers), int(totalProducts), nil
 }
 
-func (r *analyticsRepository) GetFarmerRecentOrders(farmerID uint, limit int) ([]models.Order, error) {
-	var orders []models.Order
-	// This is a bit complex because one order might have products from multiple farmers.
-	// We only show orders that contain at least one product from this farmer.
-	err := r.db.Preload("OrderItems.Product").
-		Joins("join order_items on order_items.order_id = orders.id").
-		Joins("join products on products.id = order_items.product_id").
-		Where("products.farmer_id = ?", farmerID).
-		Distinct("orders.id", "orders.*"). // Avoid duplicate orders
-		Order("orders.created_at desc").
+func (r *analyticsRepository) GetFarmerRecentFulfillments(farmerID uint, limit int) ([]models.OrderFulfillment, error) {
+	var fulfillments []models.OrderFulfillment
+	err := r.db.Preload("Items.Product").
+		Where("farmer_id = ?", farmerID).
+		Order("created_at desc").
 		Limit(limit).
-		Find(&orders).Error
+		Find(&fulfillments).Error
 
-	return orders, err
+	return fulfillments, err
 }
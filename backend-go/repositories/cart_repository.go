@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"smartfarm-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CartRepository interface {
+	FindOrCreateByUserID(userID uint) (models.Cart, error)
+	FindByUserIDForUpdate(userID uint) (models.Cart, error)
+	FindItem(cartID uint, productID uint) (models.CartItem, error)
+	SaveItem(item *models.CartItem) error
+	DeleteItem(cartID uint, productID uint) error
+	ClearItems(cartID uint) error
+	WithTx(tx *gorm.DB) CartRepository
+}
+
+type cartRepository struct {
+	db *gorm.DB
+}
+
+func NewCartRepository(db *gorm.DB) CartRepository {
+	return &cartRepository{db}
+}
+
+func (r *cartRepository) FindOrCreateByUserID(userID uint) (models.Cart, error) {
+	cart := models.Cart{UserID: userID}
+	if err := r.db.Where("user_id = ?", userID).FirstOrCreate(&cart).Error; err != nil {
+		return cart, err
+	}
+	err := r.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at asc")
+	}).Preload("Items.Product").First(&cart, cart.ID).Error
+	return cart, err
+}
+
+// FindByUserIDForUpdate locks the cart row so two checkouts of the same cart
+// cannot both create an order.
+func (r *cartRepository) FindByUserIDForUpdate(userID uint) (models.Cart, error) {
+	var cart models.Cart
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").Where("user_id = ?", userID).First(&cart).Error
+	return cart, err
+}
+
+func (r *cartRepository) FindItem(cartID uint, productID uint) (models.CartItem, error) {
+	var item models.CartItem
+	err := r.db.Where("cart_id = ? AND product_id = ?", cartID, productID).First(&item).Error
+	return item, err
+}
+
+func (r *cartRepository) SaveItem(item *models.CartItem) error {
+	return r.db.Omit("Product").Save(item).Error
+}
+
+func (r *cartRepository) DeleteItem(cartID uint, productID uint) error {
+	return r.db.Where("cart_id = ? AND product_id = ?", cartID, productID).Delete(&models.CartItem{}).Error
+}
+
+func (r *cartRepository) ClearItems(cartID uint) error {
+	return r.db.Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error
+}
+
+func (r *cartRepository) WithTx(tx *gorm.DB) CartRepository {
+	return &cartRepository{db: tx}
+}
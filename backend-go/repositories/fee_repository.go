@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"errors"
+	"smartfarm-api/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FeeRepository interface {
+	FindActiveSchedule(at time.Time) (*models.FeeSchedule, error)
+	FindScheduleByID(id uint) (*models.FeeSchedule, error)
+	FindSchedules() ([]models.FeeSchedule, error)
+	CreateSchedule(schedule *models.FeeSchedule) error
+	WithTx(tx *gorm.DB) FeeRepository
+}
+
+type feeRepository struct {
+	db *gorm.DB
+}
+
+func NewFeeRepository(db *gorm.DB) FeeRepository {
+	return &feeRepository{db}
+}
+
+// FindActiveSchedule returns the newest schedule in effect at the given time,
+// or nil when fees were never configured.
+func (r *feeRepository) FindActiveSchedule(at time.Time) (*models.FeeSchedule, error) {
+	var schedule models.FeeSchedule
+	err := r.db.Preload("Rules").Where("effective_from <= ?", at).Order("effective_from desc, version desc").First(&schedule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (r *feeRepository) FindScheduleByID(id uint) (*models.FeeSchedule, error) {
+	var schedule models.FeeSchedule
+	err := r.db.Preload("Rules").First(&schedule, id).Error
+	return &schedule, err
+}
+
+func (r *feeRepository) FindSchedules() ([]models.FeeSchedule, error) {
+	var schedules []models.FeeSchedule
+	err := r.db.Preload("Rules").Order("version desc").Find(&schedules).Error
+	return schedules, err
+}
+
+// CreateSchedule saves the schedule and its rules as the next version. The
+// latest schedule row is locked so two versions cannot get the same number.
+func (r *feeRepository) CreateSchedule(schedule *models.FeeSchedule) error {
+	var latest models.FeeSchedule
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Order("version desc").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	schedule.Version = latest.Version + 1
+	return r.db.Create(schedule).Error
+}
+
+func (r *feeRepository) WithTx(tx *gorm.DB) FeeRepository {
+	return &feeRepository{db: tx}
+}
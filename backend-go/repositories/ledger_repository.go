@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"smartfarm-api/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FarmerBalance is what the platform owes one farmer.
+type FarmerBalance struct {
+	FarmerID uint
+	Balance  float64
+}
+
+// LedgerKindTotal sums a farmer's entries of one transaction kind.
+type LedgerKindTotal struct {
+	Kind   string
+	Debit  float64
+	Credit float64
+}
+
+type LedgerRepository interface {
+	CreateTransaction(txn *models.LedgerTransaction) error
+	FarmerBalance(farmerID uint, before *time.Time) (float64, error)
+	FarmerTotalsByKind(farmerID uint) ([]LedgerKindTotal, error)
+	FindFarmerEntries(farmerID uint, from time.Time, to time.Time) ([]models.LedgerEntry, error)
+	FindFarmerBalancesDue(minAmount float64) ([]FarmerBalance, error)
+	PendingEarnings(farmerID uint) (float64, error)
+	LockFarmer(farmerID uint) error
+	CreatePayoutBatch(batch *models.PayoutBatch) error
+	UpdatePayoutBatchTotal(id uint, total float64) error
+	CreatePayout(payout *models.Payout) error
+	FindPayoutBatches(limit int) ([]models.PayoutBatch, error)
+	WithTx(tx *gorm.DB) LedgerRepository
+}
+
+type ledgerRepository struct {
+	db *gorm.DB
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db}
+}
+
+func (r *ledgerRepository) CreateTransaction(txn *models.LedgerTransaction) error {
+	return r.db.Create(txn).Error
+}
+
+func (r *ledgerRepository) farmerEntries(farmerID uint) *gorm.DB {
+	return r.db.Model(&models.LedgerEntry{}).Where("account = ? AND farmer_id = ?", "farmer_payable", farmerID)
+}
+
+// FarmerBalance sums the farmer's account, only up to before when it is set.
+func (r *ledgerRepository) FarmerBalance(farmerID uint, before *time.Time) (float64, error) {
+	var balance float64
+	query := r.farmerEntries(farmerID)
+	if before != nil {
+		query = query.Where("created_at < ?", *before)
+	}
+	err := query.Select("COALESCE(SUM(credit - debit), 0)").Scan(&balance).Error
+	return balance, err
+}
+
+func (r *ledgerRepository) FarmerTotalsByKind(farmerID uint) ([]LedgerKindTotal, error) {
+	var totals []LedgerKindTotal
+	err := r.farmerEntries(farmerID).
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Select("ledger_transactions.kind AS kind, COALESCE(SUM(ledger_entries.debit), 0) AS debit, COALESCE(SUM(ledger_entries.credit), 0) AS credit").
+		Group("ledger_transactions.kind").
+		Scan(&totals).Error
+	return totals, err
+}
+
+func (r *ledgerRepository) FindFarmerEntries(farmerID uint, from time.Time, to time.Time) ([]models.LedgerEntry, error) {
+	var entries []models.LedgerEntry
+	err := r.farmerEntries(farmerID).Preload("Transaction").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Order("created_at asc, id asc").
+		Find(&entries).Error
+	return entries, err
+}
+
+// FindFarmerBalancesDue returns every farmer owed at least minAmount, and
+// always more than zero.
+func (r *ledgerRepository) FindFarmerBalancesDue(minAmount float64) ([]FarmerBalance, error) {
+	var balances []FarmerBalance
+	err := r.db.Model(&models.LedgerEntry{}).
+		Where("account = ? AND farmer_id IS NOT NULL", "farmer_payable").
+		Select("farmer_id, SUM(credit - debit) AS balance").
+		Group("farmer_id").
+		Having("SUM(credit - debit) > 0 AND SUM(credit - debit) >= ?", minAmount).
+		Order("farmer_id asc").
+		Scan(&balances).Error
+	return balances, err
+}
+
+// PendingEarnings is the value of the farmer's paid fulfillments that are
+// not completed yet and so not in the ledger.
+func (r *ledgerRepository) PendingEarnings(farmerID uint) (float64, error) {
+	var pending float64
+	err := r.db.Model(&models.OrderFulfillment{}).
+		Where("farmer_id = ? AND status IN ? AND credited_at IS NULL", farmerID, []string{"reserved", "paid", "shipped"}).
+		Select("COALESCE(SUM(sub_total + shipping_cost), 0)").
+		Scan(&pending).Error
+	return pending, err
+}
+
+// LockFarmer locks the farmer's user row so two payout batches cannot pay out
+// the same balance.
+func (r *ledgerRepository) LockFarmer(farmerID uint) error {
+	var user models.User
+	return r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, farmerID).Error
+}
+
+func (r *ledgerRepository) CreatePayoutBatch(batch *models.PayoutBatch) error {
+	return r.db.Omit("Payouts").Create(batch).Error
+}
+
+func (r *ledgerRepository) UpdatePayoutBatchTotal(id uint, total float64) error {
+	return r.db.Model(&models.PayoutBatch{}).Where("id = ?", id).Update("total_amount", total).Error
+}
+
+func (r *ledgerRepository) CreatePayout(payout *models.Payout) error {
+	return r.db.Omit("Farmer").Create(payout).Error
+}
+
+func (r *ledgerRepository) FindPayoutBatches(limit int) ([]models.PayoutBatch, error) {
+	var batches []models.PayoutBatch
+	err := r.db.Preload("Payouts.Farmer").Order("created_at desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func (r *ledgerRepository) WithTx(tx *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: tx}
+}
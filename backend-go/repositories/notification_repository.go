@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"smartfarm-api/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type NotificationRepository interface {
+	Create(notification *models.Notification) error
+	FindByUserID(userID uint, limit int) ([]models.Notification, error)
+	MarkRead(id uint, userID uint, at time.Time) (int64, error)
+	WithTx(tx *gorm.DB) NotificationRepository
+}
+
+type notificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository(db *gorm.DB) NotificationRepository {
+	return &notificationRepository{db}
+}
+
+func (r *notificationRepository) Create(notification *models.Notification) error {
+	return r.db.Create(notification).Error
+}
+
+func (r *notificationRepository) FindByUserID(userID uint, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := r.db.Where("user_id = ?", userID).Order("created_at desc").Limit(limit).Find(&notifications).Error
+	return notifications, err
+}
+
+// MarkRead only touches the user's own notification and reports how many rows changed.
+func (r *notificationRepository) MarkRead(id uint, userID uint, at time.Time) (int64, error) {
+	result := r.db.Model(&models.Notification{}).Where("id = ? AND user_id = ?", id, userID).Update("read_at", at)
+	return result.RowsAffected, result.Error
+}
+
+func (r *notificationRepository) WithTx(tx *gorm.DB) NotificationRepository {
+	return &notificationRepository{db: tx}
+}
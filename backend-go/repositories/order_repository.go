@@ -2,20 +2,41 @@ package repositories
 
 import (
 	"smartfarm-api/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepository interface {
 	Create(order *models.Order) error
 	FindByID(id uint) (models.Order, error)
+	FindByIDForUpdate(id uint) (models.Order, error)
 	FindByUserID(userID uint) ([]models.Order, error)
 	FindAll() ([]models.Order, error)
+	FindPendingCreatedBefore(cutoff time.Time, afterID uint, limit int) ([]models.Order, error)
 	UpdateStatus(id uint, status string) error
 	Update(order *models.Order) error
 	UpdatePaymentInfo(id uint, paymentID uint, addressID uint) error
+	UpdatePaymentProof(id uint, paymentID uint, proof string) error
+	CreateFees(fees []models.OrderFee) error
+	MarkRestocked(id uint, at time.Time) error
+	AddAmountPaid(id uint, amount float64) error
+	SetRefundDue(id uint, amount float64) error
+	UpdateItemRefundedQuantity(itemID uint, quantity int) error
+	FindOpenByProductID(productID uint) ([]models.Order, error)
+	MarkHarvestChanged(id uint, at time.Time) error
+	CreateFulfillment(fulfillment *models.OrderFulfillment) error
+	SaveFulfillment(fulfillment *models.OrderFulfillment) error
+	CreateStatusLog(log *models.OrderStatusLog) error
+	FindStatusLogs(orderID uint) ([]models.OrderStatusLog, error)
 	CreateSubscription(sub *models.Subscription) error
 	FindSubscriptionsByUserID(userID uint) ([]models.Subscription, error)
+	FindSubscriptionByID(id uint) (models.Subscription, error)
+	FindSubscriptionByIDForUpdate(id uint) (models.Subscription, error)
+	FindDueSubscriptions(now time.Time, limit int) ([]models.Subscription, error)
+	UpdateSubscription(sub *models.Subscription) error
+	FindBySubscriptionID(subscriptionID uint) ([]models.Order, error)
 	WithTx(tx *gorm.DB) OrderRepository
 }
 
@@ -33,19 +54,34 @@ func (r *orderRepository) Create(order *models.Order) error {
 
 func (r *orderRepository) FindByID(id uint) (models.Order, error) {
 	var order models.Order
-	err := r.db.Preload("OrderItems.Product").First(&order, id).Error
+	err := r.db.Preload("OrderItems.Product").Preload("Fulfillments").Preload("Fees").First(&order, id).Error
+	return order, err
+}
+
+// FindByIDForUpdate locks the order row until the surrounding transaction ends.
+func (r *orderRepository) FindByIDForUpdate(id uint) (models.Order, error) {
+	var order models.Order
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderItems.Product").Preload("Fulfillments").Preload("Fees").First(&order, id).Error
 	return order, err
 }
 
 func (r *orderRepository) FindByUserID(userID uint) ([]models.Order, error) {
 	var orders []models.Order
-	err := r.db.Preload("OrderItems.Product").Where("user_id = ?", userID).Order("created_at desc").Find(&orders).Error
+	err := r.db.Preload("OrderItems.Product").Preload("Fulfillments").Preload("Fees").Where("user_id = ?", userID).Order("created_at desc").Find(&orders).Error
 	return orders, err
 }
 
 func (r *orderRepository) FindAll() ([]models.Order, error) {
 	var orders []models.Order
-	err := r.db.Preload("User").Preload("OrderItems.Product").Order("created_at desc").Find(&orders).Error
+	err := r.db.Preload("User").Preload("OrderItems.Product").Preload("Fulfillments").Preload("Fees").Order("created_at desc").Find(&orders).Error
+	return orders, err
+}
+
+// FindPendingCreatedBefore pages through pending orders by ID so orders that
+// cannot be expired do not hide the ones after them.
+func (r *orderRepository) FindPendingCreatedBefore(cutoff time.Time, afterID uint, limit int) ([]models.Order, error) {
+	var orders []models.Order
+	err := r.db.Where("status = ? AND created_at < ? AND id > ?", "pending", cutoff, afterID).Order("id asc").Limit(limit).Find(&orders).Error
 	return orders, err
 }
 
@@ -64,6 +100,70 @@ func (r *orderRepository) UpdatePaymentInfo(id uint, paymentID uint, addressID u
 	}).Error
 }
 
+func (r *orderRepository) UpdatePaymentProof(id uint, paymentID uint, proof string) error {
+	return r.db.Model(&models.Order{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"payment_id":    paymentID,
+		"payment_proof": proof,
+	}).Error
+}
+
+func (r *orderRepository) CreateFees(fees []models.OrderFee) error {
+	if len(fees) == 0 {
+		return nil
+	}
+	return r.db.Create(&fees).Error
+}
+
+func (r *orderRepository) MarkRestocked(id uint, at time.Time) error {
+	return r.db.Model(&models.Order{}).Where("id = ?", id).Update("restocked_at", at).Error
+}
+
+// AddAmountPaid increments the amount paid so far in a single statement.
+func (r *orderRepository) AddAmountPaid(id uint, amount float64) error {
+	return r.db.Model(&models.Order{}).Where("id = ?", id).Update("amount_paid", gorm.Expr("amount_paid + ?", amount)).Error
+}
+
+func (r *orderRepository) SetRefundDue(id uint, amount float64) error {
+	return r.db.Model(&models.Order{}).Where("id = ?", id).Update("refund_due", amount).Error
+}
+
+func (r *orderRepository) UpdateItemRefundedQuantity(itemID uint, quantity int) error {
+	return r.db.Model(&models.OrderItem{}).Where("id = ?", itemID).Update("refunded_quantity", quantity).Error
+}
+
+// FindOpenByProductID returns orders containing the product that have not
+// shipped or been cancelled yet.
+func (r *orderRepository) FindOpenByProductID(productID uint) ([]models.Order, error) {
+	var orders []models.Order
+	err := r.db.Where("status IN ?", []string{"pending", "reserved", "paid"}).
+		Where("id IN (?)", r.db.Model(&models.OrderItem{}).Select("order_id").Where("product_id = ?", productID)).
+		Find(&orders).Error
+	return orders, err
+}
+
+func (r *orderRepository) MarkHarvestChanged(id uint, at time.Time) error {
+	return r.db.Model(&models.Order{}).Where("id = ?", id).Update("harvest_changed_at", at).Error
+}
+
+// CreateFulfillment inserts the fulfillment together with its order items.
+func (r *orderRepository) CreateFulfillment(fulfillment *models.OrderFulfillment) error {
+	return r.db.Create(fulfillment).Error
+}
+
+func (r *orderRepository) SaveFulfillment(fulfillment *models.OrderFulfillment) error {
+	return r.db.Omit("Order", "Farmer", "Items").Save(fulfillment).Error
+}
+
+func (r *orderRepository) CreateStatusLog(log *models.OrderStatusLog) error {
+	return r.db.Create(log).Error
+}
+
+func (r *orderRepository) FindStatusLogs(orderID uint) ([]models.OrderStatusLog, error) {
+	var logs []models.OrderStatusLog
+	err := r.db.Where("order_id = ?", orderID).Order("created_at asc, id asc").Find(&logs).Error
+	return logs, err
+}
+
 func (r *orderRepository) CreateSubscription(sub *models.Subscription) error {
 	return r.db.Create(sub).Error
 }
@@ -74,6 +174,39 @@ func (r *orderRepository) FindSubscriptionsByUserID(userID uint) ([]models.Subsc
 	return subs, err
 }
 
+func (r *orderRepository) FindSubscriptionByID(id uint) (models.Subscription, error) {
+	var sub models.Subscription
+	err := r.db.Preload("Product").First(&sub, id).Error
+	return sub, err
+}
+
+func (r *orderRepository) FindSubscriptionByIDForUpdate(id uint) (models.Subscription, error) {
+	var sub models.Subscription
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, id).Error
+	return sub, err
+}
+
+// FindDueSubscriptions returns active subscriptions whose next delivery is due.
+// Subscriptions created before scheduling existed have no next delivery yet.
+func (r *orderRepository) FindDueSubscriptions(now time.Time, limit int) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := r.db.Where("status = ? AND (next_delivery_at <= ? OR (next_delivery_at IS NULL AND start_date <= ?))", "active", now, now).
+		Order("next_delivery_at asc").
+		Limit(limit).
+		Find(&subs).Error
+	return subs, err
+}
+
+func (r *orderRepository) UpdateSubscription(sub *models.Subscription) error {
+	return r.db.Omit("User", "Product").Save(sub).Error
+}
+
+func (r *orderRepository) FindBySubscriptionID(subscriptionID uint) ([]models.Order, error) {
+	var orders []models.Order
+	err := r.db.Where("subscription_id = ?", subscriptionID).Order("created_at asc").Find(&orders).Error
+	return orders, err
+}
+
 func (r *orderRepository) WithTx(tx *gorm.DB) OrderRepository {
 	return &orderRepository{db: tx}
 }
@@ -3,8 +3,155 @@ package repositories
 import (
 	"smartfarm-api/config"
 	"smartfarm-api/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+type PaymentRepository interface {
+	Create(payment *models.Payment) error
+	FindByID(id uint) (*models.Payment, error)
+	FindByIDForUpdate(id uint) (*models.Payment, error)
+	FindPendingCreatedBefore(cutoff time.Time, afterID uint, limit int) ([]models.Payment, error)
+	FindByTransactionID(transactionID string) (*models.Payment, error)
+	FindByTransactionIDForUpdate(transactionID string) (*models.Payment, error)
+	FindByOrderID(orderID uint) (*models.Payment, error)
+	FindAllByOrderID(orderID uint) ([]models.Payment, error)
+	FindProofsAwaitingReview(farmerID uint) ([]models.Payment, error)
+	FindRefundableByOrderIDForUpdate(orderID uint) ([]models.Payment, error)
+	Update(payment *models.Payment) error
+	UpdateCharge(id uint, snapToken string, snapURL string) error
+	ExpirePendingByOrderID(orderID uint) error
+	HasNotification(dedupKey string) (bool, error)
+	CreateNotification(notification *models.PaymentNotification) error
+	WithTx(tx *gorm.DB) PaymentRepository
+}
+
+type paymentRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentRepository(db *gorm.DB) PaymentRepository {
+	return &paymentRepository{db}
+}
+
+func (r *paymentRepository) Create(payment *models.Payment) error {
+	return r.db.Create(payment).Error
+}
+
+func (r *paymentRepository) FindByID(id uint) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.db.First(&payment, id).Error
+	return &payment, err
+}
+
+func (r *paymentRepository) FindByIDForUpdate(id uint) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, id).Error
+	return &payment, err
+}
+
+// FindPendingCreatedBefore pages through pending gateway payments by ID so
+// payments that stay pending do not hide the ones after them. Manual bank
+// transfers are left to review.
+func (r *paymentRepository) FindPendingCreatedBefore(cutoff time.Time, afterID uint, limit int) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.Where("status = ? AND created_at < ? AND id > ?", "pending", cutoff, afterID).
+		Where("channel = ?", "gateway").
+		Order("id asc").Limit(limit).Find(&payments).Error
+	return payments, err
+}
+
+func (r *paymentRepository) FindByTransactionID(transactionID string) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.db.Where("transaction_id = ?", transactionID).First(&payment).Error
+	return &payment, err
+}
+
+// FindByTransactionIDForUpdate locks the payment row until the surrounding
+// transaction ends, so deliveries for the same payment are applied one at a time.
+func (r *paymentRepository) FindByTransactionIDForUpdate(transactionID string) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("transaction_id = ?", transactionID).First(&payment).Error
+	return &payment, err
+}
+
+func (r *paymentRepository) FindByOrderID(orderID uint) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.db.Where("order_id = ?", orderID).First(&payment).Error
+	return &payment, err
+}
+
+// FindAllByOrderID returns every payment attempt of the order, oldest first.
+func (r *paymentRepository) FindAllByOrderID(orderID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.Where("order_id = ?", orderID).Order("created_at asc, id asc").Find(&payments).Error
+	return payments, err
+}
+
+// FindProofsAwaitingReview returns bank transfers waiting for review, oldest
+// first. A farmerID other than 0 limits them to orders the farmer supplies
+// alone.
+func (r *paymentRepository) FindProofsAwaitingReview(farmerID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	query := r.db.Preload("Order").Where("channel = ? AND status = ?", "manual", "pending")
+	if farmerID != 0 {
+		query = query.
+			Where("order_id IN (?)", r.db.Model(&models.OrderFulfillment{}).Select("order_id").Where("farmer_id = ?", farmerID)).
+			Where("order_id NOT IN (?)", r.db.Model(&models.OrderFulfillment{}).Select("order_id").Where("farmer_id <> ?", farmerID))
+	}
+	err := query.Order("created_at asc").Find(&payments).Error
+	return payments, err
+}
+
+// FindRefundableByOrderIDForUpdate locks the order's settled payments that
+// still have money left to refund, newest first.
+func (r *paymentRepository) FindRefundableByOrderIDForUpdate(orderID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status IN ?", orderID, []string{"success", "partially_refunded"}).
+		Order("created_at desc, id desc").
+		Find(&payments).Error
+	return payments, err
+}
+
+func (r *paymentRepository) Update(payment *models.Payment) error {
+	return r.db.Save(payment).Error
+}
+
+// UpdateCharge stores the gateway token without touching the status, which
+// a fast webhook may already have changed.
+func (r *paymentRepository) UpdateCharge(id uint, snapToken string, snapURL string) error {
+	return r.db.Model(&models.Payment{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"snap_token": snapToken,
+		"snap_url":   snapURL,
+	}).Error
+}
+
+// ExpirePendingByOrderID marks every still-pending payment of the order as
+// expired and frees its active slot.
+func (r *paymentRepository) ExpirePendingByOrderID(orderID uint) error {
+	return r.db.Model(&models.Payment{}).
+		Where("order_id = ? AND status = ?", orderID, "pending").
+		UpdateColumns(map[string]interface{}{"status": "expired", "active_key": nil}).Error
+}
+
+func (r *paymentRepository) HasNotification(dedupKey string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.PaymentNotification{}).Where("dedup_key = ?", dedupKey).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *paymentRepository) CreateNotification(notification *models.PaymentNotification) error {
+	return r.db.Create(notification).Error
+}
+
+func (r *paymentRepository) WithTx(tx *gorm.DB) PaymentRepository {
+	return &paymentRepository{db: tx}
+}
+
+// Keep legacy function wrappers for backward compatibility
 func CreatePayment(payment *models.Payment) error {
 	return config.DB.Create(payment).Error
 }
@@ -6,15 +6,18 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ProductRepository interface {
 	Create(product *models.Product) error
 	Update(product *models.Product) error
+	UpdateDetails(product *models.Product) error
 	Delete(id uint) error
 	FindAll(query string, limit int, offset int) ([]models.Product, error)
 	CountAll(query string) (int64, error)
 	FindByID(id uint) (models.Product, error)
+	FindByIDForUpdate(id uint) (models.Product, error)
 	FindByFarmerID(farmerID uint, limit int, offset int) ([]models.Product, error)
 	CountByFarmerID(farmerID uint) (int64, error)
 	WithTx(tx *gorm.DB) ProductRepository
@@ -36,6 +39,18 @@ func (r *productRepository) Update(product *models.Product) error {
 	return r.db.Save(product).Error
 }
 
+// UpdateDetails writes only what a farmer edits on the product form, so the
+// reserved quantity and harvest date kept by orders and reschedules are never
+// overwritten with stale values.
+func (r *productRepository) UpdateDetails(product *models.Product) error {
+	return r.db.Model(product).Select(
+		"name", "description", "price", "stock", "category", "image_url",
+		"is_pre_order", "harvest_date", "harvest_quantity", "pre_order_deposit_percent",
+		"is_subscription", "subscription_period", "subscription_price_weekly",
+		"subscription_price_monthly", "subscription_min_periods",
+	).Updates(product).Error
+}
+
 func (r *productRepository) Delete(id uint) error {
 	return r.db.Delete(&models.Product{}, id).Error
 }
@@ -72,6 +87,14 @@ func (r *productRepository) FindByID(id uint) (models.Product, error) {
 	return product, err
 }
 
+// FindByIDForUpdate locks the product row (SELECT ... FOR UPDATE) until the
+// surrounding transaction ends, so concurrent stock changes are serialized.
+func (r *productRepository) FindByIDForUpdate(id uint) (models.Product, error) {
+	var product models.Product
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, id).Error
+	return product, err
+}
+
 func (r *productRepository) FindByFarmerID(farmerID uint, limit int, offset int) ([]models.Product, error) {
 	var products []models.Product
 	err := r.db.Preload("Farmer").Where("farmer_id = ?", farmerID).Limit(limit).Offset(offset).Find(&products).Error
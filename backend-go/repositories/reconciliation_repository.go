@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"smartfarm-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReconciliationRepository interface {
+	Save(entry *models.PaymentReconciliation) error
+	FindByDate(date string) ([]models.PaymentReconciliation, error)
+}
+
+type reconciliationRepository struct {
+	db *gorm.DB
+}
+
+func NewReconciliationRepository(db *gorm.DB) ReconciliationRepository {
+	return &reconciliationRepository{db}
+}
+
+// Save inserts the entry or replaces the payment's entry for the same day.
+func (r *reconciliationRepository) Save(entry *models.PaymentReconciliation) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "report_date"}, {Name: "payment_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "local_status", "gateway_status", "outcome", "note"}),
+	}).Create(entry).Error
+}
+
+func (r *reconciliationRepository) FindByDate(date string) ([]models.PaymentReconciliation, error) {
+	var entries []models.PaymentReconciliation
+	err := r.db.Where("report_date = ?", date).Order("outcome asc, payment_id asc").Find(&entries).Error
+	return entries, err
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"smartfarm-api/models"
+
+	"gorm.io/gorm"
+)
+
+type RefundRepository interface {
+	Create(refund *models.Refund) error
+	Update(refund *models.Refund) error
+	FindByOrderID(orderID uint) ([]models.Refund, error)
+	FindByIdempotencyKey(orderID uint, key string) ([]models.Refund, error)
+	WithTx(tx *gorm.DB) RefundRepository
+}
+
+type refundRepository struct {
+	db *gorm.DB
+}
+
+func NewRefundRepository(db *gorm.DB) RefundRepository {
+	return &refundRepository{db}
+}
+
+// Create inserts the refund together with its items.
+func (r *refundRepository) Create(refund *models.Refund) error {
+	return r.db.Create(refund).Error
+}
+
+// Update saves the refund's own columns; its items never change.
+func (r *refundRepository) Update(refund *models.Refund) error {
+	return r.db.Omit("Items").Save(refund).Error
+}
+
+func (r *refundRepository) FindByOrderID(orderID uint) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := r.db.Preload("Items").Where("order_id = ?", orderID).Order("created_at asc, id asc").Find(&refunds).Error
+	return refunds, err
+}
+
+// FindByIdempotencyKey returns the refunds of the order made for one request.
+func (r *refundRepository) FindByIdempotencyKey(orderID uint, key string) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := r.db.Preload("Items").Where("order_id = ? AND idempotency_key = ?", orderID, key).Order("id asc").Find(&refunds).Error
+	return refunds, err
+}
+
+func (r *refundRepository) WithTx(tx *gorm.DB) RefundRepository {
+	return &refundRepository{db: tx}
+}
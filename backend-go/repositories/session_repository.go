@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"smartfarm-api/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionRepository interface {
+	Create(session *models.Session) error
+	Update(session *models.Session) error
+	FindByID(id uint) (models.Session, error)
+	FindByIDForUpdate(id uint) (models.Session, error)
+	FindActiveByUserID(userID uint, now time.Time) ([]models.Session, error)
+	CreateRefreshToken(token *models.RefreshToken) error
+	FindRefreshToken(tokenHash string) (models.RefreshToken, error)
+	FindRefreshTokenForUpdate(tokenHash string) (models.RefreshToken, error)
+	MarkRefreshTokenUsed(id uint, at time.Time) error
+	RevokeToken(jti string, expiresAt time.Time) error
+	IsTokenRevoked(jti string) (bool, error)
+	PurgeRevokedTokens(before time.Time) error
+	WithTx(tx *gorm.DB) SessionRepository
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db}
+}
+
+func (r *sessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *sessionRepository) Update(session *models.Session) error {
+	return r.db.Save(session).Error
+}
+
+func (r *sessionRepository) FindByID(id uint) (models.Session, error) {
+	var session models.Session
+	err := r.db.First(&session, id).Error
+	return session, err
+}
+
+func (r *sessionRepository) FindByIDForUpdate(id uint) (models.Session, error) {
+	var session models.Session
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, id).Error
+	return session, err
+}
+
+// FindActiveByUserID returns the user's sessions that are neither logged out
+// nor expired, most recently used first.
+func (r *sessionRepository) FindActiveByUserID(userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *sessionRepository) FindRefreshToken(tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	return token, err
+}
+
+// FindRefreshTokenForUpdate locks the token so two refreshes with it cannot
+// both succeed.
+func (r *sessionRepository) FindRefreshTokenForUpdate(tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", tokenHash).First(&token).Error
+	return token, err
+}
+
+func (r *sessionRepository) MarkRefreshTokenUsed(id uint, at time.Time) error {
+	return r.db.Model(&models.RefreshToken{}).Where("id = ?", id).Update("used_at", at).Error
+}
+
+// RevokeToken adds the access token to the revocation list; revoking it twice
+// is harmless.
+func (r *sessionRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+func (r *sessionRepository) IsTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// PurgeRevokedTokens forgets revoked tokens that have expired on their own.
+func (r *sessionRepository) PurgeRevokedTokens(before time.Time) error {
+	return r.db.Where("expires_at < ?", before).Delete(&models.RevokedToken{}).Error
+}
+
+func (r *sessionRepository) WithTx(tx *gorm.DB) SessionRepository {
+	return &sessionRepository{db: tx}
+}
@@ -1,12 +1,23 @@
 package repositories
 
 import (
+	"errors"
 	"smartfarm-api/config"
 	"smartfarm-api/models"
+	"time"
+
+	"gorm.io/gorm"
 )
 
+// errEmailTaken is what a write hitting the unique email index returns.
+var errEmailTaken = errors.New("email sudah terdaftar")
+
 func CreateUser(user *models.User) error {
-	return config.DB.Create(user).Error
+	err := config.DB.Create(user).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errEmailTaken
+	}
+	return err
 }
 
 func FindUserByEmail(email string) (*models.User, error) {
@@ -24,3 +35,74 @@ func FindUserByID(id uint) (*models.User, error) {
 func UpdateUser(user *models.User) error {
 	return config.DB.Save(user).Error
 }
+
+// FindUsersByRole lists users of the role, only those with the verification
+// status when it is set, newest first.
+func FindUsersByRole(role string, status string) ([]models.User, error) {
+	var users []models.User
+	query := config.DB.Where("role = ?", role)
+	if status != "" {
+		query = query.Where("verification_status = ?", status)
+	}
+	err := query.Order("created_at desc").Find(&users).Error
+	return users, err
+}
+
+// SetFarmerVerification records an admin's decision on a farmer awaiting
+// verification and reports whether there was one to decide on.
+func SetFarmerVerification(farmerID uint, status string, adminID uint, at time.Time, reason string) (bool, error) {
+	result := config.DB.Model(&models.User{}).
+		Where("id = ? AND role = ? AND verification_status = ?", farmerID, "petani", "pending").
+		Updates(map[string]interface{}{
+			"verification_status": status,
+			"verified_by":         adminID,
+			"verified_at":         at,
+			"reject_reason":       reason,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// VerifyUserEmail marks the user's email as confirmed, as long as it is still
+// the address the link was sent to.
+func VerifyUserEmail(userID uint, email string) (bool, error) {
+	result := config.DB.Model(&models.User{}).
+		Where("id = ? AND email = ?", userID, email).
+		Update("email_status", "verified")
+	return result.RowsAffected > 0, result.Error
+}
+
+func UpdateUserName(userID uint, name string) error {
+	return config.DB.Model(&models.User{}).Where("id = ?", userID).Update("name", name).Error
+}
+
+func UpdateUserPassword(userID uint, hashedPassword string) error {
+	return config.DB.Model(&models.User{}).Where("id = ?", userID).Update("password", hashedPassword).Error
+}
+
+// ChangeUserEmailWithToken spends the email change token and moves the user
+// to the new address in one transaction, so a write refused by the unique
+// email index leaves the link unspent. It reports false when the token was
+// already used or has expired.
+func ChangeUserEmailWithToken(jti string, at time.Time, userID uint, email string) (bool, error) {
+	used := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ActionToken{}).
+			Where("jti = ? AND used_at IS NULL AND expires_at > ?", jti, at).
+			Update("used_at", at)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"email": email, "email_status": "verified"}).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+		used = true
+		return nil
+	})
+	return used, err
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"smartfarm-api/controllers"
 	"smartfarm-api/middleware"
+	"smartfarm-api/policies"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -24,9 +25,15 @@ func SetupRoutes() *gin.Engine {
 	// Public Routes
 	r.POST("/signup", controllers.Register)
 	r.POST("/signin", controllers.Login)
-	r.POST("/logout", controllers.Logout)
-	r.GET("/products", controllers.GetAllProducts)
-	r.GET("/products/:id", controllers.GetProductByID)
+	r.POST("/logout", middleware.OptionalAuthMiddleware(), controllers.Logout)
+	r.POST("/auth/logout", middleware.OptionalAuthMiddleware(), controllers.Logout)
+	r.POST("/auth/refresh", controllers.RefreshToken)
+	r.POST("/auth/verify", controllers.VerifyEmail)
+	r.POST("/auth/forgot-password", controllers.ForgotPassword)
+	r.POST("/auth/reset-password", controllers.ResetPassword)
+	r.POST("/auth/confirm-email", controllers.ConfirmEmailChange)
+	r.GET("/products", middleware.OptionalAuthMiddleware(), controllers.GetAllProducts)
+	r.GET("/products/:id", middleware.OptionalAuthMiddleware(), controllers.GetProductByID)
 	r.POST("/payments/webhook", controllers.PaymentWebhook)
 
 	// Static for images
@@ -35,9 +42,25 @@ func SetupRoutes() *gin.Engine {
 	// Protected Routes
 	protected := r.Group("/")
 	protected.Use(middleware.AuthMiddleware())
+
+	// Permission matrix: every protected route sits in the group of the roles
+	// allowed to call it. Ownership (my order, my product) is checked by the
+	// services through the policies package.
+	admins := protected.Group("/", middleware.RequireRole(policies.RoleAdmin))
+	farmers := protected.Group("/", middleware.RequireRole(policies.RoleFarmer))
+	buyers := protected.Group("/", middleware.RequireRole(policies.RoleBuyer))
+	farmersAndAdmins := protected.Group("/", middleware.RequireRole(policies.RoleFarmer, policies.RoleAdmin))
+	buyersAndAdmins := protected.Group("/", middleware.RequireRole(policies.RoleBuyer, policies.RoleAdmin))
 	{
 		protected.GET("/me", controllers.Me)
 		protected.PUT("/me", controllers.UpdateProfile)
+		protected.PUT("/me/password", controllers.ChangePassword)
+
+		// Session Routes
+		protected.POST("/auth/logout-all", controllers.LogoutAll)
+		protected.GET("/auth/sessions", controllers.GetMySessions)
+		protected.DELETE("/auth/sessions/:id", controllers.EndMySession)
+		protected.POST("/auth/verify/resend", controllers.ResendVerification)
 
 		// Address Routes
 		protected.POST("/addresses", controllers.CreateAddress)
@@ -47,28 +70,75 @@ func SetupRoutes() *gin.Engine {
 		protected.POST("/addresses/:id/default", controllers.SetDefaultAddress)
 
 		// Product Routes
-		protected.POST("/products", controllers.CreateProduct)
-		protected.GET("/farmer/products", controllers.GetFarmerProducts)
-		protected.PUT("/products/:id", controllers.UpdateProduct)
-		protected.DELETE("/products/:id", controllers.DeleteProduct)
+		farmers.POST("/products", middleware.RequireVerifiedEmail(), controllers.CreateProduct)
+		farmers.GET("/farmer/products", controllers.GetFarmerProducts)
+		farmers.PUT("/products/:id", controllers.UpdateProduct)
+		farmers.DELETE("/products/:id", controllers.DeleteProduct)
+		farmers.PUT("/products/:id/harvest-date", controllers.RescheduleHarvest)
+
+		// Cart Routes
+		buyers.GET("/cart", controllers.GetCart)
+		buyers.POST("/cart/items", controllers.AddCartItem)
+		buyers.PUT("/cart/items/:product_id", controllers.UpdateCartItem)
+		buyers.DELETE("/cart/items/:product_id", controllers.RemoveCartItem)
+		buyers.DELETE("/cart", controllers.ClearCart)
+		buyers.POST("/cart/checkout", middleware.RequireVerifiedEmail(), controllers.CheckoutCart)
 
 		// Order Routes
-		protected.POST("/orders", controllers.CreateOrder)
+		buyers.POST("/orders", middleware.RequireVerifiedEmail(), controllers.CreateOrder)
 		protected.GET("/orders", controllers.GetMyOrders)
+		farmersAndAdmins.PUT("/orders/:id/ship", controllers.ShipOrder)
+		buyersAndAdmins.PUT("/orders/:id/complete", controllers.CompleteOrder)
+		protected.PUT("/orders/:id/cancel", controllers.CancelOrder)
+		farmersAndAdmins.POST("/orders/:id/refund", controllers.RefundOrder)
+		buyers.POST("/orders/:id/payment-proof", controllers.UploadPaymentProof)
 
 		// Subscription Routes
-		protected.POST("/subscriptions", controllers.CreateSubscription)
-		protected.GET("/subscriptions", controllers.GetMySubscriptions)
+		buyers.POST("/subscriptions", middleware.RequireVerifiedEmail(), controllers.CreateSubscription)
+		buyers.GET("/subscriptions", controllers.GetMySubscriptions)
+		buyers.GET("/subscriptions/:id/schedule", controllers.GetSubscriptionSchedule)
+		buyers.POST("/subscriptions/:id/pause", controllers.PauseSubscription)
+		buyers.POST("/subscriptions/:id/resume", controllers.ResumeSubscription)
+		buyers.POST("/subscriptions/:id/skip", controllers.SkipSubscriptionDelivery)
+		buyers.POST("/subscriptions/:id/cancel", controllers.CancelSubscription)
+
+		// Notification Routes
+		protected.GET("/notifications", controllers.GetMyNotifications)
+		protected.POST("/notifications/:id/read", controllers.MarkNotificationRead)
 
 		// Analytics Routes
 		protected.GET("/analytics/trending", controllers.GetTrendingProducts)
-		protected.GET("/analytics/farmer", controllers.GetFarmerDashboard)
+		farmers.GET("/analytics/farmer", controllers.GetFarmerDashboard)
+
+		// Farmer Ledger Routes
+		farmers.GET("/farmer/balance", controllers.GetFarmerBalance)
+		farmers.GET("/farmer/statements", controllers.GetFarmerStatement)
+
+		// Fee Routes
+		protected.GET("/fee-schedules/active", controllers.GetActiveFeeSchedule)
 
 		// Payment Routes
-		protected.POST("/payments", controllers.CreatePayment)
-		protected.POST("/payments/mock-success", controllers.MockPaymentSuccess)
+		buyers.POST("/payments", controllers.CreatePayment)
+		buyers.POST("/payments/mock-success", controllers.MockPaymentSuccess)
 		protected.GET("/payments/orders/:order_id", controllers.GetPaymentStatus)
 
+		// Bank Transfer Review Routes
+		farmersAndAdmins.GET("/payment-proofs", controllers.GetPaymentProofQueue)
+		protected.GET("/payment-proofs/:id/file", controllers.GetPaymentProofFile)
+		farmersAndAdmins.POST("/payment-proofs/:id/approve", controllers.ApprovePaymentProof)
+		farmersAndAdmins.POST("/payment-proofs/:id/reject", controllers.RejectPaymentProof)
+
+		// Admin Routes
+		admins.GET("/admin/reconciliation", controllers.GetReconciliationReport)
+		admins.POST("/admin/payouts", controllers.RunPayoutBatch)
+		admins.GET("/admin/payouts", controllers.GetPayoutBatches)
+		admins.GET("/admin/fee-schedules", controllers.GetFeeSchedules)
+		admins.POST("/admin/fee-schedules", controllers.CreateFeeSchedule)
+		admins.POST("/admin/users", controllers.CreateUser)
+		admins.GET("/admin/farmers", controllers.GetFarmers)
+		admins.POST("/admin/farmers/:id/approve", controllers.ApproveFarmer)
+		admins.POST("/admin/farmers/:id/reject", controllers.RejectFarmer)
+
 	}
 
 	// Log all routes
@@ -0,0 +1,59 @@
+package seeders
+
+import (
+	"log"
+	"smartfarm-api/models"
+
+	"gorm.io/gorm"
+)
+
+// BackfillFulfillments membuat fulfillment per petani untuk order lama yang
+// dibuat sebelum order dipecah per petani
+func BackfillFulfillments(db *gorm.DB) {
+	log.Println("📦 Membuat fulfillment untuk order lama...")
+
+	var orders []models.Order
+	err := db.Preload("OrderItems.Product").
+		Where("NOT EXISTS (SELECT 1 FROM order_fulfillments f WHERE f.order_id = orders.id)").
+		Find(&orders).Error
+	if err != nil {
+		log.Printf("❌ Gagal mengambil order: %v", err)
+		return
+	}
+
+	created := 0
+	for _, order := range orders {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			fulfillments := map[uint]*models.OrderFulfillment{}
+			var farmerIDs []uint
+			for _, item := range order.OrderItems {
+				f, ok := fulfillments[item.Product.FarmerID]
+				if !ok {
+					f = &models.OrderFulfillment{OrderID: order.ID, FarmerID: item.Product.FarmerID, Status: order.Status}
+					fulfillments[item.Product.FarmerID] = f
+					farmerIDs = append(farmerIDs, item.Product.FarmerID)
+				}
+				f.SubTotal += item.Price * float64(item.Quantity)
+			}
+
+			for _, farmerID := range farmerIDs {
+				f := fulfillments[farmerID]
+				if err := tx.Create(f).Error; err != nil {
+					return err
+				}
+				if err := tx.Table("order_items").
+					Where("order_id = ? AND product_id IN (SELECT id FROM products WHERE farmer_id = ?)", order.ID, farmerID).
+					Update("fulfillment_id", f.ID).Error; err != nil {
+					return err
+				}
+				created++
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("❌ Gagal backfill order %d: %v", order.ID, err)
+		}
+	}
+
+	log.Printf("✅ Berhasil membuat %d fulfillment untuk %d order", created, len(orders))
+}
@@ -0,0 +1,24 @@
+package seeders
+
+import (
+	"log"
+	"smartfarm-api/models"
+
+	"gorm.io/gorm"
+)
+
+// BackfillPaymentChannels menandai transfer bank (TRF-...) yang dicatat
+// sebelum payment punya channel sebagai manual
+func BackfillPaymentChannels(db *gorm.DB) {
+	log.Println("🏦 Menandai transfer bank lama sebagai manual...")
+
+	result := db.Model(&models.Payment{}).
+		Where("transaction_id LIKE ? AND channel = ?", "TRF-%", "gateway").
+		Update("channel", "manual")
+	if result.Error != nil {
+		log.Printf("❌ Gagal backfill channel payment: %v", result.Error)
+		return
+	}
+
+	log.Printf("✅ Berhasil menandai %d payment sebagai manual", result.RowsAffected)
+}
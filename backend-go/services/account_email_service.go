@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"smartfarm-api/auth"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errInvalidActionToken = errors.New("invalid or expired token")
+
+// emailVerificationTTL is how long a verification link works
+// (EMAIL_VERIFICATION_TTL, default 24h).
+func emailVerificationTTL() time.Duration {
+	return durationFromEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+}
+
+// passwordResetTTL is how long a password reset link works
+// (PASSWORD_RESET_TTL, default 1h).
+func passwordResetTTL() time.Duration {
+	return durationFromEnv("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// appURL is where the links in emails point (APP_URL, default the Vite dev
+// server).
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "http://localhost:5173"
+}
+
+// SendEmailVerification mails the user a link to confirm their address. Links
+// mailed earlier stop working.
+func SendEmailVerification(user models.User) error {
+	link, err := issueActionLink(user, auth.PurposeVerifyEmail, user.Email, emailVerificationTTL(), "/verify-email")
+	if err != nil {
+		return err
+	}
+	return sendMail(MailMessage{
+		To:      user.Email,
+		Subject: "Confirm your SmartFarm email",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link works once and expires in %v.\n",
+			user.Name, link, emailVerificationTTL()),
+	})
+}
+
+// ResendEmailVerification sends a fresh verification link to a signed-in user.
+func ResendEmailVerification(userID uint) error {
+	user, err := repositories.FindUserByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if user.EmailStatus == "verified" {
+		return errors.New("email is already verified")
+	}
+	return SendEmailVerification(*user)
+}
+
+// VerifyEmail confirms the address a verification link was sent to.
+func VerifyEmail(token string) error {
+	claims, err := auth.ParseActionToken(token, auth.PurposeVerifyEmail)
+	if err != nil {
+		return errInvalidActionToken
+	}
+	if err := useActionToken(claims.ID); err != nil {
+		return err
+	}
+
+	verified, err := repositories.VerifyUserEmail(claims.UserID, claims.Email)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		// The user changed their email since the link was sent
+		return errInvalidActionToken
+	}
+	return nil
+}
+
+// RequestPasswordReset mails a reset link when the email belongs to an
+// account. It says nothing about whether it does, so the endpoint cannot be
+// used to find out who has an account.
+func RequestPasswordReset(email string) {
+	user, err := repositories.FindUserByEmail(email)
+	if err != nil || user.ID == 0 {
+		return
+	}
+
+	link, err := issueActionLink(*user, auth.PurposeResetPassword, user.Email, passwordResetTTL(), "/reset-password")
+	if err == nil {
+		err = sendMail(MailMessage{
+			To:      user.Email,
+			Subject: "Reset your SmartFarm password",
+			Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your SmartFarm account. If it was you, choose a new password here:\n\n%s\n\nThe link works once and expires in %v. If it was not you, ignore this email.\n",
+				user.Name, link, passwordResetTTL()),
+		})
+	}
+	if err != nil {
+		log.Printf("[Auth] Failed to send password reset email to user %d: %v", user.ID, err)
+	}
+}
+
+// ResetPassword sets a new password with a reset link and logs the account
+// out everywhere. Opening the link proves the email too, so it is verified.
+func ResetPassword(token string, newPassword string) error {
+	claims, err := auth.ParseActionToken(token, auth.PurposeResetPassword)
+	if err != nil {
+		return errInvalidActionToken
+	}
+	user, err := repositories.FindUserByID(claims.UserID)
+	if err != nil || user.Email != claims.Email {
+		return errInvalidActionToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := useActionToken(claims.ID); err != nil {
+		return err
+	}
+	if err := repositories.UpdateUserPassword(user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+	if _, err := repositories.VerifyUserEmail(user.ID, user.Email); err != nil {
+		log.Printf("[Auth] Failed to verify email of user %d after reset: %v", user.ID, err)
+	}
+
+	ended, err := EndAllSessions(user.ID, 0)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Auth] Password of user %d reset, %d sessions ended", user.ID, ended)
+	return nil
+}
+
+// RequestEmailChange mails a confirmation link to the new address, and a
+// heads-up to the current one.
+func RequestEmailChange(user models.User, newEmail string) error {
+	link, err := issueActionLink(user, auth.PurposeChangeEmail, newEmail, emailVerificationTTL(), "/confirm-email")
+	if err != nil {
+		return err
+	}
+	if err := sendMail(MailMessage{
+		To:      newEmail,
+		Subject: "Confirm your new SmartFarm email",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm that your SmartFarm account should use this email address by opening this link:\n\n%s\n\nThe link works once and expires in %v.\n",
+			user.Name, link, emailVerificationTTL()),
+	}); err != nil {
+		return err
+	}
+
+	if err := sendMail(MailMessage{
+		To:      user.Email,
+		Subject: "Your SmartFarm email is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to move your SmartFarm account to %s. It changes once that address is confirmed. If it was not you, change your password.\n",
+			user.Name, newEmail),
+	}); err != nil {
+		log.Printf("[Auth] Failed to notify user %d of an email change: %v", user.ID, err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange moves the account to the address the link was sent to.
+func ConfirmEmailChange(token string) error {
+	claims, err := auth.ParseActionToken(token, auth.PurposeChangeEmail)
+	if err != nil {
+		return errInvalidActionToken
+	}
+
+	// Someone may have signed up with the address since the link was sent;
+	// the link is only spent once the change goes ahead
+	existing, _ := repositories.FindUserByEmail(claims.Email)
+	if existing.ID != 0 && existing.ID != claims.UserID {
+		return errors.New("email sudah terdaftar")
+	}
+
+	changed, err := repositories.ChangeUserEmailWithToken(claims.ID, time.Now(), claims.UserID, claims.Email)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return errInvalidActionToken
+	}
+	return nil
+}
+
+// IsEmailVerified reports whether the user has confirmed their email.
+func IsEmailVerified(userID uint) (bool, error) {
+	user, err := repositories.FindUserByID(userID)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailStatus == "verified", nil
+}
+
+// issueActionLink records a new single-use token for the purpose, spending
+// the ones sent before, and returns the app link carrying it.
+func issueActionLink(user models.User, purpose string, email string, ttl time.Duration, path string) (string, error) {
+	token, claims, err := auth.GenerateActionToken(user.ID, purpose, email, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := repositories.DiscardActionTokens(user.ID, purpose, now); err != nil {
+		return "", err
+	}
+	if err := repositories.CreateActionToken(&models.ActionToken{
+		JTI:       claims.ID,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}); err != nil {
+		return "", err
+	}
+	return appURL() + path + "?token=" + url.QueryEscape(token), nil
+}
+
+func useActionToken(jti string) error {
+	used, err := repositories.UseActionToken(jti, time.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errInvalidActionToken
+	}
+	return nil
+}
+
+func sendMail(msg MailMessage) error {
+	if mailSender == nil {
+		return errors.New("mail sender is not initialised")
+	}
+	return mailSender.Send(msg)
+}
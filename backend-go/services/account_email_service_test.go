@@ -0,0 +1,114 @@
+package services
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// lastMailedToken reads the token from the newest link written to the spool.
+func lastMailedToken(t *testing.T, dir string) string {
+	files, err := os.ReadDir(dir)
+	if !assert.NoError(t, err) || !assert.NotEmpty(t, files) {
+		t.FailNow()
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, files[len(files)-1].Name()))
+	m := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(string(raw))
+	if !assert.Len(t, m, 2) {
+		t.FailNow()
+	}
+	token, _ := url.QueryUnescape(m[1])
+	return token
+}
+
+func TestChangePassword_AndEmailChange(t *testing.T) {
+	db := config.DB
+	if db == nil {
+		t.Skip("Database not available for testing")
+	}
+	sessionRepo = repositories.NewSessionRepository(db)
+	mailSender = &FileMailSender{Dir: t.TempDir()}
+	spool := mailSender.(*FileMailSender).Dir
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("old-secret"), bcrypt.MinCost)
+	stamp := time.Now().Format("150405.000")
+	user := models.User{Name: "Test Account User", Email: "testaccount" + stamp + "@race.com", Password: string(hashed), Role: "pembeli"}
+	db.Create(&user)
+
+	phone, _ := StartSession(user, "phone", "127.0.0.1")
+	laptop, _ := StartSession(user, "laptop", "127.0.0.1")
+
+	_, err := ChangePassword(user.ID, phone.SessionID, dto.ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "new-secret"})
+	assert.EqualError(t, err, "invalid current password")
+
+	ended, err := ChangePassword(user.ID, phone.SessionID, dto.ChangePasswordRequest{CurrentPassword: "old-secret", NewPassword: "new-secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ended)
+	_, err = RefreshSession(laptop.RefreshToken, "laptop", "127.0.0.1")
+	assert.EqualError(t, err, "invalid refresh token")
+
+	// The email only changes once the new address confirms it, and only once
+	newEmail := "testaccount-new" + stamp + "@race.com"
+	pending, err := UpdateUserProfile(user.ID, dto.UpdateProfileRequest{Name: "Renamed", Email: newEmail})
+	assert.NoError(t, err)
+	assert.Equal(t, newEmail, pending)
+
+	saved, _ := repositories.FindUserByID(user.ID)
+	assert.Equal(t, user.Email, saved.Email)
+	assert.Equal(t, "Renamed", saved.Name)
+
+	// A link to the new address and a notice without one to the old address
+	files, _ := os.ReadDir(spool)
+	assert.Len(t, files, 2)
+	token := ""
+	for _, f := range files {
+		raw, _ := os.ReadFile(filepath.Join(spool, f.Name()))
+		if m := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(string(raw)); m != nil {
+			token, _ = url.QueryUnescape(m[1])
+		}
+	}
+	assert.NotEmpty(t, token)
+
+	assert.NoError(t, ConfirmEmailChange(token))
+	assert.EqualError(t, ConfirmEmailChange(token), "invalid or expired token")
+	saved, _ = repositories.FindUserByID(user.ID)
+	assert.Equal(t, newEmail, saved.Email)
+
+	// Taking someone else's address is refused up front
+	other := models.User{Name: "Other", Email: "testaccount-other" + stamp + "@race.com", Password: "hashed", Role: "pembeli"}
+	db.Create(&other)
+	_, err = UpdateUserProfile(user.ID, dto.UpdateProfileRequest{Name: "Renamed", Email: other.Email})
+	assert.EqualError(t, err, "email sudah terdaftar")
+}
+
+func TestResetPassword_SingleUse(t *testing.T) {
+	db := config.DB
+	if db == nil {
+		t.Skip("Database not available for testing")
+	}
+	sessionRepo = repositories.NewSessionRepository(db)
+	mailSender = &FileMailSender{Dir: t.TempDir()}
+
+	user := models.User{Name: "Test Reset User", Email: "testreset" + time.Now().Format("150405.000") + "@race.com", Password: "hashed", Role: "pembeli", EmailStatus: "unverified"}
+	db.Create(&user)
+
+	RequestPasswordReset(user.Email)
+	token := lastMailedToken(t, mailSender.(*FileMailSender).Dir)
+
+	assert.NoError(t, ResetPassword(token, "brand-new"))
+	assert.EqualError(t, ResetPassword(token, "again-new"), "invalid or expired token")
+
+	saved, _ := repositories.FindUserByID(user.ID)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(saved.Password), []byte("brand-new")))
+	assert.Equal(t, "verified", saved.EmailStatus)
+}
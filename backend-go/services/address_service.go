@@ -4,6 +4,7 @@ import (
 	"errors"
 	"smartfarm-api/dto"
 	"smartfarm-api/models"
+	"smartfarm-api/policies"
 	"smartfarm-api/repositories"
 )
 
@@ -38,8 +39,8 @@ func UpdateAddressService(userID uint, addressID uint, req dto.UpdateAddressRequ
 		return nil, errors.New("address not found")
 	}
 
-	if address.UserID != userID {
-		return nil, errors.New("unauthorized")
+	if !policies.OwnsAddress(userID, *address) {
+		return nil, policies.ErrForbidden
 	}
 
 	// Update fields
@@ -66,8 +67,8 @@ func DeleteAddressService(userID uint, addressID uint) error {
 		return errors.New("address not found")
 	}
 
-	if address.UserID != userID {
-		return errors.New("unauthorized")
+	if !policies.OwnsAddress(userID, *address) {
+		return policies.ErrForbidden
 	}
 
 	return repositories.DeleteAddress(addressID)
@@ -80,8 +81,8 @@ func SetDefaultAddressService(userID uint, addressID uint) error {
 		return errors.New("address not found")
 	}
 
-	if address.UserID != userID {
-		return errors.New("unauthorized")
+	if !policies.OwnsAddress(userID, *address) {
+		return policies.ErrForbidden
 	}
 
 	return repositories.SetDefaultAddress(userID, addressID)
@@ -69,27 +69,29 @@ func (s *analyticsService) GetFarmerDashboardData(farmerID uint) (dto.FarmerDash
 		return dto.FarmerDashboardResponse{}, err
 	}
 
-	recentOrders, err := s.repo.GetFarmerRecentOrders(farmerID, 5)
+	recentFulfillments, err := s.repo.GetFarmerRecentFulfillments(farmerID, 5)
 	if err != nil {
 		return dto.FarmerDashboardResponse{}, err
 	}
 
 	var recentOrdersResponse []dto.FarmerRecentOrder
-	for _, o := range recentOrders {
-		// Find the product that belongs to this farmer in the order
-		for _, item := range o.OrderItems {
-			if item.Product.FarmerID == farmerID {
-				recentOrdersResponse = append(recentOrdersResponse, dto.FarmerRecentOrder{
-					ID:          o.ID,
-					ProductName: item.Product.Name,
-					Category:    item.Product.Category,
-					Price:       item.Price,
-					Status:      o.Status,
-					ImageURL:    item.Product.ImageURL,
-				})
-				break // Only show one product per order for simplicity in "Recent Orders"
-			}
+	for _, f := range recentFulfillments {
+		if len(f.Items) == 0 {
+			continue
 		}
+		// The first item represents the order in the list; ItemCount and SubTotal cover the rest
+		item := f.Items[0]
+		recentOrdersResponse = append(recentOrdersResponse, dto.FarmerRecentOrder{
+			ID:            f.OrderID,
+			FulfillmentID: f.ID,
+			ProductName:   item.Product.Name,
+			Category:      item.Product.Category,
+			Price:         item.Price,
+			ItemCount:     len(f.Items),
+			SubTotal:      f.SubTotal,
+			Status:        f.Status,
+			ImageURL:      item.Product.ImageURL,
+		})
 	}
 
 	return dto.FarmerDashboardResponse{
@@ -2,26 +2,55 @@ package services
 
 import (
 	"errors"
+	"log"
+	"strings"
+	"time"
 
+	"smartfarm-api/auth"
 	"smartfarm-api/dto"
 	"smartfarm-api/models"
 	"smartfarm-api/repositories"
-	"smartfarm-api/utils"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// signupRoles are the roles anyone may pick for themselves; admins are made
+// by the create-admin command or by another admin.
+var signupRoles = map[string]bool{"pembeli": true, "petani": true}
+
 func RegisterUser(req dto.RegisterRequest) (*models.User, error) {
+	if !signupRoles[req.Role] {
+		return nil, errors.New("invalid role: sign up as pembeli or petani")
+	}
+
+	// petani baru menunggu verifikasi admin sebelum bisa berjualan
+	status := "verified"
+	if req.Role == "petani" {
+		status = "pending"
+	}
+	user, err := createUser(req.Name, req.Email, req.Password, req.Role, status, "unverified")
+	if err != nil {
+		return nil, err
+	}
+
+	// The account is made either way; a lost email can be sent again
+	if err := SendEmailVerification(*user); err != nil {
+		log.Printf("[Auth] Failed to send verification email to user %d: %v", user.ID, err)
+	}
+	return user, nil
+}
+
+func createUser(name string, email string, password string, role string, status string, emailStatus string) (*models.User, error) {
 
 	// cek email sudah ada
-	existingUser, _ := repositories.FindUserByEmail(req.Email)
+	existingUser, _ := repositories.FindUserByEmail(email)
 	if existingUser.ID != 0 {
 		return nil, errors.New("email sudah terdaftar")
 	}
 
 	// hash password (pengamanan password)
 	hashedPassword, err := bcrypt.GenerateFromPassword(
-		[]byte(req.Password),
+		[]byte(password),
 		bcrypt.DefaultCost,
 	)
 	if err != nil {
@@ -29,10 +58,12 @@ func RegisterUser(req dto.RegisterRequest) (*models.User, error) {
 	}
 
 	user := models.User{
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: string(hashedPassword),
-		Role:     req.Role,
+		Name:               name,
+		Email:              email,
+		Password:           string(hashedPassword),
+		Role:               role,
+		VerificationStatus: status,
+		EmailStatus:        emailStatus,
 	}
 
 	err = repositories.CreateUser(&user)
@@ -43,11 +74,12 @@ func RegisterUser(req dto.RegisterRequest) (*models.User, error) {
 	return &user, nil
 }
 
-func LoginUser(req dto.LoginRequest) (string, error) {
+// LoginUser checks the credentials; the caller starts the session.
+func LoginUser(req dto.LoginRequest) (*models.User, error) {
 
 	user, err := repositories.FindUserByEmail(req.Email)
 	if err != nil {
-		return "", errors.New("email tidak ditemukan")
+		return nil, errors.New("email tidak ditemukan")
 	}
 
 	// compare password (bandingkan hash)
@@ -56,30 +88,77 @@ func LoginUser(req dto.LoginRequest) (string, error) {
 		[]byte(req.Password),
 	)
 	if err != nil {
-		return "", errors.New("password salah")
+		return nil, errors.New("password salah")
 	}
 
-	// generate JWT
-	token, err := utils.GenerateToken(user.ID, user.Role)
-	if err != nil {
-		return "", err
-	}
-
-	return token, nil
+	return user, nil
 }
 
 func GetUserByID(id uint) (*models.User, error) {
 	return repositories.FindUserByID(id)
 }
 
-func UpdateUserProfile(id uint, req dto.UpdateProfileRequest) error {
+// UpdateUserProfile saves the name right away. A new email is only mailed a
+// confirmation link; the account keeps the old address until it is opened.
+// It returns the address waiting for confirmation, if any.
+func UpdateUserProfile(id uint, req dto.UpdateProfileRequest) (string, error) {
 	user, err := repositories.FindUserByID(id)
 	if err != nil {
-		return errors.New("user not found")
+		return "", errors.New("user not found")
+	}
+
+	// Addresses differing only in case or spacing are the same mailbox
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	changed := email != strings.ToLower(user.Email)
+	if changed {
+		existing, _ := repositories.FindUserByEmail(email)
+		if existing.ID != 0 && existing.ID != user.ID {
+			return "", errors.New("email sudah terdaftar")
+		}
+	}
+
+	// Only the name: a full save could write back a stale copy of fields
+	// changed meanwhile, such as a confirmed email or the verification status
+	if err := repositories.UpdateUserName(user.ID, req.Name); err != nil {
+		return "", err
+	}
+
+	if !changed {
+		return "", nil
+	}
+	if err := RequestEmailChange(*user, email); err != nil {
+		return "", err
+	}
+	return email, nil
+}
+
+// ChangePassword sets a new password after checking the current one, and
+// logs out every device but the one making the change. It returns how many
+// sessions were ended.
+func ChangePassword(userID uint, sessionID uint, req dto.ChangePasswordRequest) (int, error) {
+	user, err := repositories.FindUserByID(userID)
+	if err != nil {
+		return 0, errors.New("user not found")
 	}
 
-	user.Name = req.Name
-	user.Email = req.Email
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return 0, errors.New("invalid current password")
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return 0, errors.New("invalid new password: it must differ from the current one")
+	}
 
-	return repositories.UpdateUser(user)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+	if err := repositories.UpdateUserPassword(user.ID, string(hashedPassword)); err != nil {
+		return 0, err
+	}
+
+	// Reset links mailed before the change would undo it
+	if err := repositories.DiscardActionTokens(user.ID, auth.PurposeResetPassword, time.Now()); err != nil {
+		log.Printf("[Auth] Failed to discard reset links of user %d: %v", user.ID, err)
+	}
+	return EndAllSessions(user.ID, sessionID)
 }
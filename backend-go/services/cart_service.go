@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+
+	"gorm.io/gorm"
+)
+
+type CartService interface {
+	GetCart(userID uint) (dto.CartResponse, error)
+	AddItem(userID uint, req dto.AddCartItemRequest) (dto.CartResponse, error)
+	UpdateItem(userID uint, productID uint, req dto.UpdateCartItemRequest) (dto.CartResponse, error)
+	RemoveItem(userID uint, productID uint) (dto.CartResponse, error)
+	ClearCart(userID uint) error
+	Checkout(userID uint, req dto.CheckoutCartRequest) (dto.OrderResponse, error)
+}
+
+type cartService struct {
+	cartRepo    repositories.CartRepository
+	productRepo repositories.ProductRepository
+	orders      *orderService
+}
+
+func NewCartService(cartRepo repositories.CartRepository, orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, feeRepo repositories.FeeRepository) CartService {
+	return &cartService{
+		cartRepo:    cartRepo,
+		productRepo: productRepo,
+		orders:      &orderService{orderRepo: orderRepo, productRepo: productRepo, feeRepo: feeRepo},
+	}
+}
+
+func (s *cartService) GetCart(userID uint) (dto.CartResponse, error) {
+	cart, err := s.cartRepo.FindOrCreateByUserID(userID)
+	if err != nil {
+		return dto.CartResponse{}, err
+	}
+	return mapCartToResponse(cart), nil
+}
+
+func (s *cartService) AddItem(userID uint, req dto.AddCartItemRequest) (dto.CartResponse, error) {
+	product, err := s.productRepo.FindByID(req.ProductID)
+	if err != nil {
+		return dto.CartResponse{}, errors.New("product not found")
+	}
+
+	// The cart must exist before its row can be locked
+	if _, err := s.cartRepo.FindOrCreateByUserID(userID); err != nil {
+		return dto.CartResponse{}, err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		txCartRepo := s.cartRepo.WithTx(tx)
+
+		// Locked like Checkout, so two quick adds cannot both read the old quantity
+		cart, err := txCartRepo.FindByUserIDForUpdate(userID)
+		if err != nil {
+			return err
+		}
+
+		// Adding a product that is already in the cart increases its quantity
+		item, err := txCartRepo.FindItem(cart.ID, product.ID)
+		if err != nil {
+			item = models.CartItem{CartID: cart.ID, ProductID: product.ID}
+		}
+		item.Quantity += req.Quantity
+		item.PriceAtAdd = product.Price
+
+		if item.Quantity > availableQuantity(product) {
+			return errors.New("insufficient stock for " + product.Name)
+		}
+
+		return txCartRepo.SaveItem(&item)
+	})
+	if err != nil {
+		return dto.CartResponse{}, err
+	}
+
+	return s.GetCart(userID)
+}
+
+func (s *cartService) UpdateItem(userID uint, productID uint, req dto.UpdateCartItemRequest) (dto.CartResponse, error) {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txCartRepo := s.cartRepo.WithTx(tx)
+
+		cart, err := txCartRepo.FindByUserIDForUpdate(userID)
+		if err != nil {
+			return errors.New("item not in cart")
+		}
+
+		item, err := txCartRepo.FindItem(cart.ID, productID)
+		if err != nil {
+			return errors.New("item not in cart")
+		}
+
+		product, err := s.productRepo.FindByID(productID)
+		if err != nil {
+			return errors.New("product not found")
+		}
+
+		if req.Quantity > availableQuantity(product) {
+			return errors.New("insufficient stock for " + product.Name)
+		}
+
+		item.Quantity = req.Quantity
+		return txCartRepo.SaveItem(&item)
+	})
+	if err != nil {
+		return dto.CartResponse{}, err
+	}
+
+	return s.GetCart(userID)
+}
+
+func (s *cartService) RemoveItem(userID uint, productID uint) (dto.CartResponse, error) {
+	cart, err := s.cartRepo.FindOrCreateByUserID(userID)
+	if err != nil {
+		return dto.CartResponse{}, err
+	}
+
+	if err := s.cartRepo.DeleteItem(cart.ID, productID); err != nil {
+		return dto.CartResponse{}, err
+	}
+
+	return s.GetCart(userID)
+}
+
+func (s *cartService) ClearCart(userID uint) error {
+	cart, err := s.cartRepo.FindOrCreateByUserID(userID)
+	if err != nil {
+		return err
+	}
+	return s.cartRepo.ClearItems(cart.ID)
+}
+
+// Checkout turns the cart into an order through the same stock-locking
+// transaction as CreateOrder and empties the cart in that transaction.
+func (s *cartService) Checkout(userID uint, req dto.CheckoutCartRequest) (dto.OrderResponse, error) {
+	var createdOrder models.Order
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txCartRepo := s.cartRepo.WithTx(tx)
+
+		cart, err := txCartRepo.FindByUserIDForUpdate(userID)
+		if err != nil || len(cart.Items) == 0 {
+			return errors.New("cart is empty")
+		}
+
+		orderReq := dto.CreateOrderRequest{AddressID: req.AddressID}
+		for _, item := range cart.Items {
+			orderReq.Items = append(orderReq.Items, dto.OrderItemRequest{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+			})
+		}
+
+		createdOrder, err = s.orders.createOrderTx(tx, orderReq, userID, orderOptions{})
+		if err != nil {
+			return err
+		}
+
+		return txCartRepo.ClearItems(cart.ID)
+	})
+
+	if err != nil {
+		return dto.OrderResponse{}, err
+	}
+
+	log.Printf("[CART] User %d checked out cart into order %d", userID, createdOrder.ID)
+	return mapOrderToResponse(createdOrder), nil
+}
+
+// mapCartToResponse prices the cart with live product data and flags items
+// that can no longer be bought as they are.
+func mapCartToResponse(cart models.Cart) dto.CartResponse {
+	res := dto.CartResponse{ID: cart.ID, Items: []dto.CartItemResponse{}}
+
+	for _, item := range cart.Items {
+		p := item.Product
+		// Pre-orders are limited by what is left of the harvest, not by stock
+		available := availableQuantity(p)
+		itemRes := dto.CartItemResponse{
+			ProductID:   item.ProductID,
+			ProductName: p.Name,
+			ImageURL:    p.ImageURL,
+			Price:       p.Price,
+			PriceAtAdd:  item.PriceAtAdd,
+			Quantity:    item.Quantity,
+			SubTotal:    p.Price * float64(item.Quantity),
+			Stock:       available,
+		}
+
+		switch {
+		case p.ID == 0:
+			itemRes.Warning = "product is no longer available"
+		case available <= 0:
+			itemRes.Warning = "out of stock"
+		case available < item.Quantity:
+			itemRes.Warning = fmt.Sprintf("only %d left in stock", available)
+		case p.Price != item.PriceAtAdd:
+			itemRes.Warning = "price has changed since added to cart"
+		}
+
+		if itemRes.Warning != "" {
+			res.HasIssues = true
+		}
+		res.TotalPrice += itemRes.SubTotal
+		res.Items = append(res.Items, itemRes)
+	}
+
+	return res
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"smartfarm-api/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMapCartToResponse_Warnings checks live pricing and stock warnings
+func TestMapCartToResponse_Warnings(t *testing.T) {
+	cart := models.Cart{
+		ID: 1,
+		Items: []models.CartItem{
+			{ProductID: 1, Quantity: 2, PriceAtAdd: 1000, Product: models.Product{ID: 1, Name: "Bayam", Price: 1000, Stock: 10}},
+			{ProductID: 2, Quantity: 5, PriceAtAdd: 2000, Product: models.Product{ID: 2, Name: "Wortel", Price: 2000, Stock: 3}},
+			{ProductID: 3, Quantity: 1, PriceAtAdd: 3000, Product: models.Product{ID: 3, Name: "Tomat", Price: 3500, Stock: 8}},
+			{ProductID: 4, Quantity: 1, PriceAtAdd: 4000}, // Deleted product
+			// Pre-order reserved against its harvest, with nothing in stock yet
+			{ProductID: 5, Quantity: 4, PriceAtAdd: 5000, Product: models.Product{ID: 5, Name: "Cabai", Price: 5000, IsPreOrder: true, HarvestQuantity: 20, ReservedQuantity: 6}},
+			{ProductID: 6, Quantity: 3, PriceAtAdd: 6000, Product: models.Product{ID: 6, Name: "Jagung", Price: 6000, IsPreOrder: true, HarvestQuantity: 10, ReservedQuantity: 8}},
+		},
+	}
+
+	res := mapCartToResponse(cart)
+
+	assert.Len(t, res.Items, 6)
+	assert.Empty(t, res.Items[0].Warning)
+	assert.Equal(t, "only 3 left in stock", res.Items[1].Warning)
+	assert.Equal(t, "price has changed since added to cart", res.Items[2].Warning)
+	assert.Equal(t, "product is no longer available", res.Items[3].Warning)
+	assert.Empty(t, res.Items[4].Warning)
+	assert.Equal(t, 14, res.Items[4].Stock)
+	assert.Equal(t, "only 2 left in stock", res.Items[5].Warning)
+	assert.True(t, res.HasIssues)
+
+	// Totals use the current price, not the price at the time of adding
+	assert.Equal(t, float64(2*1000+5*2000+3500+4*5000+3*6000), res.TotalPrice)
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type FeeService interface {
+	CreateSchedule(adminID uint, req dto.CreateFeeScheduleRequest) (dto.FeeScheduleResponse, error)
+	GetSchedules() ([]dto.FeeScheduleResponse, error)
+	GetActiveSchedule() (dto.FeeScheduleResponse, error)
+}
+
+type feeService struct {
+	feeRepo repositories.FeeRepository
+}
+
+func NewFeeService(feeRepo repositories.FeeRepository) FeeService {
+	return &feeService{feeRepo}
+}
+
+// CreateSchedule publishes a new version of the fee rules. It replaces the
+// current one from EffectiveFrom on; orders already placed keep theirs.
+func (s *feeService) CreateSchedule(adminID uint, req dto.CreateFeeScheduleRequest) (dto.FeeScheduleResponse, error) {
+	effectiveFrom := time.Now()
+	if req.EffectiveFrom != "" {
+		t, err := time.Parse(time.RFC3339, req.EffectiveFrom)
+		if err != nil {
+			return dto.FeeScheduleResponse{}, errors.New("invalid fee schedule: effective_from must be RFC3339")
+		}
+		effectiveFrom = t
+	}
+
+	schedule := models.FeeSchedule{EffectiveFrom: effectiveFrom, CreatedBy: adminID, Note: req.Note}
+	for i, r := range req.Rules {
+		rule := models.FeeRule{
+			Type:          r.Type,
+			Category:      strings.TrimSpace(r.Category),
+			FarmerID:      r.FarmerID,
+			PaymentMethod: r.PaymentMethod,
+			Percent:       r.Percent,
+			FixedAmount:   r.FixedAmount,
+		}
+		if err := validateFeeRule(rule); err != nil {
+			return dto.FeeScheduleResponse{}, fmt.Errorf("invalid fee rule %d: %v", i+1, err)
+		}
+		schedule.Rules = append(schedule.Rules, rule)
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return s.feeRepo.WithTx(tx).CreateSchedule(&schedule)
+	})
+	if err != nil {
+		return dto.FeeScheduleResponse{}, err
+	}
+	return mapFeeScheduleToResponse(schedule), nil
+}
+
+func (s *feeService) GetSchedules() ([]dto.FeeScheduleResponse, error) {
+	schedules, err := s.feeRepo.FindSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	res := []dto.FeeScheduleResponse{}
+	for _, schedule := range schedules {
+		res = append(res, mapFeeScheduleToResponse(schedule))
+	}
+	return res, nil
+}
+
+func (s *feeService) GetActiveSchedule() (dto.FeeScheduleResponse, error) {
+	schedule, err := s.feeRepo.FindActiveSchedule(time.Now())
+	if err != nil {
+		return dto.FeeScheduleResponse{}, err
+	}
+	if schedule == nil {
+		return dto.FeeScheduleResponse{}, errors.New("fee schedule not found")
+	}
+	return mapFeeScheduleToResponse(*schedule), nil
+}
+
+func validateFeeRule(rule models.FeeRule) error {
+	if rule.Percent < 0 || rule.Percent > 100 || rule.FixedAmount < 0 {
+		return errors.New("percent must be 0-100 and fixed_amount not negative")
+	}
+	switch rule.Type {
+	case "commission":
+		if rule.FixedAmount != 0 || rule.PaymentMethod != "" {
+			return errors.New("a commission is a percent of the items, optionally per category or farmer")
+		}
+	case "payment_method":
+		if rule.PaymentMethod != "gateway" && rule.PaymentMethod != "bank_transfer" {
+			return errors.New("payment_method must be gateway or bank_transfer")
+		}
+		if rule.Percent != 0 || rule.Category != "" || rule.FarmerID != nil {
+			return errors.New("a payment method fee is a fixed amount")
+		}
+	case "service":
+		if rule.PaymentMethod != "" || rule.Category != "" || rule.FarmerID != nil {
+			return errors.New("a service fee applies to the whole order")
+		}
+	case "shipping":
+		if rule.Percent != 0 || rule.PaymentMethod != "" || rule.Category != "" {
+			return errors.New("shipping is a fixed amount per farmer")
+		}
+	default:
+		return errors.New("type must be commission, payment_method, service or shipping")
+	}
+	return nil
+}
+
+// commissionRuleFor picks the most specific commission rule for an item: one
+// for the farmer and category, then the farmer, then the category, then the
+// default. It returns nil when the schedule takes no commission on the item.
+func commissionRuleFor(schedule *models.FeeSchedule, farmerID uint, category string) *models.FeeRule {
+	if schedule == nil {
+		return nil
+	}
+
+	var best *models.FeeRule
+	bestScore := -1
+	for i := range schedule.Rules {
+		rule := &schedule.Rules[i]
+		if rule.Type != "commission" {
+			continue
+		}
+		if rule.FarmerID != nil && *rule.FarmerID != farmerID {
+			continue
+		}
+		if rule.Category != "" && !strings.EqualFold(rule.Category, category) {
+			continue
+		}
+
+		score := 0
+		if rule.FarmerID != nil {
+			score += 2
+		}
+		if rule.Category != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+	return best
+}
+
+// priceCommissionFees works out the commission lines of a new order, one
+// per farmer and rule. commissionRules maps each product to the rule its
+// items were priced with.
+func priceCommissionFees(orderID uint, fulfillments []models.OrderFulfillment, commissionRules map[uint]*models.FeeRule) []models.OrderFee {
+	var fees []models.OrderFee
+	for _, f := range fulfillments {
+		lines := map[uint]*models.OrderFee{}
+		var ruleIDs []uint
+		for _, item := range f.Items {
+			rule := commissionRules[item.ProductID]
+			if rule == nil || rule.Percent == 0 {
+				continue
+			}
+			line, ok := lines[rule.ID]
+			if !ok {
+				fulfillmentID, farmerID, ruleID := f.ID, f.FarmerID, rule.ID
+				line = &models.OrderFee{
+					OrderID:       orderID,
+					FulfillmentID: &fulfillmentID,
+					FarmerID:      &farmerID,
+					FeeRuleID:     &ruleID,
+					Type:          "commission",
+					Payer:         "farmer",
+					Description:   commissionDescription(*rule),
+					Percent:       rule.Percent,
+				}
+				lines[rule.ID] = line
+				ruleIDs = append(ruleIDs, rule.ID)
+			}
+			line.Amount += item.Price * float64(item.Quantity) * rule.Percent / 100
+		}
+		for _, id := range ruleIDs {
+			lines[id].Amount = roundMoney(lines[id].Amount)
+			fees = append(fees, *lines[id])
+		}
+	}
+	return fees
+}
+
+// priceServiceFees works out the buyer's service fee lines for items worth
+// itemsTotal.
+func priceServiceFees(schedule *models.FeeSchedule, itemsTotal float64) []models.OrderFee {
+	var fees []models.OrderFee
+	if schedule == nil {
+		return fees
+	}
+	for i := range schedule.Rules {
+		rule := schedule.Rules[i]
+		if rule.Type != "service" {
+			continue
+		}
+		amount := roundRupiah(itemsTotal*rule.Percent/100 + rule.FixedAmount)
+		if amount <= 0 {
+			continue
+		}
+		ruleID := rule.ID
+		fees = append(fees, models.OrderFee{
+			FeeRuleID:   &ruleID,
+			Type:        "service",
+			Payer:       "buyer",
+			Description: "Service fee",
+			Percent:     rule.Percent,
+			Amount:      amount,
+		})
+	}
+	return fees
+}
+
+// shippingCostFor is what the buyer pays for the farmer's share of an order:
+// the farmer's own shipping rule, else the default one.
+func shippingCostFor(schedule *models.FeeSchedule, farmerID uint) float64 {
+	if schedule == nil {
+		return 0
+	}
+	var best *models.FeeRule
+	for i := range schedule.Rules {
+		rule := &schedule.Rules[i]
+		if rule.Type != "shipping" {
+			continue
+		}
+		if rule.FarmerID != nil {
+			if *rule.FarmerID == farmerID {
+				return roundRupiah(rule.FixedAmount)
+			}
+			continue
+		}
+		if best == nil {
+			best = rule
+		}
+	}
+	if best == nil {
+		return 0
+	}
+	return roundRupiah(best.FixedAmount)
+}
+
+// paymentMethodFee is the fixed fee the buyer pays on top of a payment made
+// with the method: a bank transfer, or anything else through the gateway.
+func paymentMethodFee(schedule *models.FeeSchedule, method string) (float64, *models.FeeRule) {
+	if schedule == nil {
+		return 0, nil
+	}
+	if method != "bank_transfer" {
+		method = "gateway"
+	}
+	for i := range schedule.Rules {
+		rule := &schedule.Rules[i]
+		if rule.Type == "payment_method" && rule.PaymentMethod == method {
+			return roundRupiah(rule.FixedAmount), rule
+		}
+	}
+	return 0, nil
+}
+
+func commissionDescription(rule models.FeeRule) string {
+	desc := fmt.Sprintf("Commission %.2f%%", rule.Percent)
+	switch {
+	case rule.FarmerID != nil && rule.Category != "":
+		desc += fmt.Sprintf(" (farmer #%d, %s)", *rule.FarmerID, rule.Category)
+	case rule.FarmerID != nil:
+		desc += fmt.Sprintf(" (farmer #%d)", *rule.FarmerID)
+	case rule.Category != "":
+		desc += fmt.Sprintf(" (%s)", rule.Category)
+	}
+	return desc
+}
+
+func mapFeeScheduleToResponse(schedule models.FeeSchedule) dto.FeeScheduleResponse {
+	res := dto.FeeScheduleResponse{
+		ID:            schedule.ID,
+		Version:       schedule.Version,
+		EffectiveFrom: schedule.EffectiveFrom.Format(time.RFC3339),
+		CreatedBy:     schedule.CreatedBy,
+		Note:          schedule.Note,
+		Rules:         []dto.FeeRuleResponse{},
+	}
+	for _, r := range schedule.Rules {
+		res.Rules = append(res.Rules, dto.FeeRuleResponse{
+			ID:            r.ID,
+			Type:          r.Type,
+			Category:      r.Category,
+			FarmerID:      r.FarmerID,
+			PaymentMethod: r.PaymentMethod,
+			Percent:       r.Percent,
+			FixedAmount:   r.FixedAmount,
+		})
+	}
+	return res
+}
+
+func mapOrderFeeToResponse(fee models.OrderFee) dto.OrderFeeResponse {
+	return dto.OrderFeeResponse{
+		Type:          fee.Type,
+		Payer:         fee.Payer,
+		Description:   fee.Description,
+		Percent:       fee.Percent,
+		Amount:        fee.Amount,
+		FulfillmentID: fee.FulfillmentID,
+		PaymentID:     fee.PaymentID,
+	}
+}
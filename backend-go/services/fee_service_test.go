@@ -0,0 +1,98 @@
+package services
+
+import (
+	"smartfarm-api/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommissionRuleFor_MostSpecificWins(t *testing.T) {
+	farmerID := uint(7)
+	schedule := &models.FeeSchedule{Rules: []models.FeeRule{
+		{ID: 1, Type: "commission", Percent: 5},
+		{ID: 2, Type: "commission", Category: "Sayur", Percent: 8},
+		{ID: 3, Type: "commission", FarmerID: &farmerID, Percent: 3},
+		{ID: 4, Type: "commission", FarmerID: &farmerID, Category: "Buah", Percent: 2},
+		{ID: 5, Type: "service", Percent: 1},
+	}}
+
+	assert.Equal(t, uint(1), commissionRuleFor(schedule, 1, "Buah").ID)
+	assert.Equal(t, uint(2), commissionRuleFor(schedule, 1, "sayur").ID)
+	assert.Equal(t, uint(3), commissionRuleFor(schedule, farmerID, "Sayur").ID)
+	assert.Equal(t, uint(4), commissionRuleFor(schedule, farmerID, "Buah").ID)
+	assert.Nil(t, commissionRuleFor(nil, farmerID, "Buah"))
+	assert.Nil(t, commissionRuleFor(&models.FeeSchedule{}, farmerID, "Buah"))
+}
+
+func TestPriceOrderFees(t *testing.T) {
+	schedule := &models.FeeSchedule{Rules: []models.FeeRule{
+		{ID: 1, Type: "commission", Percent: 10},
+		{ID: 2, Type: "commission", Category: "Sayur", Percent: 5},
+		{ID: 3, Type: "service", Percent: 2, FixedAmount: 1000},
+		{ID: 4, Type: "payment_method", PaymentMethod: "bank_transfer", FixedAmount: 4000},
+	}}
+	rules := map[uint]*models.FeeRule{10: &schedule.Rules[0], 11: &schedule.Rules[1], 12: &schedule.Rules[0]}
+
+	fees := priceCommissionFees(99, []models.OrderFulfillment{{
+		ID:       1,
+		FarmerID: 7,
+		Items: []models.OrderItem{
+			{ProductID: 10, Price: 10000, Quantity: 2},
+			{ProductID: 11, Price: 5000, Quantity: 1},
+			{ProductID: 12, Price: 3000, Quantity: 1},
+		},
+	}}, rules)
+	if assert.Len(t, fees, 2) {
+		assert.Equal(t, 2300.0, fees[0].Amount) // 10% of 23000
+		assert.Equal(t, 250.0, fees[1].Amount)  // 5% of 5000
+		assert.Equal(t, "farmer", fees[0].Payer)
+		assert.Equal(t, uint(99), fees[0].OrderID)
+	}
+
+	service := priceServiceFees(schedule, 28000)
+	if assert.Len(t, service, 1) {
+		assert.Equal(t, 1560.0, service[0].Amount) // 2% of 28000 + 1000
+		assert.Equal(t, "buyer", service[0].Payer)
+	}
+
+	// What the buyer pays is priced in whole rupiah, the gateway's smallest unit
+	service = priceServiceFees(&models.FeeSchedule{Rules: []models.FeeRule{{Type: "service", Percent: 1.5}}}, 33333)
+	if assert.Len(t, service, 1) {
+		assert.Equal(t, 500.0, service[0].Amount) // 1.5% of 33333 is 499.995
+	}
+
+	fee, _ := paymentMethodFee(schedule, "bank_transfer")
+	assert.Equal(t, 4000.0, fee)
+	fee, rule := paymentMethodFee(schedule, "")
+	assert.Equal(t, 0.0, fee)
+	assert.Nil(t, rule)
+}
+
+func TestShippingCostFor_FarmerRuleWins(t *testing.T) {
+	farmerID := uint(7)
+	schedule := &models.FeeSchedule{Rules: []models.FeeRule{
+		{ID: 1, Type: "service", FixedAmount: 500},
+		{ID: 2, Type: "shipping", FarmerID: &farmerID, FixedAmount: 15000},
+		{ID: 3, Type: "shipping", FixedAmount: 10000},
+	}}
+
+	assert.Equal(t, 15000.0, shippingCostFor(schedule, farmerID))
+	assert.Equal(t, 10000.0, shippingCostFor(schedule, 8))
+	assert.Equal(t, 0.0, shippingCostFor(&models.FeeSchedule{Rules: schedule.Rules[:2]}, 8))
+	assert.Equal(t, 0.0, shippingCostFor(nil, farmerID))
+}
+
+func TestValidateFeeRule(t *testing.T) {
+	farmerID := uint(7)
+	assert.NoError(t, validateFeeRule(models.FeeRule{Type: "commission", Category: "Sayur", FarmerID: &farmerID, Percent: 5}))
+	assert.NoError(t, validateFeeRule(models.FeeRule{Type: "payment_method", PaymentMethod: "gateway", FixedAmount: 4000}))
+	assert.NoError(t, validateFeeRule(models.FeeRule{Type: "service", Percent: 1, FixedAmount: 500}))
+	assert.NoError(t, validateFeeRule(models.FeeRule{Type: "shipping", FarmerID: &farmerID, FixedAmount: 12000}))
+
+	assert.Error(t, validateFeeRule(models.FeeRule{Type: "commission", Percent: 120}))
+	assert.Error(t, validateFeeRule(models.FeeRule{Type: "commission", FixedAmount: 100}))
+	assert.Error(t, validateFeeRule(models.FeeRule{Type: "payment_method", PaymentMethod: "cash", FixedAmount: 100}))
+	assert.Error(t, validateFeeRule(models.FeeRule{Type: "service", Category: "Sayur", Percent: 1}))
+	assert.Error(t, validateFeeRule(models.FeeRule{Type: "shipping", Percent: 2}))
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ledger accounts. farmer_payable is kept per farmer; order_clearing holds
+// buyer money until it is credited to a farmer or refunded.
+const (
+	ledgerFarmerPayable   = "farmer_payable"
+	ledgerOrderClearing   = "order_clearing"
+	ledgerPlatformRevenue = "platform_revenue"
+	ledgerPayoutClearing  = "payout_clearing"
+)
+
+type LedgerService interface {
+	GetFarmerBalance(farmerID uint) (dto.FarmerBalanceResponse, error)
+	GetFarmerStatement(farmerID uint, month string) (dto.FarmerStatement, error)
+	RunPayoutBatch(adminID uint, minAmount float64) (dto.PayoutBatchResponse, error)
+	GetPayoutBatches() ([]dto.PayoutBatchResponse, error)
+}
+
+type ledgerService struct {
+	ledgerRepo repositories.LedgerRepository
+}
+
+func NewLedgerService(ledgerRepo repositories.LedgerRepository) LedgerService {
+	return &ledgerService{ledgerRepo}
+}
+
+func (s *ledgerService) GetFarmerBalance(farmerID uint) (dto.FarmerBalanceResponse, error) {
+	balance, err := s.ledgerRepo.FarmerBalance(farmerID, nil)
+	if err != nil {
+		return dto.FarmerBalanceResponse{}, err
+	}
+	pending, err := s.ledgerRepo.PendingEarnings(farmerID)
+	if err != nil {
+		return dto.FarmerBalanceResponse{}, err
+	}
+	totals, err := s.ledgerRepo.FarmerTotalsByKind(farmerID)
+	if err != nil {
+		return dto.FarmerBalanceResponse{}, err
+	}
+
+	res := dto.FarmerBalanceResponse{
+		FarmerID:        farmerID,
+		Balance:         roundMoney(balance),
+		PendingEarnings: roundMoney(pending),
+	}
+	for _, t := range totals {
+		switch t.Kind {
+		case "sale":
+			res.TotalEarned += t.Credit - t.Debit
+		case "commission", "commission_reversal":
+			res.TotalCommission += t.Debit - t.Credit
+		case "refund":
+			res.TotalRefunded += t.Debit - t.Credit
+		case "payout":
+			res.TotalPaidOut += t.Debit - t.Credit
+		}
+	}
+	res.TotalEarned = roundMoney(res.TotalEarned)
+	res.TotalCommission = roundMoney(res.TotalCommission)
+	res.TotalRefunded = roundMoney(res.TotalRefunded)
+	res.TotalPaidOut = roundMoney(res.TotalPaidOut)
+	return res, nil
+}
+
+// GetFarmerStatement lists the farmer's ledger entries of month (YYYY-MM)
+// with a running balance starting from the balance carried into the month.
+func (s *ledgerService) GetFarmerStatement(farmerID uint, month string) (dto.FarmerStatement, error) {
+	from, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return dto.FarmerStatement{}, errors.New("invalid month: use YYYY-MM")
+	}
+	to := from.AddDate(0, 1, 0)
+
+	opening, err := s.ledgerRepo.FarmerBalance(farmerID, &from)
+	if err != nil {
+		return dto.FarmerStatement{}, err
+	}
+	entries, err := s.ledgerRepo.FindFarmerEntries(farmerID, from, to)
+	if err != nil {
+		return dto.FarmerStatement{}, err
+	}
+
+	statement := dto.FarmerStatement{
+		FarmerID:       farmerID,
+		Month:          month,
+		OpeningBalance: roundMoney(opening),
+		Lines:          []dto.FarmerStatementLine{},
+	}
+	balance := opening
+	for _, e := range entries {
+		balance += e.Credit - e.Debit
+		statement.TotalCredits += e.Credit
+		statement.TotalDebits += e.Debit
+
+		line := dto.FarmerStatementLine{
+			Date:    e.CreatedAt.Format("2006-01-02 15:04:05"),
+			Debit:   e.Debit,
+			Credit:  e.Credit,
+			Balance: roundMoney(balance),
+		}
+		if e.Transaction != nil {
+			line.Kind = e.Transaction.Kind
+			line.Reference = e.Transaction.Reference
+			line.OrderID = e.Transaction.OrderID
+			line.Description = e.Transaction.Description
+		}
+		statement.Lines = append(statement.Lines, line)
+	}
+	statement.TotalCredits = roundMoney(statement.TotalCredits)
+	statement.TotalDebits = roundMoney(statement.TotalDebits)
+	statement.ClosingBalance = roundMoney(balance)
+	return statement, nil
+}
+
+// RunPayoutBatch pays out every farmer owed at least minAmount. Each farmer
+// is locked and their balance read again before it is paid out, so two
+// batches running at once cannot pay the same money twice.
+func (s *ledgerService) RunPayoutBatch(adminID uint, minAmount float64) (dto.PayoutBatchResponse, error) {
+	if minAmount <= 0 {
+		minAmount = floatFromEnv("PAYOUT_MIN_AMOUNT", 0)
+	}
+
+	var batch models.PayoutBatch
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txLedgerRepo := s.ledgerRepo.WithTx(tx)
+
+		due, err := txLedgerRepo.FindFarmerBalancesDue(minAmount)
+		if err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return errors.New("no balances due")
+		}
+
+		batch = models.PayoutBatch{CreatedBy: adminID}
+		if err := txLedgerRepo.CreatePayoutBatch(&batch); err != nil {
+			return err
+		}
+
+		for _, d := range due {
+			if err := txLedgerRepo.LockFarmer(d.FarmerID); err != nil {
+				return err
+			}
+			balance, err := txLedgerRepo.FarmerBalance(d.FarmerID, nil)
+			if err != nil {
+				return err
+			}
+			balance = roundMoney(balance)
+			if balance <= 0 || balance < minAmount {
+				continue
+			}
+
+			payout := models.Payout{BatchID: batch.ID, FarmerID: d.FarmerID, Amount: balance}
+			if err := txLedgerRepo.CreatePayout(&payout); err != nil {
+				return err
+			}
+
+			farmerID := d.FarmerID
+			txn := ledgerTransfer("payout", fmt.Sprintf("payout:%d", payout.ID), fmt.Sprintf("Payout batch #%d", batch.ID),
+				ledgerFarmerPayable, &farmerID, ledgerPayoutClearing, nil, balance)
+			txn.PayoutID = &payout.ID
+			if err := txLedgerRepo.CreateTransaction(&txn); err != nil {
+				return err
+			}
+
+			batch.TotalAmount += balance
+			batch.Payouts = append(batch.Payouts, payout)
+		}
+
+		if len(batch.Payouts) == 0 {
+			return errors.New("no balances due")
+		}
+		batch.TotalAmount = roundMoney(batch.TotalAmount)
+		return txLedgerRepo.UpdatePayoutBatchTotal(batch.ID, batch.TotalAmount)
+	})
+	if err != nil {
+		return dto.PayoutBatchResponse{}, err
+	}
+
+	log.Printf("[Ledger] Payout batch %d: %d farmers, %.2f by admin %d", batch.ID, len(batch.Payouts), batch.TotalAmount, adminID)
+	return mapPayoutBatchToResponse(batch), nil
+}
+
+func (s *ledgerService) GetPayoutBatches() ([]dto.PayoutBatchResponse, error) {
+	batches, err := s.ledgerRepo.FindPayoutBatches(50)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []dto.PayoutBatchResponse{}
+	for _, b := range batches {
+		res = append(res, mapPayoutBatchToResponse(b))
+	}
+	return res, nil
+}
+
+// creditCompletedFulfillments credits each farmer whose fulfillment just
+// completed with what the buyer paid for it, less items already refunded,
+// and takes the commission each item was priced with. CreditedAt keeps a
+// fulfillment from being credited twice. Fulfillment changes are saved here.
+// The fees the buyer paid on top go to the platform once the order completes.
+func creditCompletedFulfillments(ledgerRepo repositories.LedgerRepository, orderRepo repositories.OrderRepository, order *models.Order) error {
+	now := time.Now()
+
+	for i := range order.Fulfillments {
+		f := &order.Fulfillments[i]
+		if f.Status != "completed" || f.CreditedAt != nil {
+			continue
+		}
+
+		items, commissionAmount := 0.0, 0.0
+		for _, item := range order.OrderItems {
+			if item.FulfillmentID != nil && *item.FulfillmentID == f.ID {
+				value := item.Price * float64(item.Quantity-item.RefundedQuantity)
+				items += value
+				commissionAmount += value * item.CommissionRate / 100
+			}
+		}
+
+		farmerID := f.FarmerID
+		sale := ledgerTransfer("sale", fmt.Sprintf("sale:fulfillment:%d", f.ID), fmt.Sprintf("Order #%d", order.ID),
+			ledgerOrderClearing, nil, ledgerFarmerPayable, &farmerID, items+f.ShippingCost)
+		commission := ledgerTransfer("commission", fmt.Sprintf("commission:fulfillment:%d", f.ID), fmt.Sprintf("Commission on order #%d", order.ID),
+			ledgerFarmerPayable, &farmerID, ledgerPlatformRevenue, nil, commissionAmount)
+
+		for _, txn := range []models.LedgerTransaction{sale, commission} {
+			if len(txn.Entries) == 0 {
+				continue
+			}
+			txn.OrderID = &order.ID
+			txn.FulfillmentID = &f.ID
+			if err := ledgerRepo.CreateTransaction(&txn); err != nil {
+				return err
+			}
+		}
+
+		f.CreditedAt = &now
+		if err := orderRepo.SaveFulfillment(f); err != nil {
+			return err
+		}
+		log.Printf("[Ledger] Order %d: farmer %d credited %.2f less %.2f commission", order.ID, farmerID, items+f.ShippingCost, roundMoney(commissionAmount))
+	}
+
+	if order.Status != "completed" {
+		return nil
+	}
+	buyerFees := 0.0
+	for _, fee := range order.Fees {
+		if fee.Payer == "buyer" {
+			buyerFees += fee.Amount
+		}
+	}
+	txn := ledgerTransfer("buyer_fees", fmt.Sprintf("buyer_fees:order:%d", order.ID), fmt.Sprintf("Fees on order #%d", order.ID),
+		ledgerOrderClearing, nil, ledgerPlatformRevenue, nil, buyerFees)
+	if len(txn.Entries) == 0 {
+		return nil
+	}
+	txn.OrderID = &order.ID
+	return ledgerRepo.CreateTransaction(&txn)
+}
+
+// debitRefundedItems takes refunded items back from farmers who were already
+// credited for them and gives back the commission taken on them, at the rate
+// each item was priced with.
+func debitRefundedItems(ledgerRepo repositories.LedgerRepository, order models.Order, refundID uint, lines []refundLine) error {
+	for _, f := range order.Fulfillments {
+		if f.CreditedAt == nil {
+			continue
+		}
+
+		amount, commissionAmount := 0.0, 0.0
+		for _, line := range lines {
+			if line.item.FulfillmentID != nil && *line.item.FulfillmentID == f.ID {
+				amount += line.amount
+				commissionAmount += line.amount * line.item.CommissionRate / 100
+			}
+		}
+		if amount == 0 {
+			continue
+		}
+
+		farmerID := f.FarmerID
+		refund := ledgerTransfer("refund", fmt.Sprintf("refund:%d:fulfillment:%d", refundID, f.ID), fmt.Sprintf("Refund on order #%d", order.ID),
+			ledgerFarmerPayable, &farmerID, ledgerOrderClearing, nil, amount)
+		reversal := ledgerTransfer("commission_reversal", fmt.Sprintf("commission_reversal:%d:fulfillment:%d", refundID, f.ID), fmt.Sprintf("Commission returned on refund of order #%d", order.ID),
+			ledgerPlatformRevenue, nil, ledgerFarmerPayable, &farmerID, commissionAmount)
+
+		for _, txn := range []models.LedgerTransaction{refund, reversal} {
+			if len(txn.Entries) == 0 {
+				continue
+			}
+			fulfillmentID := f.ID
+			txn.OrderID = &order.ID
+			txn.FulfillmentID = &fulfillmentID
+			txn.RefundID = &refundID
+			if err := ledgerRepo.CreateTransaction(&txn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ledgerTransfer moves amount from one account to another as a balanced
+// transaction of two entries. A transfer that rounds to zero has no entries
+// and should not be posted.
+func ledgerTransfer(kind string, reference string, description string, debitAccount string, debitFarmer *uint, creditAccount string, creditFarmer *uint, amount float64) models.LedgerTransaction {
+	txn := models.LedgerTransaction{Kind: kind, Reference: reference, Description: description}
+	amount = roundMoney(amount)
+	if amount <= 0 {
+		return txn
+	}
+	txn.Entries = []models.LedgerEntry{
+		{Account: debitAccount, FarmerID: debitFarmer, Debit: amount},
+		{Account: creditAccount, FarmerID: creditFarmer, Credit: amount},
+	}
+	return txn
+}
+
+// FarmerStatementCSV renders the statement for download.
+func FarmerStatementCSV(statement dto.FarmerStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	w.Write([]string{"date", "kind", "reference", "order_id", "description", "debit", "credit", "balance"})
+	w.Write([]string{"", "opening_balance", "", "", "", "", "", money(statement.OpeningBalance)})
+	for _, l := range statement.Lines {
+		orderID := ""
+		if l.OrderID != nil {
+			orderID = strconv.FormatUint(uint64(*l.OrderID), 10)
+		}
+		w.Write([]string{l.Date, l.Kind, l.Reference, orderID, l.Description, money(l.Debit), money(l.Credit), money(l.Balance)})
+	}
+	w.Write([]string{"", "closing_balance", "", "", "", money(statement.TotalDebits), money(statement.TotalCredits), money(statement.ClosingBalance)})
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func mapPayoutBatchToResponse(b models.PayoutBatch) dto.PayoutBatchResponse {
+	res := dto.PayoutBatchResponse{
+		ID:          b.ID,
+		CreatedBy:   b.CreatedBy,
+		TotalAmount: b.TotalAmount,
+		CreatedAt:   b.CreatedAt.Format("2006-01-02 15:04:05"),
+		Payouts:     []dto.PayoutResponse{},
+	}
+	for _, p := range b.Payouts {
+		payout := dto.PayoutResponse{ID: p.ID, FarmerID: p.FarmerID, Amount: p.Amount}
+		if p.Farmer != nil {
+			payout.FarmerName = p.Farmer.Name
+		}
+		res.Payouts = append(res.Payouts, payout)
+	}
+	return res
+}
+
+func floatFromEnv(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		log.Printf("⚠️  invalid %s=%q, using %v", key, value, fallback)
+		return fallback
+	}
+	return f
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// roundRupiah rounds what the buyer pays to whole rupiah, the smallest amount
+// the gateway charges or refunds.
+func roundRupiah(v float64) float64 {
+	return math.Round(v)
+}
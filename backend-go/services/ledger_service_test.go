@@ -0,0 +1,51 @@
+package services
+
+import (
+	"smartfarm-api/dto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerTransfer_Balances(t *testing.T) {
+	farmerID := uint(7)
+	txn := ledgerTransfer("commission", "commission:fulfillment:1", "Commission", ledgerFarmerPayable, &farmerID, ledgerPlatformRevenue, nil, 12.345)
+
+	if assert.Len(t, txn.Entries, 2) {
+		debits, credits := 0.0, 0.0
+		for _, e := range txn.Entries {
+			debits += e.Debit
+			credits += e.Credit
+		}
+		assert.Equal(t, debits, credits)
+		assert.Equal(t, 12.35, debits)
+		assert.Equal(t, &farmerID, txn.Entries[0].FarmerID)
+		assert.Nil(t, txn.Entries[1].FarmerID)
+	}
+
+	// Nothing to post when the amount rounds to zero, e.g. a 0% commission
+	assert.Empty(t, ledgerTransfer("commission", "commission:fulfillment:2", "Commission", ledgerFarmerPayable, &farmerID, ledgerPlatformRevenue, nil, 0.001).Entries)
+}
+
+func TestFarmerStatementCSV(t *testing.T) {
+	orderID := uint(42)
+	data, err := FarmerStatementCSV(dto.FarmerStatement{
+		Month:          "2024-05",
+		OpeningBalance: 10,
+		TotalCredits:   100,
+		TotalDebits:    5,
+		ClosingBalance: 105,
+		Lines: []dto.FarmerStatementLine{
+			{Date: "2024-05-02 10:00:00", Kind: "sale", Reference: "sale:fulfillment:3", OrderID: &orderID, Description: "Order #42", Credit: 100, Balance: 110},
+			{Date: "2024-05-02 10:00:00", Kind: "commission", Reference: "commission:fulfillment:3", OrderID: &orderID, Description: "Commission 5.00% on order #42", Debit: 5, Balance: 105},
+		},
+	})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, ",opening_balance,,,,,,10.00", lines[1])
+	assert.Equal(t, "2024-05-02 10:00:00,sale,sale:fulfillment:3,42,Order #42,0.00,100.00,110.00", lines[2])
+	assert.Equal(t, ",closing_balance,,,,5.00,100.00,105.00", lines[4])
+}
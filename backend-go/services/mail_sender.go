@@ -0,0 +1,119 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MailMessage is one plain-text email.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// MailSender delivers the emails the API sends, such as verification links.
+type MailSender interface {
+	Send(msg MailMessage) error
+}
+
+var mailSender MailSender
+
+// InitMailSender picks the sender from MAIL_DRIVER ("file" or "smtp"). The
+// default, file, needs no mail server.
+func InitMailSender() {
+	mailSender = NewMailSenderFromEnv()
+}
+
+func NewMailSenderFromEnv() MailSender {
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_DRIVER"))); name {
+	case "", "file":
+		dir := os.Getenv("MAIL_SPOOL_DIR")
+		if dir == "" {
+			dir = "./mail-spool"
+		}
+		log.Printf("🛠️ [Mail] Writing emails to %s instead of sending them", dir)
+		return &FileMailSender{Dir: dir}
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			log.Fatal("❌ MAIL_DRIVER=smtp but SMTP_HOST is not set")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		log.Printf("[Mail] Sending emails through %s:%s", host, port)
+		return &SMTPMailSender{
+			Addr:     host + ":" + port,
+			Host:     host,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	default:
+		log.Fatalf("❌ unknown MAIL_DRIVER %q: use file or smtp", name)
+		return nil
+	}
+}
+
+// FileMailSender writes each email to its own .eml file in Dir, for local
+// development and tests.
+type FileMailSender struct {
+	Dir string
+}
+
+func (s *FileMailSender) Send(msg MailMessage) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), safeFileName(msg.To))
+	return os.WriteFile(filepath.Join(s.Dir, name), formatMail("", msg), 0600)
+}
+
+// SMTPMailSender sends through an SMTP server with PLAIN auth when a
+// username is set.
+type SMTPMailSender struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPMailSender) Send(msg MailMessage) error {
+	var a smtp.Auth
+	if s.Username != "" {
+		a = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Addr, a, s.From, []string{msg.To}, formatMail(s.From, msg))
+}
+
+func formatMail(from string, msg MailMessage) []byte {
+	var b strings.Builder
+	// Header values must stay on one line
+	header := strings.NewReplacer("\r", "", "\n", "")
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", header.Replace(from))
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailSender_WritesToSpool(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spool")
+	sender := &FileMailSender{Dir: dir}
+
+	err := sender.Send(MailMessage{
+		To:      "tani@example.com",
+		Subject: "Reset\r\nBcc: evil@example.com",
+		Body:    "line one\nline two",
+	})
+	assert.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	assert.True(t, strings.HasSuffix(files[0].Name(), "tani@example.com.eml"))
+
+	raw, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	assert.NoError(t, err)
+	mail := string(raw)
+	assert.Contains(t, mail, "To: tani@example.com\r\n")
+	assert.Contains(t, mail, "Subject: ResetBcc: evil@example.com\r\n")
+	assert.NotContains(t, mail, "\r\nBcc:")
+	assert.Contains(t, mail, "line one\r\nline two")
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"time"
+)
+
+type NotificationService interface {
+	GetMyNotifications(userID uint) ([]models.Notification, error)
+	MarkRead(id uint, userID uint) error
+}
+
+type notificationService struct {
+	repo repositories.NotificationRepository
+}
+
+func NewNotificationService(repo repositories.NotificationRepository) NotificationService {
+	return &notificationService{repo}
+}
+
+func (s *notificationService) GetMyNotifications(userID uint) ([]models.Notification, error) {
+	return s.repo.FindByUserID(userID, 50)
+}
+
+func (s *notificationService) MarkRead(id uint, userID uint) error {
+	affected, err := s.repo.MarkRead(id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("notification not found")
+	}
+	return nil
+}
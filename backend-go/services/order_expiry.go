@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"smartfarm-api/config"
+	"smartfarm-api/repositories"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrderExpirySweeper cancels pending orders that were never paid within the
+// TTL, expires their pending payments and returns their items to stock.
+//
+// Several replicas can sweep at the same time: each order is re-read under a
+// row lock and skipped if another sweeper (or a late payment) already moved it.
+type OrderExpirySweeper struct {
+	orderRepo   repositories.OrderRepository
+	productRepo repositories.ProductRepository
+	paymentRepo repositories.PaymentRepository
+	ttl         time.Duration
+	batchSize   int
+	now         func() time.Time
+	expire      func(orderID uint, cutoff time.Time) (bool, error)
+}
+
+func NewOrderExpirySweeper(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, paymentRepo repositories.PaymentRepository, ttl time.Duration, now func() time.Time) *OrderExpirySweeper {
+	if now == nil {
+		now = time.Now
+	}
+	s := &OrderExpirySweeper{
+		orderRepo:   orderRepo,
+		productRepo: productRepo,
+		paymentRepo: paymentRepo,
+		ttl:         ttl,
+		batchSize:   100,
+		now:         now,
+	}
+	s.expire = s.expireOrder
+	return s
+}
+
+// StartOrderExpirySweeper runs the sweeper in the background using
+// ORDER_PENDING_TTL (default 24h) and ORDER_EXPIRY_INTERVAL (default 5m).
+func StartOrderExpirySweeper() {
+	ttl := durationFromEnv("ORDER_PENDING_TTL", 24*time.Hour)
+	interval := durationFromEnv("ORDER_EXPIRY_INTERVAL", 5*time.Minute)
+
+	sweeper := NewOrderExpirySweeper(
+		repositories.NewOrderRepository(config.DB),
+		repositories.NewProductRepository(config.DB),
+		repositories.NewPaymentRepository(config.DB),
+		ttl,
+		nil,
+	)
+
+	log.Printf("[OrderExpiry] Sweeping pending orders older than %v every %v", ttl, interval)
+	go sweeper.Run(context.Background(), interval)
+}
+
+// Run sweeps once per interval until ctx is cancelled.
+func (s *OrderExpirySweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(); err != nil {
+			log.Printf("[OrderExpiry] Sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep expires every pending order created before now-TTL and returns how many
+// orders it cancelled.
+func (s *OrderExpirySweeper) Sweep() (int, error) {
+	cutoff := s.now().Add(-s.ttl)
+	expired := 0
+
+	var afterID uint
+	for {
+		candidates, err := s.orderRepo.FindPendingCreatedBefore(cutoff, afterID, s.batchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, candidate := range candidates {
+			afterID = candidate.ID
+
+			ok, err := s.expire(candidate.ID, cutoff)
+			if err != nil {
+				log.Printf("[OrderExpiry] Failed to expire order %d: %v", candidate.ID, err)
+				continue
+			}
+			if ok {
+				expired++
+			}
+		}
+
+		// Orders that failed or were skipped stay behind the cursor until the next sweep
+		if len(candidates) < s.batchSize {
+			return expired, nil
+		}
+	}
+}
+
+func (s *OrderExpirySweeper) expireOrder(orderID uint, cutoff time.Time) (bool, error) {
+	expired := false
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txOrderRepo := s.orderRepo.WithTx(tx)
+		txProductRepo := s.productRepo.WithTx(tx)
+		txPaymentRepo := s.paymentRepo.WithTx(tx)
+
+		order, err := txOrderRepo.FindByIDForUpdate(orderID)
+		if err != nil {
+			return err
+		}
+
+		// Another replica or a payment got here first
+		if order.Status != "pending" || !order.CreatedAt.Before(cutoff) {
+			return nil
+		}
+
+		// A bank transfer proof is waiting for a reviewer, who decides instead
+		attempts, err := txPaymentRepo.FindAllByOrderID(order.ID)
+		if err != nil {
+			return err
+		}
+		if active := activePaymentAttempt(attempts); active != nil && active.Channel == "manual" {
+			return nil
+		}
+
+		if err := changeOrderStatus(txOrderRepo, txProductRepo, &order, "cancelled", systemActor, "expired: unpaid after "+s.ttl.String()); err != nil {
+			return err
+		}
+
+		if err := txPaymentRepo.ExpirePendingByOrderID(order.ID); err != nil {
+			return err
+		}
+
+		expired = true
+		return nil
+	})
+
+	return expired, err
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️  invalid %s=%q, using %v", key, value, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOrderExpirySweeper_ExpiresUnpaidOrders moves the clock past the TTL and
+// checks that the order is cancelled, its payment expired and stock restored
+func TestOrderExpirySweeper_ExpiresUnpaidOrders(t *testing.T) {
+	db := config.DB
+	if db == nil {
+		t.Skip("Database not available for testing")
+	}
+
+	testProduct := models.Product{
+		Name:     "Test Product - Expiry",
+		Price:    10000,
+		Stock:    4,
+		Category: "Test",
+		FarmerID: 1,
+		ImageURL: "test.jpg",
+	}
+	db.Create(&testProduct)
+
+	buyer := models.User{Name: "Test Expiry Buyer", Email: "testexpiry@race.com", Password: "hashed", Role: "pembeli"}
+	db.Create(&buyer)
+
+	orderRepo := repositories.NewOrderRepository(db)
+	productRepo := repositories.NewProductRepository(db)
+	paymentRepo := repositories.NewPaymentRepository(db)
+
+	order, err := NewOrderService(orderRepo, productRepo, repositories.NewLedgerRepository(config.DB), repositories.NewFeeRepository(config.DB)).CreateOrder(dto.CreateOrderRequest{
+		Items: []dto.OrderItemRequest{{ProductID: testProduct.ID, Quantity: 4}},
+	}, buyer.ID)
+	assert.NoError(t, err)
+
+	payment := models.Payment{OrderID: order.ID, UserID: buyer.ID, Amount: 40000, Status: "pending", TransactionID: "TEST-EXPIRY-" + time.Now().Format("150405.000")}
+	db.Create(&payment)
+
+	ttl := time.Hour
+
+	// Not old enough yet
+	sweeper := NewOrderExpirySweeper(orderRepo, productRepo, paymentRepo, ttl, func() time.Time { return time.Now().Add(30 * time.Minute) })
+	count, err := sweeper.Sweep()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Past the TTL
+	sweeper = NewOrderExpirySweeper(orderRepo, productRepo, paymentRepo, ttl, func() time.Time { return time.Now().Add(2 * time.Hour) })
+	count, err = sweeper.Sweep()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// A second replica sweeping afterwards finds nothing to do
+	count, err = sweeper.Sweep()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	var updatedOrder models.Order
+	db.First(&updatedOrder, order.ID)
+	assert.Equal(t, "cancelled", updatedOrder.Status)
+
+	var updatedPayment models.Payment
+	db.First(&updatedPayment, payment.ID)
+	assert.Equal(t, "expired", updatedPayment.Status)
+
+	var updatedProduct models.Product
+	db.First(&updatedProduct, testProduct.ID)
+	assert.Equal(t, 4, updatedProduct.Stock)
+
+	// Clean up
+	db.Exec("DELETE FROM payments WHERE id = ?", payment.ID)
+	db.Exec("DELETE FROM order_status_logs WHERE order_id = ?", order.ID)
+	db.Exec("DELETE FROM order_fees WHERE order_id = ?", order.ID)
+	db.Exec("DELETE FROM order_items WHERE order_id = ?", order.ID)
+	db.Exec("DELETE FROM order_fulfillments WHERE order_id = ?", order.ID)
+	db.Exec("DELETE FROM orders WHERE id = ?", order.ID)
+	db.Exec("DELETE FROM products WHERE id = ?", testProduct.ID)
+	db.Exec("DELETE FROM users WHERE id = ?", buyer.ID)
+}
+
+// pendingOrdersRepo serves pending orders by ID like the real query.
+type pendingOrdersRepo struct {
+	repositories.OrderRepository
+	ids []uint
+}
+
+func (r *pendingOrdersRepo) FindPendingCreatedBefore(cutoff time.Time, afterID uint, limit int) ([]models.Order, error) {
+	var orders []models.Order
+	for _, id := range r.ids {
+		if id > afterID && len(orders) < limit {
+			orders = append(orders, models.Order{ID: id})
+		}
+	}
+	return orders, nil
+}
+
+// TestOrderExpirySweeper_FailingOrdersDoNotStarveLaterOnes fills the first
+// batches with orders that always fail and checks the ones behind them are
+// still expired
+func TestOrderExpirySweeper_FailingOrdersDoNotStarveLaterOnes(t *testing.T) {
+	repo := &pendingOrdersRepo{}
+	for id := uint(1); id <= 250; id++ {
+		repo.ids = append(repo.ids, id)
+	}
+
+	sweeper := NewOrderExpirySweeper(repo, nil, nil, time.Hour, nil)
+	sweeper.expire = func(orderID uint, cutoff time.Time) (bool, error) {
+		if orderID <= 200 {
+			return false, errors.New("lock wait timeout")
+		}
+		return true, nil
+	}
+
+	count, err := sweeper.Sweep()
+	assert.NoError(t, err)
+	assert.Equal(t, 50, count)
+}
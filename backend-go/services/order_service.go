@@ -2,12 +2,15 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"smartfarm-api/config"
 	"smartfarm-api/dto"
 	"smartfarm-api/models"
+	"smartfarm-api/policies"
 	"smartfarm-api/repositories"
 	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,110 +20,226 @@ type OrderService interface {
 	CreateOrder(req dto.CreateOrderRequest, userID uint) (dto.OrderResponse, error)
 	GetMyOrders(userID uint) ([]dto.OrderResponse, error)
 	GetAllOrders() ([]dto.OrderResponse, error) // For Admin/Farmer
+	ShipOrder(orderID uint, actor OrderActor, note string) (dto.OrderResponse, error)
+	CompleteOrder(orderID uint, actor OrderActor, note string) (dto.OrderResponse, error)
+	CancelOrder(orderID uint, actor OrderActor, note string) (dto.OrderResponse, error)
 
 	CreateSubscription(req dto.CreateSubscriptionRequest, userID uint) (dto.SubscriptionResponse, error)
 	GetMySubscriptions(userID uint) ([]dto.SubscriptionResponse, error)
+	GetSubscriptionSchedule(subscriptionID uint, userID uint) (dto.SubscriptionScheduleResponse, error)
+	PauseSubscription(subscriptionID uint, userID uint) (dto.SubscriptionResponse, error)
+	ResumeSubscription(subscriptionID uint, userID uint) (dto.SubscriptionResponse, error)
+	SkipNextDelivery(subscriptionID uint, userID uint) (dto.SubscriptionResponse, error)
+	CancelSubscription(subscriptionID uint, userID uint) (dto.SubscriptionResponse, error)
 }
 
 type orderService struct {
 	orderRepo   repositories.OrderRepository
 	productRepo repositories.ProductRepository
+	ledgerRepo  repositories.LedgerRepository
+	feeRepo     repositories.FeeRepository
 }
 
-func NewOrderService(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository) OrderService {
-	return &orderService{orderRepo, productRepo}
+func NewOrderService(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, ledgerRepo repositories.LedgerRepository, feeRepo repositories.FeeRepository) OrderService {
+	return &orderService{orderRepo, productRepo, ledgerRepo, feeRepo}
 }
 
 func (s *orderService) CreateOrder(req dto.CreateOrderRequest, userID uint) (dto.OrderResponse, error) {
-	if len(req.Items) == 0 {
-		return dto.OrderResponse{}, errors.New("cart is empty")
-	}
-
 	var createdOrder models.Order
 
 	err := config.DB.Transaction(func(tx *gorm.DB) error {
-		txOrderRepo := s.orderRepo.WithTx(tx)
-		txProductRepo := s.productRepo.WithTx(tx)
+		var err error
+		createdOrder, err = s.createOrderTx(tx, req, userID, orderOptions{})
+		return err
+	})
 
-		var total float64
-		var orderItems []models.OrderItem
-		isPreOrder := false
+	if err != nil {
+		return dto.OrderResponse{}, err
+	}
 
-		// 1. Process items and check stock
-		for _, itemReq := range req.Items {
-			log.Printf("[ORDER] User %d attempting to order Product %d, Qty %d", userID, itemReq.ProductID, itemReq.Quantity)
+	return mapOrderToResponse(createdOrder), nil
+}
 
-			// Find product with Lock (Select for Update) to prevent race conditions
-			var product models.Product
-			log.Printf("[LOCK] Acquiring lock for Product %d", itemReq.ProductID)
-			if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&product, itemReq.ProductID).Error; err != nil {
-				log.Printf("[ERROR] Product %d not found", itemReq.ProductID)
-				return errors.New("product not found")
-			}
-			log.Printf("[LOCK] Lock acquired for Product %d, Current Stock: %d", itemReq.ProductID, product.Stock)
+// orderOptions carries settings for orders that are not placed directly by a buyer.
+type orderOptions struct {
+	SubscriptionID *uint
+	UnitPrices     map[uint]float64 // Product ID -> price to charge instead of Product.Price
+}
 
-			if product.Stock < itemReq.Quantity {
-				log.Printf("[REJECT] Insufficient stock for Product %d (Available: %d, Requested: %d)",
-					itemReq.ProductID, product.Stock, itemReq.Quantity)
-				return errors.New("insufficient stock for " + product.Name)
-			}
+// createOrderTx locks every ordered product, takes the quantities out of stock
+// and creates the order inside tx. Cart checkout and subscription deliveries
+// reuse it so their own changes commit together with the order.
+func (s *orderService) createOrderTx(tx *gorm.DB, req dto.CreateOrderRequest, userID uint, opts orderOptions) (models.Order, error) {
+	if len(req.Items) == 0 {
+		return models.Order{}, errors.New("cart is empty")
+	}
 
-			price := product.Price
-			subTotal := price * float64(itemReq.Quantity)
-			total += subTotal
+	txOrderRepo := s.orderRepo.WithTx(tx)
+	txProductRepo := s.productRepo.WithTx(tx)
 
-			if product.IsPreOrder {
-				isPreOrder = true
-			}
+	// Fees are priced with the schedule in effect now; the order keeps it
+	schedule, err := s.feeRepo.WithTx(tx).FindActiveSchedule(time.Now())
+	if err != nil {
+		return models.Order{}, err
+	}
+	commissionRules := map[uint]*models.FeeRule{}
+
+	var total float64
+	var deposit float64
+	isPreOrder := false
+
+	// Items are grouped into one fulfillment per farmer
+	fulfillments := map[uint]*models.OrderFulfillment{}
+	var farmerIDs []uint
+
+	// 1. Process items and check stock
+	for _, itemReq := range req.Items {
+		log.Printf("[ORDER] User %d attempting to order Product %d, Qty %d", userID, itemReq.ProductID, itemReq.Quantity)
+
+		// Find product with Lock (Select for Update) to prevent race conditions
+		log.Printf("[LOCK] Acquiring lock for Product %d", itemReq.ProductID)
+		product, err := txProductRepo.FindByIDForUpdate(itemReq.ProductID)
+		if err != nil {
+			log.Printf("[ERROR] Product %d not found", itemReq.ProductID)
+			return models.Order{}, errors.New("product not found")
+		}
+		log.Printf("[LOCK] Lock acquired for Product %d, Current Stock: %d", itemReq.ProductID, product.Stock)
 
-			orderItems = append(orderItems, models.OrderItem{
-				ProductID: product.ID,
-				Quantity:  itemReq.Quantity,
-				Price:     price,
-			})
+		isReservation := reservesHarvest(product)
+		available := availableQuantity(product)
 
-			// Update stock
-			oldStock := product.Stock
-			product.Stock -= itemReq.Quantity
-			if err := txProductRepo.Update(&product); err != nil {
-				log.Printf("[ERROR] Failed to update stock for Product %d", itemReq.ProductID)
-				return err
+		if available < itemReq.Quantity {
+			log.Printf("[REJECT] Insufficient stock for Product %d (Available: %d, Requested: %d)",
+				itemReq.ProductID, available, itemReq.Quantity)
+			return models.Order{}, errors.New("insufficient stock for " + product.Name)
+		}
+
+		price := product.Price
+		if override, ok := opts.UnitPrices[product.ID]; ok {
+			price = override
+		}
+		subTotal := price * float64(itemReq.Quantity)
+		total += subTotal
+
+		// Regular items are paid in full with the deposit
+		if product.IsPreOrder && product.PreOrderDepositPercent > 0 {
+			deposit += roundRupiah(subTotal * product.PreOrderDepositPercent / 100)
+		} else {
+			deposit += subTotal
+		}
+
+		if product.IsPreOrder {
+			isPreOrder = true
+		}
+
+		fulfillment, ok := fulfillments[product.FarmerID]
+		if !ok {
+			fulfillment = &models.OrderFulfillment{
+				FarmerID:     product.FarmerID,
+				Status:       "pending",
+				ShippingCost: shippingCostFor(schedule, product.FarmerID),
 			}
-			log.Printf("[SUCCESS] Stock updated for Product %d (Old: %d, New: %d)",
-				itemReq.ProductID, oldStock, product.Stock)
+			fulfillments[product.FarmerID] = fulfillment
+			farmerIDs = append(farmerIDs, product.FarmerID)
+		}
+		item := models.OrderItem{
+			ProductID:     product.ID,
+			Quantity:      itemReq.Quantity,
+			Price:         price,
+			IsReservation: isReservation,
 		}
+		if rule := commissionRuleFor(schedule, product.FarmerID, product.Category); rule != nil {
+			commissionRules[product.ID] = rule
+			item.CommissionRate = rule.Percent
+		}
+		fulfillment.SubTotal += subTotal
+		fulfillment.Items = append(fulfillment.Items, item)
 
-		orderType := "regular"
-		if isPreOrder {
-			orderType = "preorder"
+		// Update stock
+		if isReservation {
+			product.ReservedQuantity += itemReq.Quantity
+		} else {
+			product.Stock -= itemReq.Quantity
+		}
+		if err := txProductRepo.Update(&product); err != nil {
+			log.Printf("[ERROR] Failed to update stock for Product %d", itemReq.ProductID)
+			return models.Order{}, err
 		}
+		log.Printf("[SUCCESS] Stock updated for Product %d (Available: %d -> %d, Reservation: %v)",
+			itemReq.ProductID, available, available-itemReq.Quantity, isReservation)
+	}
+
+	orderType := "regular"
+	if isPreOrder {
+		orderType = "preorder"
+	}
 
-		createdOrder = models.Order{
-			UserID:     userID,
-			TotalPrice: total,
-			Status:     "pending",
-			Type:       orderType,
-			OrderItems: orderItems,
+	createdOrder := models.Order{
+		UserID:     userID,
+		TotalPrice: total,
+		Status:     "pending",
+		Type:       orderType,
+
+		SubscriptionID: opts.SubscriptionID,
+	}
+
+	serviceFees := priceServiceFees(schedule, total)
+	if schedule != nil {
+		createdOrder.FeeScheduleID = &schedule.ID
+	}
+	for _, fee := range serviceFees {
+		createdOrder.ServiceFee += fee.Amount
+	}
+
+	// Only a real deposit makes the order payable in two steps; the service
+	// fee and shipping are paid up front
+	if deposit < total {
+		createdOrder.DepositAmount = deposit + createdOrder.ServiceFee
+		for _, farmerID := range farmerIDs {
+			createdOrder.DepositAmount += fulfillments[farmerID].ShippingCost
 		}
+		createdOrder.DepositAmount = roundRupiah(createdOrder.DepositAmount)
+	}
+
+	if req.AddressID != 0 {
+		createdOrder.AddressID = &req.AddressID
+	}
 
-		if req.AddressID != 0 {
-			createdOrder.AddressID = &req.AddressID
+	// 2. Create Order
+	if err := txOrderRepo.Create(&createdOrder); err != nil {
+		log.Printf("[OrderService] DB Create Order Error: %v", err)
+		return models.Order{}, err
+	}
+
+	// 3. Create one fulfillment per farmer together with its items
+	for _, farmerID := range farmerIDs {
+		fulfillment := fulfillments[farmerID]
+		fulfillment.OrderID = createdOrder.ID
+		for i := range fulfillment.Items {
+			fulfillment.Items[i].OrderID = createdOrder.ID
 		}
 
-		// 2. Create Order
-		if err := txOrderRepo.Create(&createdOrder); err != nil {
-			log.Printf("[OrderService] DB Create Order Error: %v", err)
-			return err
+		if err := txOrderRepo.CreateFulfillment(fulfillment); err != nil {
+			log.Printf("[OrderService] DB Create Fulfillment Error: %v", err)
+			return models.Order{}, err
 		}
 
-		return nil
-	})
+		createdOrder.OrderItems = append(createdOrder.OrderItems, fulfillment.Items...)
+		createdOrder.Fulfillments = append(createdOrder.Fulfillments, *fulfillment)
+	}
 
-	if err != nil {
-		return dto.OrderResponse{}, err
+	// 4. Record the fee lines shown on the receipt and the farmers' statements
+	fees := append(serviceFees, priceCommissionFees(createdOrder.ID, createdOrder.Fulfillments, commissionRules)...)
+	for i := range fees {
+		fees[i].OrderID = createdOrder.ID
+	}
+	if err := txOrderRepo.CreateFees(fees); err != nil {
+		log.Printf("[OrderService] DB Create Fees Error: %v", err)
+		return models.Order{}, err
 	}
+	createdOrder.Fees = fees
 
-	return mapOrderToResponse(createdOrder), nil
+	return createdOrder, nil
 }
 
 func (s *orderService) GetMyOrders(userID uint) ([]dto.OrderResponse, error) {
@@ -148,6 +267,62 @@ func (s *orderService) GetAllOrders() ([]dto.OrderResponse, error) {
 	return responses, nil
 }
 
+func (s *orderService) ShipOrder(orderID uint, actor OrderActor, note string) (dto.OrderResponse, error) {
+	return s.updateOrderStatus(orderID, "shipped", actor, note)
+}
+
+func (s *orderService) CompleteOrder(orderID uint, actor OrderActor, note string) (dto.OrderResponse, error) {
+	return s.updateOrderStatus(orderID, "completed", actor, note)
+}
+
+func (s *orderService) CancelOrder(orderID uint, actor OrderActor, note string) (dto.OrderResponse, error) {
+	return s.updateOrderStatus(orderID, "cancelled", actor, note)
+}
+
+func (s *orderService) updateOrderStatus(orderID uint, to string, actor OrderActor, note string) (dto.OrderResponse, error) {
+	var updated models.Order
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txOrderRepo := s.orderRepo.WithTx(tx)
+		txProductRepo := s.productRepo.WithTx(tx)
+
+		order, err := txOrderRepo.FindByIDForUpdate(orderID)
+		if err != nil {
+			return errors.New("order not found")
+		}
+
+		if err := authorizeOrderTransition(order, to, actor); err != nil {
+			return err
+		}
+
+		// A farmer only ships or cancels their own part of a multi-farmer order
+		if actor.Role == "petani" && (to == "shipped" || to == "cancelled") && len(order.Fulfillments) > 0 {
+			err = changeFarmerFulfillments(txOrderRepo, txProductRepo, &order, actor.UserID, to, actor, note)
+		} else {
+			err = changeOrderStatus(txOrderRepo, txProductRepo, &order, to, actor, note)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Completed fulfillments are what the farmers get paid for
+		if order.Status == "completed" {
+			if err := creditCompletedFulfillments(s.ledgerRepo.WithTx(tx), txOrderRepo, &order); err != nil {
+				return err
+			}
+		}
+
+		updated = order
+		return nil
+	})
+
+	if err != nil {
+		return dto.OrderResponse{}, err
+	}
+
+	return mapOrderToResponse(updated), nil
+}
+
 func (s *orderService) CreateSubscription(req dto.CreateSubscriptionRequest, userID uint) (dto.SubscriptionResponse, error) {
 	product, err := s.productRepo.FindByID(req.ProductID)
 	if err != nil {
@@ -158,6 +333,14 @@ func (s *orderService) CreateSubscription(req dto.CreateSubscriptionRequest, use
 		return dto.SubscriptionResponse{}, errors.New("this product is not available for subscription")
 	}
 
+	if !subscriptionAllowsPeriod(product, req.Frequency) {
+		return dto.SubscriptionResponse{}, errors.New("this product is not available for " + req.Frequency + " subscription")
+	}
+
+	if req.Duration < product.SubscriptionMinPeriods {
+		return dto.SubscriptionResponse{}, fmt.Errorf("this product requires a minimum commitment of %d periods", product.SubscriptionMinPeriods)
+	}
+
 	startDate := time.Now()
 	var endDate time.Time
 
@@ -168,13 +351,24 @@ func (s *orderService) CreateSubscription(req dto.CreateSubscriptionRequest, use
 		endDate = startDate.AddDate(0, req.Duration, 0)
 	}
 
+	quantity := req.Quantity
+	if quantity == 0 {
+		quantity = 1
+	}
+
 	sub := models.Subscription{
-		UserID:    userID,
-		ProductID: req.ProductID,
-		Frequency: req.Frequency,
-		StartDate: startDate,
-		EndDate:   endDate,
-		Status:    "active",
+		UserID:         userID,
+		ProductID:      req.ProductID,
+		Frequency:      req.Frequency,
+		StartDate:      startDate,
+		EndDate:        endDate,
+		Status:         "active",
+		Quantity:       quantity,
+		Price:          subscriptionPrice(product, req.Frequency),
+		NextDeliveryAt: &startDate, // First delivery goes out on the next scheduler run
+	}
+	if req.AddressID != 0 {
+		sub.AddressID = &req.AddressID
 	}
 
 	err = s.orderRepo.CreateSubscription(&sub)
@@ -200,7 +394,209 @@ func (s *orderService) GetMySubscriptions(userID uint) ([]dto.SubscriptionRespon
 	return responses, nil
 }
 
+func (s *orderService) GetSubscriptionSchedule(subscriptionID uint, userID uint) (dto.SubscriptionScheduleResponse, error) {
+	sub, err := s.orderRepo.FindSubscriptionByID(subscriptionID)
+	if err != nil {
+		return dto.SubscriptionScheduleResponse{}, errors.New("subscription not found")
+	}
+
+	if !policies.OwnsSubscription(userID, sub) {
+		return dto.SubscriptionScheduleResponse{}, policies.ErrForbidden
+	}
+
+	orders, err := s.orderRepo.FindBySubscriptionID(sub.ID)
+	if err != nil {
+		return dto.SubscriptionScheduleResponse{}, err
+	}
+
+	res := dto.SubscriptionScheduleResponse{
+		SubscriptionID:     sub.ID,
+		Frequency:          sub.Frequency,
+		Status:             sub.Status,
+		EndDate:            sub.EndDate.Format("2006-01-02"),
+		UpcomingDeliveries: []string{},
+		PastDeliveries:     []dto.SubscriptionDelivery{},
+	}
+
+	if sub.Status == "active" {
+		for _, date := range upcomingDeliveries(sub) {
+			res.UpcomingDeliveries = append(res.UpcomingDeliveries, date.Format("2006-01-02"))
+		}
+	}
+
+	for _, o := range orders {
+		res.PastDeliveries = append(res.PastDeliveries, dto.SubscriptionDelivery{
+			OrderID: o.ID,
+			Date:    o.CreatedAt.Format("2006-01-02"),
+			Status:  o.Status,
+		})
+	}
+
+	return res, nil
+}
+
+func (s *orderService) PauseSubscription(subscriptionID uint, userID uint) (dto.SubscriptionResponse, error) {
+	return s.changeSubscription(subscriptionID, userID, func(sub *models.Subscription, now time.Time) error {
+		if sub.Status != "active" {
+			return errors.New("subscription is not active")
+		}
+		sub.Status = "paused"
+		sub.PausedAt = &now
+		return nil
+	})
+}
+
+// ResumeSubscription shifts the next delivery and EndDate by the time spent
+// paused, so the buyer still receives every delivery they signed up for.
+func (s *orderService) ResumeSubscription(subscriptionID uint, userID uint) (dto.SubscriptionResponse, error) {
+	return s.changeSubscription(subscriptionID, userID, func(sub *models.Subscription, now time.Time) error {
+		if sub.Status != "paused" {
+			return errors.New("subscription is not paused")
+		}
+		resumeSubscription(sub, now)
+		return nil
+	})
+}
+
+func (s *orderService) SkipNextDelivery(subscriptionID uint, userID uint) (dto.SubscriptionResponse, error) {
+	return s.changeSubscription(subscriptionID, userID, func(sub *models.Subscription, now time.Time) error {
+		if sub.Status != "active" {
+			return errors.New("subscription is not active")
+		}
+		next := nextDeliveryAfter(subscriptionNextDelivery(*sub), sub.Frequency)
+		sub.NextDeliveryAt = &next
+		return nil
+	})
+}
+
+func (s *orderService) CancelSubscription(subscriptionID uint, userID uint) (dto.SubscriptionResponse, error) {
+	return s.changeSubscription(subscriptionID, userID, func(sub *models.Subscription, now time.Time) error {
+		if sub.Status != "active" && sub.Status != "paused" {
+			return errors.New("subscription is already " + sub.Status)
+		}
+		sub.Status = "cancelled"
+		sub.PausedAt = nil
+		return nil
+	})
+}
+
+// changeSubscription locks the subscription, checks that it belongs to the
+// user and saves whatever change apply makes, so a buyer action cannot race
+// the delivery scheduler.
+func (s *orderService) changeSubscription(subscriptionID uint, userID uint, apply func(sub *models.Subscription, now time.Time) error) (dto.SubscriptionResponse, error) {
+	var updated models.Subscription
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txOrderRepo := s.orderRepo.WithTx(tx)
+
+		sub, err := txOrderRepo.FindSubscriptionByIDForUpdate(subscriptionID)
+		if err != nil {
+			return errors.New("subscription not found")
+		}
+
+		if !policies.OwnsSubscription(userID, sub) {
+			return policies.ErrForbidden
+		}
+
+		if err := apply(&sub, time.Now()); err != nil {
+			return err
+		}
+
+		updated = sub
+		return txOrderRepo.UpdateSubscription(&sub)
+	})
+
+	if err != nil {
+		return dto.SubscriptionResponse{}, err
+	}
+
+	// Product name for the response
+	if product, err := s.productRepo.FindByID(updated.ProductID); err == nil {
+		updated.Product = product
+	}
+	return mapSubscriptionToResponse(updated), nil
+}
+
+// resumeSubscription moves the schedule forward by the paused duration.
+func resumeSubscription(sub *models.Subscription, now time.Time) {
+	if sub.PausedAt != nil {
+		pausedFor := now.Sub(*sub.PausedAt)
+		next := subscriptionNextDelivery(*sub).Add(pausedFor)
+		sub.NextDeliveryAt = &next
+		sub.EndDate = sub.EndDate.Add(pausedFor)
+	}
+	sub.Status = "active"
+	sub.PausedAt = nil
+}
+
+// subscriptionAllowsPeriod checks the frequency against the periods the farmer
+// offers. Products saved before periods were enforced allow both.
+func subscriptionAllowsPeriod(product models.Product, frequency string) bool {
+	if strings.TrimSpace(product.SubscriptionPeriod) == "" {
+		return true
+	}
+	for _, period := range strings.Split(product.SubscriptionPeriod, ",") {
+		if strings.TrimSpace(period) == frequency {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptionPrice is the farmer's per-period price, falling back to the
+// one-off price when none is set.
+func subscriptionPrice(product models.Product, frequency string) float64 {
+	switch {
+	case frequency == "weekly" && product.SubscriptionPriceWeekly > 0:
+		return product.SubscriptionPriceWeekly
+	case frequency == "monthly" && product.SubscriptionPriceMonthly > 0:
+		return product.SubscriptionPriceMonthly
+	}
+	return product.Price
+}
+
+// nextDeliveryAfter returns the delivery date one period after t.
+func nextDeliveryAfter(t time.Time, frequency string) time.Time {
+	if frequency == "monthly" {
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 7)
+}
+
+// subscriptionNextDelivery treats subscriptions created before scheduling
+// existed as starting their deliveries on StartDate.
+func subscriptionNextDelivery(sub models.Subscription) time.Time {
+	if sub.NextDeliveryAt != nil {
+		return *sub.NextDeliveryAt
+	}
+	return sub.StartDate
+}
+
+// upcomingDeliveries lists every remaining delivery date before EndDate.
+func upcomingDeliveries(sub models.Subscription) []time.Time {
+	var dates []time.Time
+	for next := subscriptionNextDelivery(sub); next.Before(sub.EndDate); next = nextDeliveryAfter(next, sub.Frequency) {
+		dates = append(dates, next)
+	}
+	return dates
+}
+
 // Helpers
+// reservesHarvest reports whether orders for the product reserve against its
+// expected harvest. Pre-orders without one (created before reservations
+// existed) still sell from stock.
+func reservesHarvest(p models.Product) bool {
+	return p.IsPreOrder && p.HarvestQuantity > 0
+}
+
+// availableQuantity is how much of the product can still be ordered.
+func availableQuantity(p models.Product) int {
+	if reservesHarvest(p) {
+		return p.HarvestQuantity - p.ReservedQuantity
+	}
+	return p.Stock
+}
+
 func mapOrderToResponse(o models.Order) dto.OrderResponse {
 	var itemResponses []dto.OrderItemResponse
 	for _, item := range o.OrderItems {
@@ -210,28 +606,70 @@ func mapOrderToResponse(o models.Order) dto.OrderResponse {
 			productName = "Product #" + strconv.FormatUint(uint64(item.ProductID), 10)
 		}
 		itemResponses = append(itemResponses, dto.OrderItemResponse{
-			ProductID:   item.ProductID,
-			ProductName: productName,
-			Quantity:    item.Quantity,
-			Price:       item.Price,
-			SubTotal:    item.Price * float64(item.Quantity),
+			ID:            item.ID,
+			ProductID:     item.ProductID,
+			FulfillmentID: item.FulfillmentID,
+			ProductName:   productName,
+			Quantity:      item.Quantity,
+			Price:         item.Price,
+			SubTotal:      item.Price * float64(item.Quantity),
+
+			RefundedQuantity: item.RefundedQuantity,
 		})
 	}
 
-	return dto.OrderResponse{
-		ID:           o.ID,
-		UserID:       o.UserID,
-		TotalPrice:   o.TotalPrice,
-		Status:       o.Status,
-		Type:         o.Type,
-		PaymentProof: o.PaymentProof,
-		Items:        itemResponses,
-		CreatedAt:    o.CreatedAt.Format("2006-01-02 15:04:05"),
+	var fulfillmentResponses []dto.FulfillmentResponse
+	for _, f := range o.Fulfillments {
+		var shippedAt string
+		if f.ShippedAt != nil {
+			shippedAt = f.ShippedAt.Format("2006-01-02 15:04:05")
+		}
+		commission := 0.0
+		for _, fee := range o.Fees {
+			if fee.Type == "commission" && fee.FulfillmentID != nil && *fee.FulfillmentID == f.ID {
+				commission += fee.Amount
+			}
+		}
+		fulfillmentResponses = append(fulfillmentResponses, dto.FulfillmentResponse{
+			ID:           f.ID,
+			FarmerID:     f.FarmerID,
+			Status:       f.Status,
+			SubTotal:     f.SubTotal,
+			ShippingCost: f.ShippingCost,
+			Commission:   roundMoney(commission),
+			ShippedAt:    shippedAt,
+		})
 	}
+
+	var feeResponses []dto.OrderFeeResponse
+	for _, fee := range o.Fees {
+		feeResponses = append(feeResponses, mapOrderFeeToResponse(fee))
+	}
+
+	res := dto.OrderResponse{
+		ID:            o.ID,
+		UserID:        o.UserID,
+		TotalPrice:    o.TotalPrice,
+		DepositAmount: o.DepositAmount,
+		AmountPaid:    o.AmountPaid,
+		RefundDue:     o.RefundDue,
+		ServiceFee:    o.ServiceFee,
+		Status:        o.Status,
+		Type:          o.Type,
+		PaymentProof:  o.PaymentProof,
+		Items:         itemResponses,
+		Fulfillments:  fulfillmentResponses,
+		Fees:          feeResponses,
+		CreatedAt:     o.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if o.HarvestChangedAt != nil {
+		res.HarvestChangedAt = o.HarvestChangedAt.Format("2006-01-02 15:04:05")
+	}
+	return res
 }
 
 func mapSubscriptionToResponse(s models.Subscription) dto.SubscriptionResponse {
-	return dto.SubscriptionResponse{
+	res := dto.SubscriptionResponse{
 		ID:          s.ID,
 		UserID:      s.UserID,
 		ProductName: s.Product.Name,
@@ -239,5 +677,11 @@ func mapSubscriptionToResponse(s models.Subscription) dto.SubscriptionResponse {
 		StartDate:   s.StartDate.Format("2006-01-02"),
 		EndDate:     s.EndDate.Format("2006-01-02"),
 		Status:      s.Status,
+		Quantity:    s.Quantity,
+		Price:       s.Price,
+	}
+	if s.Status == "active" {
+		res.NextDelivery = subscriptionNextDelivery(s).Format("2006-01-02")
 	}
+	return res
 }
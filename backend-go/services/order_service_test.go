@@ -1,12 +1,14 @@
 package services
 
 import (
+	"errors"
 	"smartfarm-api/config"
 	"smartfarm-api/dto"
 	"smartfarm-api/models"
 	"smartfarm-api/repositories"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -70,7 +72,7 @@ func TestConcurrentOrders_RaceCondition(t *testing.T) {
 	// Initialize services
 	orderRepo := repositories.NewOrderRepository(db)
 	productRepo := repositories.NewProductRepository(db)
-	orderService := NewOrderService(orderRepo, productRepo)
+	orderService := NewOrderService(orderRepo, productRepo, repositories.NewLedgerRepository(config.DB), repositories.NewFeeRepository(config.DB))
 
 	// Simulate 2 concurrent orders
 	var wg sync.WaitGroup
@@ -173,7 +175,7 @@ func TestHighConcurrency_MultipleProducts(t *testing.T) {
 	// Initialize services
 	orderRepo := repositories.NewOrderRepository(db)
 	productRepo := repositories.NewProductRepository(db)
-	orderService := NewOrderService(orderRepo, productRepo)
+	orderService := NewOrderService(orderRepo, productRepo, repositories.NewLedgerRepository(config.DB), repositories.NewFeeRepository(config.DB))
 
 	// Simulate 20 concurrent orders (each ordering 1 item)
 	// Expected: 10 succeed, 10 fail
@@ -231,3 +233,238 @@ func TestHighConcurrency_MultipleProducts(t *testing.T) {
 
 	t.Log("✅ High Concurrency Test PASSED - System handles 20 concurrent requests correctly!")
 }
+
+// TestOrderTransitions checks the order status state machine without a database
+func TestOrderTransitions(t *testing.T) {
+	allowed := [][2]string{
+		{"pending", "paid"},
+		{"pending", "cancelled"},
+		{"paid", "shipped"},
+		{"paid", "cancelled"},
+		{"shipped", "completed"},
+	}
+	for _, tr := range allowed {
+		assert.True(t, canTransitionOrder(tr[0], tr[1]), "%s -> %s should be allowed", tr[0], tr[1])
+	}
+
+	rejected := [][2]string{
+		{"completed", "pending"},
+		{"cancelled", "paid"},
+		{"shipped", "cancelled"},
+		{"pending", "shipped"},
+		{"paid", "pending"},
+	}
+	for _, tr := range rejected {
+		assert.False(t, canTransitionOrder(tr[0], tr[1]), "%s -> %s should be rejected", tr[0], tr[1])
+	}
+
+	// A refused move writes nothing, so a late webhook may ignore it; other errors may not be ignored
+	err := changeOrderStatus(nil, nil, &models.Order{Status: "completed"}, "paid", systemActor, "")
+	assert.True(t, isInvalidTransition(err))
+	assert.False(t, isInvalidTransition(errors.New("Error 1205: Lock wait timeout exceeded")))
+}
+
+// TestAuthorizeOrderTransition checks role and ownership rules for status changes
+func TestAuthorizeOrderTransition(t *testing.T) {
+	order := models.Order{
+		ID:     1,
+		UserID: 10,
+		Status: "pending",
+		OrderItems: []models.OrderItem{
+			{ProductID: 1, Product: models.Product{ID: 1, FarmerID: 20}},
+		},
+	}
+
+	buyer := OrderActor{UserID: 10, Role: "pembeli"}
+	otherBuyer := OrderActor{UserID: 11, Role: "pembeli"}
+	farmer := OrderActor{UserID: 20, Role: "petani"}
+	otherFarmer := OrderActor{UserID: 21, Role: "petani"}
+	admin := OrderActor{UserID: 1, Role: "admin"}
+
+	assert.NoError(t, authorizeOrderTransition(order, "cancelled", buyer))
+	assert.Error(t, authorizeOrderTransition(order, "cancelled", otherBuyer))
+	assert.NoError(t, authorizeOrderTransition(order, "shipped", farmer))
+	assert.Error(t, authorizeOrderTransition(order, "shipped", otherFarmer))
+	assert.Error(t, authorizeOrderTransition(order, "shipped", buyer))
+	assert.Error(t, authorizeOrderTransition(order, "completed", farmer))
+	assert.NoError(t, authorizeOrderTransition(order, "completed", buyer))
+	assert.NoError(t, authorizeOrderTransition(order, "shipped", admin))
+
+	order.Status = "paid"
+	assert.Error(t, authorizeOrderTransition(order, "cancelled", buyer), "buyer cannot cancel after paying")
+	assert.NoError(t, authorizeOrderTransition(order, "cancelled", farmer))
+}
+
+// TestCancelOrder_RestocksOnce tests that cancelling returns stock exactly once
+func TestCancelOrder_RestocksOnce(t *testing.T) {
+	db := config.DB
+	if db == nil {
+		t.Skip("Database not available for testing")
+	}
+
+	testProduct := models.Product{
+		Name:     "Test Product - Restock",
+		Price:    25000,
+		Stock:    5,
+		Category: "Test",
+		FarmerID: 1,
+		ImageURL: "test.jpg",
+	}
+	db.Create(&testProduct)
+
+	buyer := models.User{Name: "Test Restock Buyer", Email: "testrestock@race.com", Password: "hashed", Role: "pembeli"}
+	db.Create(&buyer)
+
+	orderService := NewOrderService(repositories.NewOrderRepository(db), repositories.NewProductRepository(db), repositories.NewLedgerRepository(db), repositories.NewFeeRepository(db))
+
+	order, err := orderService.CreateOrder(dto.CreateOrderRequest{
+		Items: []dto.OrderItemRequest{{ProductID: testProduct.ID, Quantity: 3}},
+	}, buyer.ID)
+	assert.NoError(t, err)
+
+	actor := OrderActor{UserID: buyer.ID, Role: "pembeli"}
+	_, err = orderService.CancelOrder(order.ID, actor, "changed my mind")
+	assert.NoError(t, err)
+
+	// Cancelling again (e.g. a replayed webhook) must not restock twice
+	_, err = orderService.CancelOrder(order.ID, actor, "")
+	assert.NoError(t, err)
+
+	var updatedProduct models.Product
+	db.First(&updatedProduct, testProduct.ID)
+	assert.Equal(t, 5, updatedProduct.Stock, "Stock should be fully restored exactly once")
+
+	// Clean up
+	db.Exec("DELETE FROM order_status_logs WHERE order_id = ?", order.ID)
+	db.Exec("DELETE FROM order_fees WHERE order_id = ?", order.ID)
+	db.Exec("DELETE FROM order_items WHERE order_id = ?", order.ID)
+	db.Exec("DELETE FROM order_fulfillments WHERE order_id = ?", order.ID)
+	db.Exec("DELETE FROM orders WHERE id = ?", order.ID)
+	db.Exec("DELETE FROM products WHERE id = ?", testProduct.ID)
+	db.Exec("DELETE FROM users WHERE id = ?", buyer.ID)
+}
+
+// TestAggregateFulfillmentStatus checks how farmer fulfillments drive the parent order status
+func TestAggregateFulfillmentStatus(t *testing.T) {
+	order := models.Order{
+		Status: "paid",
+		Fulfillments: []models.OrderFulfillment{
+			{FarmerID: 1, Status: "shipped"},
+			{FarmerID: 2, Status: "paid"},
+		},
+	}
+	assert.Equal(t, "paid", aggregateFulfillmentStatus(order), "order waits for every farmer to ship")
+
+	order.Fulfillments[1].Status = "shipped"
+	assert.Equal(t, "shipped", aggregateFulfillmentStatus(order))
+
+	order.Fulfillments[1].Status = "cancelled"
+	order.Fulfillments[0].Status = "shipped"
+	assert.Equal(t, "shipped", aggregateFulfillmentStatus(order), "cancelled fulfillments are ignored")
+
+	order.Fulfillments[0].Status = "cancelled"
+	assert.Equal(t, "cancelled", aggregateFulfillmentStatus(order))
+}
+
+// TestUpcomingDeliveries checks the delivery calendar stops before EndDate
+func TestUpcomingDeliveries(t *testing.T) {
+	start := time.Date(2026, 1, 5, 8, 0, 0, 0, time.UTC)
+
+	weekly := models.Subscription{Frequency: "weekly", StartDate: start, EndDate: start.AddDate(0, 0, 4*7)}
+	dates := upcomingDeliveries(weekly)
+	assert.Len(t, dates, 4)
+	assert.Equal(t, start, dates[0])
+	assert.Equal(t, start.AddDate(0, 0, 21), dates[3])
+
+	next := start.AddDate(0, 1, 0)
+	monthly := models.Subscription{Frequency: "monthly", StartDate: start, EndDate: start.AddDate(0, 3, 0), NextDeliveryAt: &next}
+	dates = upcomingDeliveries(monthly)
+	assert.Len(t, dates, 2, "deliveries already made are not listed")
+	assert.Equal(t, next, dates[0])
+}
+
+// TestResumeSubscription_ShiftsSchedule checks EndDate moves by the paused time
+func TestResumeSubscription_ShiftsSchedule(t *testing.T) {
+	start := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	next := start.AddDate(0, 0, 7)
+	pausedAt := start.AddDate(0, 0, 3)
+
+	sub := models.Subscription{
+		Frequency:      "weekly",
+		StartDate:      start,
+		EndDate:        start.AddDate(0, 0, 28),
+		NextDeliveryAt: &next,
+		Status:         "paused",
+		PausedAt:       &pausedAt,
+	}
+
+	resumeSubscription(&sub, pausedAt.AddDate(0, 0, 10))
+
+	assert.Equal(t, "active", sub.Status)
+	assert.Nil(t, sub.PausedAt)
+	assert.Equal(t, next.AddDate(0, 0, 10), *sub.NextDeliveryAt)
+	assert.Equal(t, start.AddDate(0, 0, 38), sub.EndDate)
+	assert.Len(t, upcomingDeliveries(sub), 3, "the remaining deliveries are kept")
+}
+
+// TestSubscriptionPeriodAndPrice checks farmer-configured periods and prices
+func TestSubscriptionPeriodAndPrice(t *testing.T) {
+	weeklyOnly := models.Product{Price: 20000, IsSubscription: true, SubscriptionPeriod: "weekly", SubscriptionPriceWeekly: 18000}
+	assert.True(t, subscriptionAllowsPeriod(weeklyOnly, "weekly"))
+	assert.False(t, subscriptionAllowsPeriod(weeklyOnly, "monthly"))
+	assert.Equal(t, float64(18000), subscriptionPrice(weeklyOnly, "weekly"))
+
+	both := models.Product{Price: 20000, IsSubscription: true, SubscriptionPeriod: "weekly, monthly"}
+	assert.True(t, subscriptionAllowsPeriod(both, "monthly"))
+	assert.Equal(t, float64(20000), subscriptionPrice(both, "monthly"), "falls back to the one-off price")
+
+	assert.Error(t, validateSubscriptionSettings(dto.CreateProductRequest{IsSubscription: true, SubscriptionPeriod: "daily"}))
+	assert.Error(t, validateSubscriptionSettings(dto.CreateProductRequest{IsSubscription: true, SubscriptionPeriod: "weekly", SubscriptionPriceWeekly: -1}))
+	assert.NoError(t, validateSubscriptionSettings(dto.CreateProductRequest{IsSubscription: true, SubscriptionPeriod: "weekly,monthly"}))
+}
+
+func TestPreOrderReservation(t *testing.T) {
+	preOrder := models.Product{IsPreOrder: true, Stock: 0, HarvestQuantity: 50, ReservedQuantity: 20}
+	assert.True(t, reservesHarvest(preOrder))
+	assert.Equal(t, 30, availableQuantity(preOrder))
+
+	// Pre-orders without an expected harvest keep selling from stock
+	legacy := models.Product{IsPreOrder: true, Stock: 7}
+	assert.False(t, reservesHarvest(legacy))
+	assert.Equal(t, 7, availableQuantity(legacy))
+
+	assert.True(t, canTransitionOrder("pending", "reserved"))
+	assert.True(t, canTransitionOrder("reserved", "paid"))
+	assert.False(t, canTransitionOrder("reserved", "shipped"))
+
+	deposit := models.Order{TotalPrice: 100000, DepositAmount: 30000, AmountPaid: 30000}
+	assert.Equal(t, "reserved", paidStatusFor(deposit))
+	deposit.AmountPaid = 100000
+	assert.Equal(t, "paid", paidStatusFor(deposit))
+	assert.Equal(t, "paid", paidStatusFor(models.Order{TotalPrice: 100000, AmountPaid: 100000}))
+
+	// Buyers may cancel a reserved order only after the harvest date moved
+	buyer := OrderActor{UserID: 5, Role: "pembeli"}
+	reserved := models.Order{UserID: 5, Status: "reserved"}
+	assert.Error(t, authorizeOrderTransition(reserved, "cancelled", buyer))
+	changedAt := time.Now()
+	reserved.HarvestChangedAt = &changedAt
+	assert.NoError(t, authorizeOrderTransition(reserved, "cancelled", buyer))
+}
+
+func TestValidateProductEdit(t *testing.T) {
+	harvest := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	product := models.Product{IsPreOrder: true, HarvestQuantity: 50, ReservedQuantity: 20, HarvestDate: &harvest}
+	sameDay := harvest
+	otherDay := harvest.AddDate(0, 0, 7)
+
+	assert.NoError(t, validateProductEdit(product, dto.CreateProductRequest{IsPreOrder: true, HarvestQuantity: 20}, &sameDay))
+	assert.NoError(t, validateProductEdit(product, dto.CreateProductRequest{IsPreOrder: true, HarvestQuantity: 60}, nil))
+	assert.Error(t, validateProductEdit(product, dto.CreateProductRequest{IsPreOrder: true, HarvestQuantity: 19}, nil), "below what is reserved")
+	assert.Error(t, validateProductEdit(product, dto.CreateProductRequest{IsPreOrder: false}, nil), "reservations are held")
+	assert.Error(t, validateProductEdit(product, dto.CreateProductRequest{IsPreOrder: true, HarvestQuantity: 50}, &otherDay), "dates move through a reschedule")
+
+	// The first harvest date is set on the form
+	product.HarvestDate = nil
+	assert.NoError(t, validateProductEdit(product, dto.CreateProductRequest{IsPreOrder: true, HarvestQuantity: 50}, &otherDay))
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"smartfarm-api/models"
+	"smartfarm-api/policies"
+	"smartfarm-api/repositories"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OrderActor identifies who is changing an order's status.
+type OrderActor = policies.Actor
+
+// systemActor is used for changes made by payment webhooks and background jobs.
+var systemActor = OrderActor{Role: "system"}
+
+// orderTransitions lists the statuses an order (or a farmer's fulfillment of
+// it) may move to from each status. Cancelled and refunded are final.
+// Reserved is a pre-order whose deposit is paid but whose balance is not.
+var orderTransitions = map[string][]string{
+	"pending":   {"reserved", "paid", "cancelled"},
+	"reserved":  {"paid", "cancelled", "refunded"},
+	"paid":      {"shipped", "cancelled", "refunded"},
+	"shipped":   {"completed", "refunded"},
+	"completed": {"refunded"},
+	"cancelled": {},
+	"refunded":  {},
+}
+
+func canTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeOrderTransition checks that the actor may move the order to the
+// given status. Admins may make any legal move; farmers act on orders that
+// contain their products and buyers act on their own orders.
+func authorizeOrderTransition(order models.Order, to string, actor OrderActor) error {
+	if actor.Role == "admin" {
+		return nil
+	}
+
+	isBuyer := policies.IsOrderBuyer(actor, order)
+	isFarmer := policies.IsOrderFarmer(actor, order)
+
+	switch to {
+	case "shipped":
+		if isFarmer {
+			return nil
+		}
+	case "completed":
+		if isBuyer {
+			return nil
+		}
+	case "cancelled":
+		// Buyers can only back out before paying, or after the farmer moved the
+		// harvest date of a pre-order; farmers may also cancel a paid order they cannot fulfil
+		if isBuyer && order.Status == "pending" {
+			return nil
+		}
+		if isBuyer && order.HarvestChangedAt != nil && (order.Status == "reserved" || order.Status == "paid") {
+			return nil
+		}
+		if isFarmer {
+			return nil
+		}
+	}
+
+	return policies.ErrForbidden
+}
+
+// changeOrderStatus validates the move against orderTransitions, saves the new
+// status, moves every fulfillment along with it and records who made the
+// change. Cancelling an order also returns its items to stock. The order must
+// already be locked by the transaction both repositories are bound to. Setting
+// the current status again is a no-op so replayed webhooks are harmless.
+func changeOrderStatus(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, order *models.Order, to string, actor OrderActor, note string) error {
+	from := order.Status
+	if from == to {
+		return nil
+	}
+
+	if !canTransitionOrder(from, to) {
+		return fmt.Errorf("invalid status transition: %s -> %s", from, to)
+	}
+
+	if err := syncFulfillments(order, to); err != nil {
+		return err
+	}
+
+	if err := orderRepo.UpdateStatus(order.ID, to); err != nil {
+		return err
+	}
+	order.Status = to
+
+	log.Printf("[ORDER] Order %d status %s -> %s by %s %d", order.ID, from, to, actor.Role, actor.UserID)
+
+	if to == "cancelled" {
+		if err := restockOrder(orderRepo, productRepo, order); err != nil {
+			return err
+		}
+		if err := markRefundDue(orderRepo, order, from); err != nil {
+			return err
+		}
+	}
+
+	for i := range order.Fulfillments {
+		if err := orderRepo.SaveFulfillment(&order.Fulfillments[i]); err != nil {
+			return err
+		}
+	}
+
+	return orderRepo.CreateStatusLog(&models.OrderStatusLog{
+		OrderID:    order.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actor.UserID,
+		ActorRole:  actor.Role,
+		Note:       note,
+	})
+}
+
+// isInvalidTransition reports whether changeOrderStatus refused the move,
+// which it does before writing anything.
+func isInvalidTransition(err error) bool {
+	return strings.HasPrefix(err.Error(), "invalid status transition")
+}
+
+// syncFulfillments moves every fulfillment that is not cancelled or refunded
+// to the order's new status. It fails if one of them cannot follow, e.g. cancelling
+// an order where one farmer already shipped.
+func syncFulfillments(order *models.Order, to string) error {
+	now := time.Now()
+	for i := range order.Fulfillments {
+		f := &order.Fulfillments[i]
+		if f.Status == to || f.Status == "cancelled" || f.Status == "refunded" {
+			continue
+		}
+		if !canTransitionOrder(f.Status, to) {
+			return fmt.Errorf("invalid status transition: %s -> %s (fulfillment %d)", f.Status, to, f.ID)
+		}
+		f.Status = to
+		if to == "shipped" {
+			f.ShippedAt = &now
+		}
+	}
+	return nil
+}
+
+// changeFarmerFulfillments moves only the farmer's own fulfillments and then
+// lets the parent order follow once every remaining fulfillment agrees.
+func changeFarmerFulfillments(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, order *models.Order, farmerID uint, to string, actor OrderActor, note string) error {
+	now := time.Now()
+	changed := false
+
+	for i := range order.Fulfillments {
+		f := &order.Fulfillments[i]
+		if f.FarmerID != farmerID || f.Status == to {
+			continue
+		}
+
+		from := f.Status
+		if !canTransitionOrder(from, to) {
+			return fmt.Errorf("invalid status transition: %s -> %s", from, to)
+		}
+
+		f.Status = to
+		switch to {
+		case "shipped":
+			f.ShippedAt = &now
+		case "cancelled":
+			if err := restockFulfillment(productRepo, order, f); err != nil {
+				return err
+			}
+		}
+
+		if err := orderRepo.SaveFulfillment(f); err != nil {
+			return err
+		}
+
+		log.Printf("[ORDER] Order %d fulfillment %d status %s -> %s by %s %d", order.ID, f.ID, from, to, actor.Role, actor.UserID)
+
+		fulfillmentID := f.ID
+		if err := orderRepo.CreateStatusLog(&models.OrderStatusLog{
+			OrderID:       order.ID,
+			FulfillmentID: &fulfillmentID,
+			FromStatus:    from,
+			ToStatus:      to,
+			ActorID:       actor.UserID,
+			ActorRole:     actor.Role,
+			Note:          note,
+		}); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return changeOrderStatus(orderRepo, productRepo, order, aggregateFulfillmentStatus(*order), actor, note)
+}
+
+// aggregateFulfillmentStatus derives the parent order status: cancelled (or
+// refunded) when no fulfillment is left to deliver, otherwise the shared
+// status of the remaining fulfillments, or the current order status while they
+// still differ.
+func aggregateFulfillmentStatus(order models.Order) string {
+	status := ""
+	refunded := false
+	for _, f := range order.Fulfillments {
+		if f.Status == "refunded" {
+			refunded = true
+			continue
+		}
+		if f.Status == "cancelled" {
+			continue
+		}
+		if status == "" {
+			status = f.Status
+		} else if status != f.Status {
+			return order.Status
+		}
+	}
+
+	if status == "" {
+		if refunded {
+			return "refunded"
+		}
+		return "cancelled"
+	}
+	return status
+}
+
+// restockOrder returns the items of a cancelled order to stock, locking the
+// product rows the same way CreateOrder does. RestockedAt on the order and on
+// each fulfillment guards against restocking anything twice. Fulfillment
+// changes are saved by the caller.
+func restockOrder(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, order *models.Order) error {
+	if order.RestockedAt != nil {
+		return nil
+	}
+
+	// Orders created before fulfillments existed are restocked as a whole
+	if len(order.Fulfillments) == 0 {
+		if err := restockItems(productRepo, order.ID, order.OrderItems); err != nil {
+			return err
+		}
+	}
+
+	for i := range order.Fulfillments {
+		f := &order.Fulfillments[i]
+		if f.Status != "cancelled" {
+			continue
+		}
+		if err := restockFulfillment(productRepo, order, f); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if err := orderRepo.MarkRestocked(order.ID, now); err != nil {
+		return err
+	}
+	order.RestockedAt = &now
+	return nil
+}
+
+func restockFulfillment(productRepo repositories.ProductRepository, order *models.Order, f *models.OrderFulfillment) error {
+	if f.RestockedAt != nil {
+		return nil
+	}
+
+	var items []models.OrderItem
+	for _, item := range order.OrderItems {
+		if item.FulfillmentID != nil && *item.FulfillmentID == f.ID {
+			items = append(items, item)
+		}
+	}
+
+	if err := restockItems(productRepo, order.ID, items); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	f.RestockedAt = &now
+	return nil
+}
+
+func restockItems(productRepo repositories.ProductRepository, orderID uint, orderItems []models.OrderItem) error {
+	// Lock products in ID order so two cancellations cannot deadlock each other
+	items := make([]models.OrderItem, len(orderItems))
+	copy(items, orderItems)
+	sort.Slice(items, func(i, j int) bool { return items[i].ProductID < items[j].ProductID })
+
+	for _, item := range items {
+		product, err := productRepo.FindByIDForUpdate(item.ProductID)
+		if err != nil {
+			log.Printf("[RESTOCK] Product %d of order %d no longer exists, skipping", item.ProductID, orderID)
+			continue
+		}
+
+		// Reservations go back to the expected harvest, not to stock
+		if item.IsReservation {
+			product.ReservedQuantity -= item.Quantity
+			if product.ReservedQuantity < 0 {
+				product.ReservedQuantity = 0
+			}
+		} else {
+			product.Stock += item.Quantity
+		}
+		if err := productRepo.Update(&product); err != nil {
+			return err
+		}
+		log.Printf("[RESTOCK] Product %d released %d for order %d (Stock: %d, Reserved: %d)",
+			product.ID, item.Quantity, orderID, product.Stock, product.ReservedQuantity)
+	}
+	return nil
+}
+
+// markRefundDue records what has to be paid back when an order is cancelled
+// after the buyer paid part or all of it.
+func markRefundDue(orderRepo repositories.OrderRepository, order *models.Order, from string) error {
+	if from != "reserved" && from != "paid" {
+		return nil
+	}
+
+	refund := order.AmountPaid
+	// Orders paid before AmountPaid was tracked were paid in full
+	if refund == 0 {
+		refund = order.TotalPrice
+	}
+	// Added to what may already be due, e.g. for a superseded attempt paid anyway
+	order.RefundDue += refund
+
+	log.Printf("[ORDER] Order %d cancelled after payment, refund due: %.2f", order.ID, order.RefundDue)
+	return orderRepo.SetRefundDue(order.ID, order.RefundDue)
+}
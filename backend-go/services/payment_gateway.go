@@ -0,0 +1,69 @@
+package services
+
+import (
+	"log"
+	"os"
+	"smartfarm-api/dto"
+	"strings"
+)
+
+// PaymentGateway is the payment provider behind /payments. Statuses and
+// notifications use Midtrans' notification shape, which the fake gateway
+// imitates so the webhook path is the same for both. GetStatus fails with
+// "transaction not found" when the gateway has never seen the transaction.
+// Cancel stops a charge the buyer has not paid yet so it can no longer be paid.
+type PaymentGateway interface {
+	Name() string
+	CreateCharge(charge PaymentCharge) (PaymentChargeResult, error)
+	GetStatus(transactionID string) (dto.PaymentWebhookRequest, error)
+	Refund(transactionID string, amount float64, reason string) error
+	Cancel(transactionID string) error
+	VerifyNotification(req dto.PaymentWebhookRequest) bool
+}
+
+// PaymentCharge is what the gateway needs to start collecting a payment.
+type PaymentCharge struct {
+	TransactionID string
+	OrderID       uint
+	Amount        float64 // whole rupiah
+	CustomerName  string
+	CustomerPhone string
+}
+
+type PaymentChargeResult struct {
+	Token       string
+	RedirectURL string
+}
+
+// NewPaymentGatewayFromEnv picks the gateway from PAYMENT_GATEWAY ("midtrans"
+// or "fake"). When it is unset, Midtrans is used and MIDTRANS_SERVER_KEY is
+// required.
+func NewPaymentGatewayFromEnv() PaymentGateway {
+	serverKey := strings.TrimSpace(os.Getenv("MIDTRANS_SERVER_KEY"))
+
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("PAYMENT_GATEWAY")))
+	// The fake settles charges without collecting money, so it must be asked
+	// for rather than picked because the Midtrans key is missing
+	if name == "" {
+		if serverKey == "" {
+			log.Fatal("❌ MIDTRANS_SERVER_KEY is not set: set it, or PAYMENT_GATEWAY=fake for local testing")
+		}
+		name = "midtrans"
+	}
+
+	switch name {
+	case "midtrans":
+		if serverKey == "" {
+			log.Fatal("❌ PAYMENT_GATEWAY=midtrans but MIDTRANS_SERVER_KEY is not set")
+		}
+		production := os.Getenv("MIDTRANS_ENV") == "production"
+		log.Printf("[PaymentGateway] Using Midtrans (production: %v)", production)
+		return NewMidtransGateway(serverKey, production)
+	case "fake":
+		log.Println("🛠️ [PaymentGateway] Using the local fake gateway, no real money is collected")
+		return NewFakeGatewayFromEnv()
+	default:
+		log.Fatalf("❌ unknown PAYMENT_GATEWAY %q: use midtrans or fake", name)
+		return nil
+	}
+}
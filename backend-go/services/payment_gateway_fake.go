@@ -0,0 +1,200 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"smartfarm-api/dto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeGateway is an in-process stand-in for Midtrans. Every charge is settled
+// (or failed, see PAYMENT_FAKE_OUTCOME) by posting a signed Midtrans-style
+// notification to our own webhook, so checkout can be tested end to end
+// without network access.
+type fakeGateway struct {
+	serverKey  string
+	webhookURL string
+	outcome    string
+	delay      time.Duration
+	client     *http.Client
+
+	mu           sync.Mutex
+	transactions map[string]*dto.PaymentWebhookRequest
+}
+
+// NewFakeGatewayFromEnv reads PAYMENT_FAKE_WEBHOOK_URL (default
+// http://localhost:8080/payments/webhook), PAYMENT_FAKE_OUTCOME (settlement,
+// deny, expire or none to leave charges pending), PAYMENT_FAKE_DELAY (2s) and
+// PAYMENT_FAKE_SERVER_KEY, the key the notifications are signed with.
+func NewFakeGatewayFromEnv() PaymentGateway {
+	webhookURL := os.Getenv("PAYMENT_FAKE_WEBHOOK_URL")
+	if webhookURL == "" {
+		webhookURL = "http://localhost:8080/payments/webhook"
+	}
+	outcome := os.Getenv("PAYMENT_FAKE_OUTCOME")
+	if outcome == "" {
+		outcome = "settlement"
+	}
+	serverKey := os.Getenv("PAYMENT_FAKE_SERVER_KEY")
+	if serverKey == "" {
+		serverKey = "fake-server-key"
+	}
+
+	return NewFakeGateway(serverKey, webhookURL, outcome, durationFromEnv("PAYMENT_FAKE_DELAY", 2*time.Second))
+}
+
+func NewFakeGateway(serverKey, webhookURL, outcome string, delay time.Duration) *fakeGateway {
+	return &fakeGateway{
+		serverKey:    serverKey,
+		webhookURL:   webhookURL,
+		outcome:      outcome,
+		delay:        delay,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		transactions: map[string]*dto.PaymentWebhookRequest{},
+	}
+}
+
+func (g *fakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *fakeGateway) CreateCharge(charge PaymentCharge) (PaymentChargeResult, error) {
+	token := "fake-token-" + charge.TransactionID
+
+	g.mu.Lock()
+	g.transactions[charge.TransactionID] = &dto.PaymentWebhookRequest{
+		TransactionTime:   time.Now().Format("2006-01-02 15:04:05"),
+		TransactionID:     token,
+		StatusCode:        "201",
+		OrderID:           charge.TransactionID,
+		GrossAmount:       fmt.Sprintf("%.2f", charge.Amount),
+		PaymentType:       "fake",
+		TransactionStatus: "pending",
+	}
+	g.mu.Unlock()
+
+	if g.outcome != "none" {
+		go func() {
+			time.Sleep(g.delay)
+			if status, err := g.GetStatus(charge.TransactionID); err == nil && status.TransactionStatus != "pending" {
+				return
+			}
+			if err := g.Emit(charge.TransactionID, g.outcome); err != nil {
+				log.Printf("[FakeGateway] Failed to deliver %s for %s: %v", g.outcome, charge.TransactionID, err)
+			}
+		}()
+	}
+
+	return PaymentChargeResult{Token: token, RedirectURL: g.webhookURL}, nil
+}
+
+func (g *fakeGateway) GetStatus(transactionID string) (dto.PaymentWebhookRequest, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tx, ok := g.transactions[transactionID]
+	if !ok {
+		return dto.PaymentWebhookRequest{}, errors.New("transaction not found")
+	}
+	return *tx, nil
+}
+
+func (g *fakeGateway) Refund(transactionID string, amount float64, reason string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tx, ok := g.transactions[transactionID]
+	if !ok {
+		return errors.New("transaction not found")
+	}
+	if tx.TransactionStatus != "settlement" && tx.TransactionStatus != "partial_refund" {
+		return fmt.Errorf("cannot refund a %s transaction", tx.TransactionStatus)
+	}
+
+	log.Printf("[FakeGateway] Refunded %.2f of %s: %s", amount, transactionID, reason)
+	tx.TransactionStatus = "partial_refund"
+	return nil
+}
+
+func (g *fakeGateway) Cancel(transactionID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tx, ok := g.transactions[transactionID]
+	if !ok {
+		return errors.New("transaction not found")
+	}
+	if tx.TransactionStatus != "pending" {
+		return fmt.Errorf("transaction is %s, not pending", tx.TransactionStatus)
+	}
+	tx.TransactionStatus = "expire"
+	tx.StatusCode = fakeStatusCode("expire")
+	log.Printf("[FakeGateway] Cancelled %s", transactionID)
+	return nil
+}
+
+func (g *fakeGateway) VerifyNotification(req dto.PaymentWebhookRequest) bool {
+	return verifyMidtransSignature(req, g.serverKey)
+}
+
+// Emit moves the transaction to the given Midtrans status and posts the signed
+// notification to the webhook URL.
+func (g *fakeGateway) Emit(transactionID string, status string) error {
+	g.mu.Lock()
+	tx, ok := g.transactions[transactionID]
+	if !ok {
+		g.mu.Unlock()
+		return errors.New("transaction not found")
+	}
+	tx.TransactionStatus = status
+	tx.StatusCode = fakeStatusCode(status)
+	if status == "capture" {
+		tx.FraudStatus = "accept"
+	}
+	tx.TransactionTime = time.Now().Format("2006-01-02 15:04:05")
+	tx.SignatureKey = g.sign(*tx)
+	notification := *tx
+	g.mu.Unlock()
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	resp, err := g.client.Post(g.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	log.Printf("[FakeGateway] Delivered %s for %s", status, transactionID)
+	return nil
+}
+
+func (g *fakeGateway) sign(req dto.PaymentWebhookRequest) string {
+	sum := sha512.Sum512([]byte(req.OrderID + req.StatusCode + req.GrossAmount + g.serverKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func fakeStatusCode(status string) string {
+	switch strings.ToLower(status) {
+	case "settlement", "capture":
+		return "200"
+	case "pending":
+		return "201"
+	default:
+		return "202"
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"smartfarm-api/dto"
+
+	"github.com/midtrans/midtrans-go"
+	"github.com/midtrans/midtrans-go/coreapi"
+	"github.com/midtrans/midtrans-go/snap"
+)
+
+// midtransGateway charges through Snap and uses the Core API for status
+// checks and refunds.
+type midtransGateway struct {
+	serverKey string
+	snap      snap.Client
+	core      coreapi.Client
+}
+
+func NewMidtransGateway(serverKey string, production bool) PaymentGateway {
+	env := midtrans.Sandbox
+	if production {
+		env = midtrans.Production
+	}
+
+	g := &midtransGateway{serverKey: serverKey}
+	g.snap.New(serverKey, env)
+	g.core.New(serverKey, env)
+	return g
+}
+
+func (g *midtransGateway) Name() string {
+	return "midtrans"
+}
+
+func (g *midtransGateway) CreateCharge(charge PaymentCharge) (PaymentChargeResult, error) {
+	items := []midtrans.ItemDetails{
+		{
+			ID:    fmt.Sprintf("ORD-%d", charge.OrderID),
+			Price: int64(math.Round(charge.Amount)),
+			Qty:   1,
+			Name:  fmt.Sprintf("Produk SmartFarm #%d", charge.OrderID),
+		},
+	}
+	snapReq := snap.Request{
+		TransactionDetails: midtrans.TransactionDetails{
+			OrderID:  charge.TransactionID,
+			GrossAmt: int64(math.Round(charge.Amount)),
+		},
+		CustomerDetail: &midtrans.CustomerDetails{
+			FName: charge.CustomerName,
+			Phone: charge.CustomerPhone,
+		},
+		Items: &items,
+	}
+
+	resp, err := g.snap.CreateTransaction(&snapReq)
+	if err != nil {
+		return PaymentChargeResult{}, fmt.Errorf("midtrans error: %v (check your server key)", err)
+	}
+	return PaymentChargeResult{Token: resp.Token, RedirectURL: resp.RedirectURL}, nil
+}
+
+func (g *midtransGateway) GetStatus(transactionID string) (dto.PaymentWebhookRequest, error) {
+	resp, err := g.core.CheckTransaction(transactionID)
+	// Midtrans answers unknown order IDs with status_code 404, sometimes in a 200 body
+	if (err != nil && err.StatusCode == http.StatusNotFound) || (resp != nil && resp.StatusCode == "404") {
+		return dto.PaymentWebhookRequest{}, errors.New("transaction not found")
+	}
+	if err != nil {
+		return dto.PaymentWebhookRequest{}, fmt.Errorf("midtrans error: %v", err)
+	}
+
+	return dto.PaymentWebhookRequest{
+		TransactionTime:   resp.TransactionTime,
+		TransactionID:     resp.TransactionID,
+		StatusCode:        resp.StatusCode,
+		OrderID:           resp.OrderID,
+		GrossAmount:       resp.GrossAmount,
+		PaymentType:       resp.PaymentType,
+		TransactionStatus: resp.TransactionStatus,
+		FraudStatus:       resp.FraudStatus,
+		SignatureKey:      resp.SignatureKey,
+	}, nil
+}
+
+func (g *midtransGateway) Refund(transactionID string, amount float64, reason string) error {
+	_, err := g.core.RefundTransaction(transactionID, &coreapi.RefundReq{
+		Amount: int64(math.Round(amount)),
+		Reason: reason,
+	})
+	if err != nil {
+		return fmt.Errorf("midtrans error: %v", err)
+	}
+	return nil
+}
+
+// Cancel expires the pending transaction. Snap only creates it once the buyer
+// picks a payment method, so a transaction Midtrans does not know is already
+// unpayable.
+func (g *midtransGateway) Cancel(transactionID string) error {
+	_, err := g.core.ExpireTransaction(transactionID)
+	if err != nil && err.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("midtrans error: %v", err)
+	}
+	return nil
+}
+
+func (g *midtransGateway) VerifyNotification(req dto.PaymentWebhookRequest) bool {
+	return verifyMidtransSignature(req, g.serverKey)
+}
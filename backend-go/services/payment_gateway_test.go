@@ -0,0 +1,61 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"smartfarm-api/dto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeGateway_EmitsSignedWebhook(t *testing.T) {
+	received := make(chan dto.PaymentWebhookRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req dto.PaymentWebhookRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received <- req
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	gateway := NewFakeGateway("test-key", server.URL, "settlement", 0)
+
+	charge, err := gateway.CreateCharge(PaymentCharge{TransactionID: "ORD-001-1", OrderID: 1, Amount: 150000})
+	assert.NoError(t, err)
+	assert.Equal(t, "fake-token-ORD-001-1", charge.Token)
+
+	select {
+	case notification := <-received:
+		assert.Equal(t, "ORD-001-1", notification.OrderID)
+		assert.Equal(t, "settlement", notification.TransactionStatus)
+		assert.Equal(t, "150000.00", notification.GrossAmount)
+		assert.True(t, gateway.VerifyNotification(notification))
+		assert.False(t, NewFakeGateway("other-key", server.URL, "none", 0).VerifyNotification(notification))
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake gateway did not deliver the webhook")
+	}
+
+	status, err := gateway.GetStatus("ORD-001-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "settlement", status.TransactionStatus)
+
+	assert.NoError(t, gateway.Refund("ORD-001-1", 50000, "damaged"))
+	_, err = gateway.GetStatus("ORD-404")
+	assert.Error(t, err)
+}
+
+func TestFakeGateway_CancelStopsPendingCharge(t *testing.T) {
+	gateway := NewFakeGateway("test-key", "http://127.0.0.1:1/payments/webhook", "none", 0)
+	gateway.CreateCharge(PaymentCharge{TransactionID: "ORD-002-1", OrderID: 2, Amount: 50000})
+
+	assert.NoError(t, gateway.Cancel("ORD-002-1"))
+	status, _ := gateway.GetStatus("ORD-002-1")
+	assert.Equal(t, "expire", status.TransactionStatus)
+
+	// Only a charge the buyer has not paid can be cancelled
+	assert.Error(t, gateway.Cancel("ORD-002-1"))
+	assert.Error(t, gateway.Cancel("ORD-404"))
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/policies"
+	"smartfarm-api/repositories"
+	"smartfarm-api/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxPaymentProofSize caps a transfer receipt upload at 5MB.
+const maxPaymentProofSize = 5 << 20
+
+var paymentProofExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".pdf": true}
+
+type PaymentProofService interface {
+	UploadProof(orderID uint, userID uint, req dto.UploadPaymentProofRequest) (dto.PaymentProofResponse, error)
+	GetReviewQueue(actor OrderActor) ([]dto.PaymentProofResponse, error)
+	GetProofFile(paymentID uint, actor OrderActor) (string, error)
+	ApproveProof(paymentID uint, actor OrderActor) (dto.PaymentProofResponse, error)
+	RejectProof(paymentID uint, actor OrderActor, reason string) (dto.PaymentProofResponse, error)
+}
+
+type paymentProofService struct {
+	orderRepo        repositories.OrderRepository
+	productRepo      repositories.ProductRepository
+	paymentRepo      repositories.PaymentRepository
+	notificationRepo repositories.NotificationRepository
+}
+
+func NewPaymentProofService(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, paymentRepo repositories.PaymentRepository, notificationRepo repositories.NotificationRepository) PaymentProofService {
+	return &paymentProofService{orderRepo, productRepo, paymentRepo, notificationRepo}
+}
+
+// UploadProof records a manual bank transfer for the order. The receipt is
+// kept as a pending manual payment attempt until it is reviewed by the
+// order's farmer, or by an admin when the order has several farmers. The
+// amount is priced the same way as a gateway payment.
+func (s *paymentProofService) UploadProof(orderID uint, userID uint, req dto.UploadPaymentProofRequest) (dto.PaymentProofResponse, error) {
+	if err := validatePaymentProofFile(req.Proof); err != nil {
+		return dto.PaymentProofResponse{}, err
+	}
+
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return dto.PaymentProofResponse{}, errors.New("order not found")
+	}
+	if !policies.OwnsOrder(userID, order) {
+		return dto.PaymentProofResponse{}, policies.ErrForbidden
+	}
+
+	amount, err := paymentAmountFor(order, req.Amount)
+	if err != nil {
+		return dto.PaymentProofResponse{}, err
+	}
+
+	proofFile, err := savePaymentProof(req.Proof)
+	if err != nil {
+		return dto.PaymentProofResponse{}, fmt.Errorf("failed to save payment proof: %v", err)
+	}
+
+	var payment models.Payment
+	var superseded *models.Payment
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		payment, _, superseded, err = startPaymentAttempt(tx, order.ID, userID, amount, "manual", "TRF")
+		if err != nil {
+			return err
+		}
+
+		payment.ProofURL = proofFile
+		if err := s.paymentRepo.WithTx(tx).Update(&payment); err != nil {
+			return err
+		}
+		return s.orderRepo.WithTx(tx).UpdatePaymentProof(order.ID, payment.ID, paymentProofPath(payment.ID))
+	})
+	if err != nil {
+		if removeErr := os.Remove(filepath.Join(paymentProofDir(), proofFile)); removeErr != nil {
+			log.Printf("[PaymentProof] Failed to remove unused proof %s: %v", proofFile, removeErr)
+		}
+		return dto.PaymentProofResponse{}, err
+	}
+	cancelSupersededAttempt(superseded)
+
+	log.Printf("[PaymentProof] Order %d: bank transfer of %.2f awaiting review (payment %d)", order.ID, payment.Amount, payment.ID)
+	return mapPaymentProofToResponse(payment, order.Status), nil
+}
+
+// GetReviewQueue lists the bank transfers waiting for review: all of them for
+// an admin, only those on orders the farmer supplies alone for a farmer.
+func (s *paymentProofService) GetReviewQueue(actor OrderActor) ([]dto.PaymentProofResponse, error) {
+	var farmerID uint
+	switch actor.Role {
+	case "admin":
+	case "petani":
+		farmerID = actor.UserID
+	default:
+		return nil, policies.ErrForbidden
+	}
+
+	payments, err := s.paymentRepo.FindProofsAwaitingReview(farmerID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []dto.PaymentProofResponse{}
+	for _, p := range payments {
+		orderStatus := ""
+		if p.Order != nil {
+			orderStatus = p.Order.Status
+		}
+		res = append(res, mapPaymentProofToResponse(p, orderStatus))
+	}
+	return res, nil
+}
+
+// GetProofFile returns where the receipt of a manual payment is stored, for
+// the buyer who uploaded it and for those who may review it.
+func (s *paymentProofService) GetProofFile(paymentID uint, actor OrderActor) (string, error) {
+	payment, err := s.paymentRepo.FindByID(paymentID)
+	if err != nil || payment.Channel != "manual" || payment.ProofURL == "" {
+		return "", errors.New("payment not found")
+	}
+
+	order, err := s.orderRepo.FindByID(payment.OrderID)
+	if err != nil {
+		return "", errors.New("order not found")
+	}
+	if !policies.IsOrderBuyer(actor, order) && !policies.CanReviewOrder(actor, order) {
+		return "", policies.ErrForbidden
+	}
+
+	return filepath.Join(paymentProofDir(), filepath.Base(payment.ProofURL)), nil
+}
+
+// ApproveProof accepts the transfer: the payment succeeds and the order moves
+// to paid, or to reserved when only a pre-order deposit is covered.
+func (s *paymentProofService) ApproveProof(paymentID uint, actor OrderActor) (dto.PaymentProofResponse, error) {
+	return s.reviewProof(paymentID, actor, func(tx *gorm.DB, payment *models.Payment, order *models.Order) error {
+		payment.Status = "success"
+		if err := s.paymentRepo.WithTx(tx).Update(payment); err != nil {
+			return err
+		}
+
+		txOrderRepo := s.orderRepo.WithTx(tx)
+		if err := recordOrderPayment(txOrderRepo, order, payment); err != nil {
+			return err
+		}
+		if err := changeOrderStatus(txOrderRepo, s.productRepo.WithTx(tx), order, paidStatusFor(*order), actor, "bank transfer approved"); err != nil {
+			return err
+		}
+
+		return s.notifyBuyer(tx, *order, "payment_proof_approved", "Payment confirmed",
+			fmt.Sprintf("Your bank transfer of %.2f for order #%d has been confirmed.", payment.Amount, order.ID))
+	})
+}
+
+// RejectProof turns the transfer down with a reason. The order stays where it
+// was so the buyer can upload a new proof or pay through the gateway.
+func (s *paymentProofService) RejectProof(paymentID uint, actor OrderActor, reason string) (dto.PaymentProofResponse, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return dto.PaymentProofResponse{}, errors.New("invalid rejection: a reason is required")
+	}
+
+	return s.reviewProof(paymentID, actor, func(tx *gorm.DB, payment *models.Payment, order *models.Order) error {
+		payment.Status = "failed"
+		payment.RejectReason = reason
+		if err := s.paymentRepo.WithTx(tx).Update(payment); err != nil {
+			return err
+		}
+
+		return s.notifyBuyer(tx, *order, "payment_proof_rejected", "Payment proof rejected",
+			fmt.Sprintf("Your bank transfer for order #%d was not accepted: %s", order.ID, reason))
+	})
+}
+
+// reviewProof locks the order and then the payment, the same order as
+// startPaymentAttempt, checks the reviewer may decide on it and runs decide.
+func (s *paymentProofService) reviewProof(paymentID uint, actor OrderActor, decide func(tx *gorm.DB, payment *models.Payment, order *models.Order) error) (dto.PaymentProofResponse, error) {
+	found, err := s.paymentRepo.FindByID(paymentID)
+	if err != nil {
+		return dto.PaymentProofResponse{}, errors.New("payment not found")
+	}
+
+	var payment *models.Payment
+	var order models.Order
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = s.orderRepo.WithTx(tx).FindByIDForUpdate(found.OrderID)
+		if err != nil {
+			return errors.New("order not found")
+		}
+		if !policies.CanReviewPayment(actor, order) {
+			return policies.ErrForbidden
+		}
+
+		payment, err = s.paymentRepo.WithTx(tx).FindByIDForUpdate(paymentID)
+		if err != nil {
+			return errors.New("payment not found")
+		}
+		if payment.Channel != "manual" || payment.Status != "pending" {
+			return errors.New("payment proof is not awaiting review")
+		}
+
+		now := time.Now()
+		payment.ReviewedBy = &actor.UserID
+		payment.ReviewedAt = &now
+		return decide(tx, payment, &order)
+	})
+	if err != nil {
+		return dto.PaymentProofResponse{}, err
+	}
+
+	log.Printf("[PaymentProof] Payment %d of order %d %s by %s %d", payment.ID, order.ID, payment.Status, actor.Role, actor.UserID)
+	return mapPaymentProofToResponse(*payment, order.Status), nil
+}
+
+func (s *paymentProofService) notifyBuyer(tx *gorm.DB, order models.Order, notificationType string, title string, message string) error {
+	orderID := order.ID
+	return s.notificationRepo.WithTx(tx).Create(&models.Notification{
+		UserID:  order.UserID,
+		Type:    notificationType,
+		Title:   title,
+		Message: message,
+		OrderID: &orderID,
+	})
+}
+
+// paymentProofDir is where receipts are kept, PAYMENT_PROOF_DIR or
+// ./payment-proofs. It is outside the public ./uploads tree so receipts are
+// only served through GetProofFile.
+func paymentProofDir() string {
+	if dir := os.Getenv("PAYMENT_PROOF_DIR"); dir != "" {
+		return dir
+	}
+	return "./payment-proofs"
+}
+
+// savePaymentProof stores the receipt under a random name and returns it.
+func savePaymentProof(file *multipart.FileHeader) (string, error) {
+	name, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	filename := name + strings.ToLower(filepath.Ext(file.Filename))
+	return filename, writeUpload(file, paymentProofDir(), filename)
+}
+
+// paymentProofPath is the route the receipt of a payment is downloaded from.
+func paymentProofPath(paymentID uint) string {
+	return fmt.Sprintf("/payment-proofs/%d/file", paymentID)
+}
+
+// validatePaymentProofFile accepts JPG, PNG and PDF receipts up to 5MB.
+func validatePaymentProofFile(file *multipart.FileHeader) error {
+	if file == nil {
+		return errors.New("invalid payment proof: file is required")
+	}
+	if !paymentProofExtensions[strings.ToLower(filepath.Ext(file.Filename))] {
+		return errors.New("invalid payment proof: only jpg, png and pdf files are accepted")
+	}
+	if file.Size > maxPaymentProofSize {
+		return errors.New("invalid payment proof: file is larger than 5MB")
+	}
+	return nil
+}
+
+func mapPaymentProofToResponse(p models.Payment, orderStatus string) dto.PaymentProofResponse {
+	res := dto.PaymentProofResponse{
+		PaymentID:    p.ID,
+		OrderID:      p.OrderID,
+		BuyerID:      p.UserID,
+		Amount:       p.Amount,
+		Status:       p.Status,
+		OrderStatus:  orderStatus,
+		ProofURL:     paymentProofPath(p.ID),
+		RejectReason: p.RejectReason,
+		ReviewedBy:   p.ReviewedBy,
+		CreatedAt:    p.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if p.ReviewedAt != nil {
+		res.ReviewedAt = p.ReviewedAt.Format("2006-01-02 15:04:05")
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"mime/multipart"
+	"path/filepath"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePaymentProofFile(t *testing.T) {
+	assert.Error(t, validatePaymentProofFile(nil))
+	assert.NoError(t, validatePaymentProofFile(&multipart.FileHeader{Filename: "receipt.JPG", Size: 1024}))
+	assert.NoError(t, validatePaymentProofFile(&multipart.FileHeader{Filename: "receipt.pdf", Size: maxPaymentProofSize}))
+	assert.EqualError(t, validatePaymentProofFile(&multipart.FileHeader{Filename: "receipt.exe", Size: 1024}),
+		"invalid payment proof: only jpg, png and pdf files are accepted")
+	assert.EqualError(t, validatePaymentProofFile(&multipart.FileHeader{Filename: "receipt.png", Size: maxPaymentProofSize + 1}),
+		"invalid payment proof: file is larger than 5MB")
+}
+
+func TestGetReviewQueue_RejectsBuyers(t *testing.T) {
+	s := NewPaymentProofService(nil, nil, nil, nil)
+	_, err := s.GetReviewQueue(OrderActor{UserID: 1, Role: "pembeli"})
+	assert.EqualError(t, err, "unauthorized")
+}
+
+type proofPaymentsRepo struct {
+	repositories.PaymentRepository
+	payments map[uint]models.Payment
+}
+
+func (r proofPaymentsRepo) FindByID(id uint) (*models.Payment, error) {
+	p, ok := r.payments[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	return &p, nil
+}
+
+type proofOrdersRepo struct {
+	repositories.OrderRepository
+	order models.Order
+}
+
+func (r proofOrdersRepo) FindByID(id uint) (models.Order, error) {
+	return r.order, nil
+}
+
+func TestGetProofFile_OnlyBuyerAndReviewers(t *testing.T) {
+	t.Setenv("PAYMENT_PROOF_DIR", "/srv/proofs")
+	order := models.Order{ID: 5, UserID: 2, Fulfillments: []models.OrderFulfillment{{FarmerID: 7}}}
+	s := NewPaymentProofService(proofOrdersRepo{order: order}, nil, proofPaymentsRepo{payments: map[uint]models.Payment{
+		1: {ID: 1, OrderID: 5, Channel: "manual", ProofURL: "3f2a.png"},
+		2: {ID: 2, OrderID: 5, Channel: "gateway"},
+	}}, nil)
+
+	for _, actor := range []OrderActor{{UserID: 2, Role: "pembeli"}, {UserID: 7, Role: "petani"}, {UserID: 9, Role: "admin"}} {
+		path, err := s.GetProofFile(1, actor)
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join("/srv/proofs", "3f2a.png"), path)
+	}
+
+	_, err := s.GetProofFile(1, OrderActor{UserID: 3, Role: "pembeli"})
+	assert.EqualError(t, err, "unauthorized")
+	_, err = s.GetProofFile(1, OrderActor{UserID: 8, Role: "petani"})
+	assert.EqualError(t, err, "unauthorized")
+	_, err = s.GetProofFile(2, OrderActor{UserID: 2, Role: "pembeli"})
+	assert.EqualError(t, err, "payment not found")
+}
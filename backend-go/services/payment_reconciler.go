@@ -0,0 +1,256 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentReconciler asks the gateway about payments that have been pending
+// longer than minAge, in case their webhook was lost, and applies what it
+// reports through the same path as ProcessPaymentWebhook. Every check is
+// written to the day's reconciliation report:
+//
+//   - matched: the gateway agrees the payment is still pending
+//   - corrected: the gateway had a newer status, which was applied
+//   - orphaned: the gateway has no such transaction or disagrees on the amount
+//
+// Each payment is re-read under a row lock, so several replicas can run it.
+// It relies on the repositories set up by InitPaymentService.
+type PaymentReconciler struct {
+	paymentRepo repositories.PaymentRepository
+	reportRepo  repositories.ReconciliationRepository
+	gateway     PaymentGateway
+	minAge      time.Duration
+	batchSize   int
+	now         func() time.Time
+}
+
+func NewPaymentReconciler(paymentRepo repositories.PaymentRepository, reportRepo repositories.ReconciliationRepository, gateway PaymentGateway, minAge time.Duration, now func() time.Time) *PaymentReconciler {
+	if now == nil {
+		now = time.Now
+	}
+	return &PaymentReconciler{
+		paymentRepo: paymentRepo,
+		reportRepo:  reportRepo,
+		gateway:     gateway,
+		minAge:      minAge,
+		batchSize:   100,
+		now:         now,
+	}
+}
+
+// StartPaymentReconciler runs the reconciler in the background using
+// PAYMENT_RECONCILE_AFTER (default 15m) and PAYMENT_RECONCILE_INTERVAL
+// (default 10m). InitPaymentService must have been called.
+func StartPaymentReconciler() {
+	minAge := durationFromEnv("PAYMENT_RECONCILE_AFTER", 15*time.Minute)
+	interval := durationFromEnv("PAYMENT_RECONCILE_INTERVAL", 10*time.Minute)
+
+	reconciler := NewPaymentReconciler(
+		repositories.NewPaymentRepository(config.DB),
+		repositories.NewReconciliationRepository(config.DB),
+		paymentGateway,
+		minAge,
+		nil,
+	)
+
+	log.Printf("[Reconcile] Checking payments pending longer than %v every %v", minAge, interval)
+	go reconciler.Run(context.Background(), interval)
+}
+
+// Run reconciles once per interval until ctx is cancelled.
+func (r *PaymentReconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(); err != nil {
+			log.Printf("[Reconcile] Run failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile checks every payment pending since before now-minAge and returns
+// how many were corrected.
+func (r *PaymentReconciler) Reconcile() (int, error) {
+	now := r.now()
+	cutoff := now.Add(-r.minAge)
+	corrected := 0
+
+	var afterID uint
+	for {
+		payments, err := r.paymentRepo.FindPendingCreatedBefore(cutoff, afterID, r.batchSize)
+		if err != nil {
+			return corrected, err
+		}
+
+		for _, payment := range payments {
+			afterID = payment.ID
+
+			entry, err := r.reconcilePayment(payment.ID, cutoff)
+			if err != nil {
+				log.Printf("[Reconcile] Failed to check payment %d: %v", payment.ID, err)
+				continue
+			}
+			if entry == nil {
+				continue
+			}
+
+			entry.ReportDate = now.Format("2006-01-02")
+			if err := r.reportRepo.Save(entry); err != nil {
+				log.Printf("[Reconcile] Failed to record payment %d: %v", payment.ID, err)
+			}
+			if entry.Outcome == "corrected" {
+				corrected++
+			}
+		}
+
+		if len(payments) < r.batchSize {
+			return corrected, nil
+		}
+	}
+}
+
+// reconcilePayment returns nil when the payment no longer needs checking,
+// e.g. because a webhook arrived in the meantime.
+func (r *PaymentReconciler) reconcilePayment(paymentID uint, cutoff time.Time) (*models.PaymentReconciliation, error) {
+	var entry *models.PaymentReconciliation
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		payment, err := r.paymentRepo.WithTx(tx).FindByIDForUpdate(paymentID)
+		if err != nil {
+			return err
+		}
+		if payment.Status != "pending" || !payment.CreatedAt.Before(cutoff) {
+			return nil
+		}
+
+		entry = &models.PaymentReconciliation{
+			PaymentID:     payment.ID,
+			OrderID:       payment.OrderID,
+			TransactionID: payment.TransactionID,
+			Amount:        payment.Amount,
+			LocalStatus:   payment.Status,
+		}
+
+		status, err := r.gateway.GetStatus(payment.TransactionID)
+		if err != nil {
+			if err.Error() == "transaction not found" {
+				entry.Outcome = "orphaned"
+				entry.Note = "gateway has no record of this transaction"
+				return nil
+			}
+			entry = nil
+			return err
+		}
+		entry.GatewayStatus = status.TransactionStatus
+
+		if status.TransactionStatus == "pending" {
+			entry.Outcome = "matched"
+			return nil
+		}
+
+		// A savepoint keeps the report entry even if applying the status fails
+		var applied bool
+		applyErr := tx.Transaction(func(applyTx *gorm.DB) error {
+			applied, err = applyPaymentNotification(applyTx, payment, status, "reconcile")
+			return err
+		})
+		switch {
+		case applyErr != nil && applyErr.Error() == "gross amount mismatch":
+			entry.Outcome = "orphaned"
+			entry.Note = fmt.Sprintf("gateway amount %s does not match %.2f", status.GrossAmount, payment.Amount)
+		case applyErr != nil:
+			entry = nil
+			return applyErr
+		case applied:
+			entry.Outcome = "corrected"
+			entry.Note = "applied missed " + status.TransactionStatus + " notification"
+			log.Printf("[Reconcile] Payment %d corrected: pending -> %s", payment.ID, status.TransactionStatus)
+		default:
+			entry.Outcome = "matched"
+			entry.Note = "notification was already applied"
+		}
+		return nil
+	})
+
+	return entry, err
+}
+
+// GetReconciliationReport returns the reconciliation report of one day.
+func GetReconciliationReport(date string) (dto.ReconciliationReport, error) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return dto.ReconciliationReport{}, errors.New("invalid date: use YYYY-MM-DD")
+	}
+
+	entries, err := repositories.NewReconciliationRepository(config.DB).FindByDate(date)
+	if err != nil {
+		return dto.ReconciliationReport{}, err
+	}
+
+	report := dto.ReconciliationReport{Date: date, Entries: []dto.ReconciliationEntry{}}
+	for _, e := range entries {
+		switch e.Outcome {
+		case "matched":
+			report.Matched++
+		case "corrected":
+			report.Corrected++
+		case "orphaned":
+			report.Orphaned++
+		}
+		report.Entries = append(report.Entries, dto.ReconciliationEntry{
+			PaymentID:     e.PaymentID,
+			OrderID:       e.OrderID,
+			TransactionID: e.TransactionID,
+			Amount:        e.Amount,
+			LocalStatus:   e.LocalStatus,
+			GatewayStatus: e.GatewayStatus,
+			Outcome:       e.Outcome,
+			Note:          e.Note,
+			CheckedAt:     e.UpdatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return report, nil
+}
+
+// ReconciliationReportCSV renders the report for download.
+func ReconciliationReportCSV(report dto.ReconciliationReport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"payment_id", "order_id", "transaction_id", "amount", "local_status", "gateway_status", "outcome", "note", "checked_at"})
+	for _, e := range report.Entries {
+		w.Write([]string{
+			strconv.FormatUint(uint64(e.PaymentID), 10),
+			strconv.FormatUint(uint64(e.OrderID), 10),
+			e.TransactionID,
+			strconv.FormatFloat(e.Amount, 'f', 2, 64),
+			e.LocalStatus,
+			e.GatewayStatus,
+			e.Outcome,
+			e.Note,
+			e.CheckedAt,
+		})
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// TestPaymentReconciler_AppliesMissedSettlement settles a payment at the fake
+// gateway without delivering the webhook and checks the reconciler catches up
+func TestPaymentReconciler_AppliesMissedSettlement(t *testing.T) {
+	db := config.DB
+	if db == nil {
+		t.Skip("Database not available for testing")
+	}
+
+	orderRepo = repositories.NewOrderRepository(db)
+	productRepo = repositories.NewProductRepository(db)
+	paymentRepo = repositories.NewPaymentRepository(db)
+
+	buyer := models.User{Name: "Test Reconcile Buyer", Email: "testreconcile@race.com", Password: "hashed", Role: "pembeli"}
+	db.Create(&buyer)
+	order := models.Order{UserID: buyer.ID, TotalPrice: 25000, Status: "pending"}
+	db.Create(&order)
+
+	settled := models.Payment{OrderID: order.ID, UserID: buyer.ID, Amount: 25000, Status: "pending", TransactionID: "TEST-RECON-" + time.Now().Format("150405.000")}
+	db.Create(&settled)
+	unknown := models.Payment{OrderID: order.ID + 1000000, UserID: buyer.ID, Amount: 1000, Status: "pending", TransactionID: "TEST-RECON-UNKNOWN-" + time.Now().Format("150405.000")}
+	db.Create(&unknown)
+
+	// The webhook URL is unreachable, so only the gateway knows about the settlement
+	gateway := NewFakeGateway("test-key", "http://127.0.0.1:1/payments/webhook", "none", 0)
+	gateway.CreateCharge(PaymentCharge{TransactionID: settled.TransactionID, OrderID: order.ID, Amount: 25000})
+	gateway.Emit(settled.TransactionID, "settlement")
+
+	now := func() time.Time { return time.Now().Add(time.Hour) }
+	reconciler := NewPaymentReconciler(paymentRepo, repositories.NewReconciliationRepository(db), gateway, 15*time.Minute, now)
+
+	corrected, err := reconciler.Reconcile()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, corrected)
+
+	refreshed, _ := paymentRepo.FindByID(settled.ID)
+	assert.Equal(t, "success", refreshed.Status)
+	paidOrder, _ := orderRepo.FindByID(order.ID)
+	assert.Equal(t, "paid", paidOrder.Status)
+
+	report, err := GetReconciliationReport(now().Format("2006-01-02"))
+	assert.NoError(t, err)
+	outcomes := map[uint]string{}
+	for _, e := range report.Entries {
+		outcomes[e.PaymentID] = e.Outcome
+	}
+	assert.Equal(t, "corrected", outcomes[settled.ID])
+	assert.Equal(t, "orphaned", outcomes[unknown.ID])
+}
+
+// TestPaymentNotification_LateExpiryKeepsSettledOrder expires the first
+// attempt after the buyer's second attempt settled the order
+func TestPaymentNotification_LateExpiryKeepsSettledOrder(t *testing.T) {
+	db := config.DB
+	if db == nil {
+		t.Skip("Database not available for testing")
+	}
+
+	orderRepo = repositories.NewOrderRepository(db)
+	productRepo = repositories.NewProductRepository(db)
+	paymentRepo = repositories.NewPaymentRepository(db)
+
+	buyer := models.User{Name: "Test Late Expiry Buyer", Email: "testlateexpiry@race.com", Password: "hashed", Role: "pembeli"}
+	db.Create(&buyer)
+	order := models.Order{UserID: buyer.ID, TotalPrice: 25000, Status: "pending"}
+	db.Create(&order)
+
+	suffix := time.Now().Format("150405.000")
+	first := models.Payment{OrderID: order.ID, UserID: buyer.ID, Amount: 25000, Status: "expired", AttemptNumber: 1, TransactionID: "TEST-LATE-1-" + suffix}
+	db.Create(&first)
+	second := models.Payment{OrderID: order.ID, UserID: buyer.ID, Amount: 25000, Status: "pending", AttemptNumber: 2, TransactionID: "TEST-LATE-2-" + suffix}
+	db.Create(&second)
+
+	notify := func(p models.Payment, status string) {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			locked, err := paymentRepo.WithTx(tx).FindByIDForUpdate(p.ID)
+			if err != nil {
+				return err
+			}
+			_, err = applyPaymentNotification(tx, locked, dto.PaymentWebhookRequest{
+				OrderID: p.TransactionID, TransactionID: "tx-" + p.TransactionID, TransactionStatus: status, GrossAmount: "25000.00",
+			}, "midtrans")
+			return err
+		})
+		assert.NoError(t, err)
+	}
+
+	notify(second, "settlement")
+	notify(first, "expire")
+
+	refreshed, _ := orderRepo.FindByID(order.ID)
+	assert.Equal(t, "paid", refreshed.Status)
+	assert.Equal(t, 25000.0, refreshed.AmountPaid)
+
+	// Paid after it was superseded: owed back rather than counted twice
+	notify(first, "settlement")
+	refreshed, _ = orderRepo.FindByID(order.ID)
+	assert.Equal(t, 25000.0, refreshed.AmountPaid)
+	assert.Equal(t, 25000.0, refreshed.RefundDue)
+}
+
+func TestReconciliationReportCSV(t *testing.T) {
+	data, err := ReconciliationReportCSV(dto.ReconciliationReport{
+		Date: "2024-05-01",
+		Entries: []dto.ReconciliationEntry{
+			{PaymentID: 3, OrderID: 7, TransactionID: "ORD-007-1-1", Amount: 15000, LocalStatus: "pending", GatewayStatus: "settlement", Outcome: "corrected", Note: "applied missed settlement notification"},
+		},
+	})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "3,7,ORD-007-1-1,15000.00,pending,settlement,corrected,applied missed settlement notification,", lines[1])
+}
@@ -1,36 +1,52 @@
 package services
 
 import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"math"
 	"smartfarm-api/config"
 	"smartfarm-api/dto"
 	"smartfarm-api/models"
+	"smartfarm-api/policies"
 	"smartfarm-api/repositories"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/midtrans/midtrans-go"
-	"github.com/midtrans/midtrans-go/snap"
+	"gorm.io/gorm"
 )
 
-var paymentClient snap.Client
+var paymentGateway PaymentGateway
 var orderRepo repositories.OrderRepository
 var addressRepo repositories.AddressRepository
+var productRepo repositories.ProductRepository
+var paymentRepo repositories.PaymentRepository
+var feeRepo repositories.FeeRepository
 
 func InitPaymentService() {
-	// Setup Midtrans
-	paymentClient.New(os.Getenv("MIDTRANS_SERVER_KEY"), midtrans.Sandbox)
+	// Setup payment gateway
+	paymentGateway = NewPaymentGatewayFromEnv()
 
 	// Initialize repositories
 	orderRepo = repositories.NewOrderRepository(config.DB)
 	addressRepo = repositories.NewAddressRepository(config.DB)
+	productRepo = repositories.NewProductRepository(config.DB)
+	paymentRepo = repositories.NewPaymentRepository(config.DB)
+	feeRepo = repositories.NewFeeRepository(config.DB)
+}
+
+// ActivePaymentGateway returns the gateway chosen by InitPaymentService.
+func ActivePaymentGateway() PaymentGateway {
+	return paymentGateway
 }
 
 func CreatePayment(userID uint, req dto.CreatePaymentRequest) (*models.Payment, string, error) {
-	log.Printf("[PaymentService] Starting CreatePayment for UserID: %d, OrderID: %d, Amount: %f", userID, req.OrderID, req.Amount)
+	log.Printf("[PaymentService] Starting CreatePayment for UserID: %d, OrderID: %d", userID, req.OrderID)
 
 	// Get order
 	order, err := orderRepo.FindByID(req.OrderID)
@@ -40,9 +56,15 @@ func CreatePayment(userID uint, req dto.CreatePaymentRequest) (*models.Payment,
 	}
 	log.Printf("[PaymentService] Order found: %+v", order)
 
-	if order.UserID != userID {
+	if !policies.OwnsOrder(userID, order) {
 		log.Printf("[PaymentService] Error: UserID %d unauthorized for Order %d (Owner: %d)", userID, req.OrderID, order.UserID)
-		return nil, "", errors.New("unauthorized")
+		return nil, "", policies.ErrForbidden
+	}
+
+	amount, err := paymentAmountFor(order, req.Amount)
+	if err != nil {
+		log.Printf("[PaymentService] Rejected payment for Order %d: %v", order.ID, err)
+		return nil, "", err
 	}
 
 	// Get address
@@ -53,72 +75,53 @@ func CreatePayment(userID uint, req dto.CreatePaymentRequest) (*models.Payment,
 	}
 	log.Printf("[PaymentService] Address found: %+v", address)
 
-	// Create payment record
-	payment := models.Payment{
-		OrderID:       req.OrderID,
-		UserID:        userID,
-		Amount:        req.Amount,
-		Status:        "pending",
-		TransactionID: fmt.Sprintf("ORD-%03d-%d", req.OrderID, time.Now().Unix()),
-	}
-
-	log.Printf("[PaymentService] Creating payment record in DB...")
-	if err := repositories.CreatePayment(&payment); err != nil {
+	// Create payment attempt
+	var payment models.Payment
+	var superseded *models.Payment
+	resumed := false
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		payment, resumed, superseded, err = startPaymentAttempt(tx, order.ID, userID, amount, "gateway", "ORD")
+		return err
+	})
+	if err != nil {
+		if err.Error() == "a payment proof is already awaiting review" {
+			return nil, "", err
+		}
 		log.Printf("[PaymentService] DB Error creating payment: %v", err)
 		return nil, "", fmt.Errorf("failed to create payment record: %v", err)
 	}
-	log.Printf("[PaymentService] Payment record created with ID: %d", payment.ID)
-
-	// Midtrans Logic
-	serverKey := strings.TrimSpace(os.Getenv("MIDTRANS_SERVER_KEY"))
-	var snapToken string
-	var redirectURL string
+	cancelSupersededAttempt(superseded)
 
-	// 🕵️ Check for Placeholder Key (MOCK MODE)
-	if serverKey == "" || serverKey == "YOUR_MIDTRANS_SERVER_KEY_HERE" || strings.Contains(serverKey, "PLACEHOLDER") {
-		log.Println("🛠️ [PaymentService] Using MOCK MODE (Key is missing or placeholder)")
-		snapToken = fmt.Sprintf("mock-token-%d-%d", payment.ID, time.Now().Unix())
-		redirectURL = "https://app.sandbox.midtrans.com/snap/v2/vtweb/" + snapToken
-	} else {
-		log.Printf("[PaymentService] Using REAL MIDTRANS MODE (Key starts with %s...)", serverKey[:4])
-		// Real Midtrans transaction
-		items := []midtrans.ItemDetails{
-			{
-				ID:    fmt.Sprintf("ORD-%d", req.OrderID),
-				Price: int64(req.Amount),
-				Qty:   1,
-				Name:  fmt.Sprintf("Produk SmartFarm #%d", req.OrderID),
-			},
-		}
-		snapReq := snap.Request{
-			TransactionDetails: midtrans.TransactionDetails{
-				OrderID:  payment.TransactionID,
-				GrossAmt: int64(req.Amount),
-			},
-			CustomerDetail: &midtrans.CustomerDetails{
-				FName: address.RecipientName,
-				Phone: address.PhoneNumber,
-			},
-			Items: &items,
-		}
-
-		log.Printf("[PaymentService] Calling Midtrans API...")
-		snapResp, err := paymentClient.CreateTransaction(&snapReq)
-		if err != nil {
-			log.Printf("[PaymentService] Midtrans API Error: %v", err)
-			return nil, "", fmt.Errorf("midtrans error: %v (check your server key)", err)
+	if resumed {
+		log.Printf("[PaymentService] Resuming attempt %d (payment %d) for order %d", payment.AttemptNumber, payment.ID, order.ID)
+		return &payment, payment.SnapToken, nil
+	}
+	log.Printf("[PaymentService] Payment attempt %d created with ID: %d", payment.AttemptNumber, payment.ID)
+
+	log.Printf("[PaymentService] Creating %s charge...", paymentGateway.Name())
+	charge, err := paymentGateway.CreateCharge(PaymentCharge{
+		TransactionID: payment.TransactionID,
+		OrderID:       order.ID,
+		Amount:        payment.Amount,
+		CustomerName:  address.RecipientName,
+		CustomerPhone: address.PhoneNumber,
+	})
+	if err != nil {
+		log.Printf("[PaymentService] Gateway Error: %v", err)
+		// Free the active slot so the buyer can try again
+		payment.Status = "failed"
+		if updateErr := paymentRepo.Update(&payment); updateErr != nil {
+			log.Printf("[PaymentService] DB Error failing payment %d: %v", payment.ID, updateErr)
 		}
-		log.Printf("[PaymentService] Midtrans Response received. Token: %s", snapResp.Token)
-		snapToken = snapResp.Token
-		redirectURL = snapResp.RedirectURL
+		return nil, "", err
 	}
 
 	// Update payment with snap token
-	payment.SnapToken = snapToken
-	payment.SnapURL = redirectURL
+	payment.SnapToken = charge.Token
+	payment.SnapURL = charge.RedirectURL
 
 	log.Printf("[PaymentService] Updating payment record in DB with token...")
-	if err := repositories.UpdatePayment(&payment); err != nil {
+	if err := paymentRepo.UpdateCharge(payment.ID, charge.Token, charge.RedirectURL); err != nil {
 		log.Printf("[PaymentService] DB Error updating payment: %v", err)
 		return nil, "", fmt.Errorf("failed to update payment with token: %v", err)
 	}
@@ -131,64 +134,339 @@ func CreatePayment(userID uint, req dto.CreatePaymentRequest) (*models.Payment,
 	}
 
 	log.Printf("[PaymentService] Successfully completed CreatePayment for ID: %d", payment.ID)
-	return &payment, snapToken, nil
+	return &payment, charge.Token, nil
 }
 
-func ProcessPaymentWebhook(webhookData map[string]interface{}) error {
-	transactionID := webhookData["order_id"].(string)
-	transactionStatus := webhookData["transaction_status"].(string)
+// ProcessPaymentWebhook applies a Midtrans notification. The signature and
+// gross amount are checked before anything is written, and every notification
+// is stored under a dedup key so a repeated delivery changes nothing.
+func ProcessPaymentWebhook(req dto.PaymentWebhookRequest) error {
+	if req.OrderID == "" || req.TransactionStatus == "" {
+		return errors.New("invalid webhook payload")
+	}
 
-	payment, err := repositories.GetPaymentByTransactionID(transactionID)
+	if !paymentGateway.VerifyNotification(req) {
+		log.Printf("[PaymentService] Rejected webhook for %s: invalid signature", req.OrderID)
+		return errors.New("invalid signature")
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		payment, err := paymentRepo.WithTx(tx).FindByTransactionIDForUpdate(req.OrderID)
+		if err != nil {
+			return errors.New("payment not found")
+		}
+
+		_, err = applyPaymentNotification(tx, payment, req, "midtrans")
+		return err
+	})
+}
+
+// applyPaymentNotification moves the locked payment and its order to the
+// status the gateway reported. It is shared by the webhook and the
+// reconciler and reports whether anything changed; a notification that was
+// already applied is skipped.
+func applyPaymentNotification(tx *gorm.DB, payment *models.Payment, req dto.PaymentWebhookRequest, source string) (bool, error) {
+	txPaymentRepo := paymentRepo.WithTx(tx)
+
+	if !grossAmountMatches(req.GrossAmount, payment.Amount) {
+		log.Printf("[PaymentService] Rejected %s status for %s: gross amount %s does not match %.2f", source, req.OrderID, req.GrossAmount, payment.Amount)
+		return false, errors.New("gross amount mismatch")
+	}
+
+	dedupKey := webhookDedupKey(req)
+	seen, err := txPaymentRepo.HasNotification(dedupKey)
 	if err != nil {
-		return errors.New("payment not found")
+		return false, err
+	}
+	if seen {
+		log.Printf("[PaymentService] Duplicate notification %s ignored", dedupKey)
+		return false, nil
+	}
+
+	payload, _ := json.Marshal(req)
+	if err := txPaymentRepo.CreateNotification(&models.PaymentNotification{
+		PaymentID:         payment.ID,
+		DedupKey:          dedupKey,
+		TransactionStatus: req.TransactionStatus,
+		StatusCode:        req.StatusCode,
+		GrossAmount:       req.GrossAmount,
+		Payload:           string(payload),
+	}); err != nil {
+		return false, err
 	}
 
 	// Update payment status
-	switch transactionStatus {
-	case "capture", "settlement":
-		payment.Status = "success"
-	case "pending":
-		payment.Status = "pending"
-	case "deny", "cancel", "expire":
-		payment.Status = "failed"
+	previous := payment.Status
+	wasSuccessful := previous == "success"
+	payment.Status = nextPaymentStatus(previous, req)
+	// The channel, not the method, tells manual transfers apart; the gateway
+	// only fills in how a gateway payment was made
+	if payment.Channel == "gateway" && payment.PaymentMethod == "" {
+		payment.PaymentMethod = req.PaymentType
 	}
 
-	if err := repositories.UpdatePayment(payment); err != nil {
-		return err
+	if err := txPaymentRepo.Update(payment); err != nil {
+		return false, err
 	}
 
 	// Update order status
-	order, err := orderRepo.FindByID(payment.OrderID)
+	txOrderRepo := orderRepo.WithTx(tx)
+	txProductRepo := productRepo.WithTx(tx)
+	order, err := txOrderRepo.FindByIDForUpdate(payment.OrderID)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if payment.Status == "success" {
-		order.Status = "paid"
+	var to string
+	if payment.Status == "success" && (previous == "expired" || previous == "failed") {
+		// The attempt was superseded or had failed, so the order is paid by
+		// another one or no longer waits for it: the money is owed back
+		return true, flagPaymentForRefund(txOrderRepo, &order, payment)
+	} else if payment.Status == "success" {
+		// A replayed settlement must not count the same payment twice
+		if !wasSuccessful {
+			if err := recordOrderPayment(txOrderRepo, &order, payment); err != nil {
+				return false, err
+			}
+		}
+		to = paidStatusFor(order)
 	} else if payment.Status == "failed" {
-		order.Status = "cancelled"
+		// Only the buyer's last hope of paying cancels the order; a retry
+		// still in progress or one that went through keeps it
+		attempts, err := txPaymentRepo.FindAllByOrderID(order.ID)
+		if err != nil {
+			return false, err
+		}
+		if !failedAttemptCancelsOrder(order, attempts, payment.ID) {
+			log.Printf("[PaymentService] Payment %d failed, order %d left %s", payment.ID, order.ID, order.Status)
+			return true, nil
+		}
+		to = "cancelled"
+	} else {
+		return true, nil
 	}
 
-	return orderRepo.Update(&order)
+	if err := changeOrderStatus(txOrderRepo, txProductRepo, &order, to, systemActor, source+": "+req.TransactionStatus); err != nil {
+		// A late notification must not roll back the payment record or make
+		// Midtrans retry forever; any other failure rolls everything back
+		if !isInvalidTransition(err) {
+			return false, err
+		}
+		log.Printf("[PaymentService] Ignoring %s status for order %d: %v", source, order.ID, err)
+	}
+	return true, nil
+}
+
+// failedAttemptCancelsOrder reports whether a failed payment attempt should
+// cancel its order: only while the order is still waiting for its first
+// payment and no other attempt is pending or went through.
+func failedAttemptCancelsOrder(order models.Order, attempts []models.Payment, failedID uint) bool {
+	if order.Status != "pending" {
+		return false
+	}
+	for _, p := range attempts {
+		if p.ID == failedID {
+			continue
+		}
+		switch p.Status {
+		case "pending", "success", "partially_refunded", "refunded":
+			return false
+		}
+	}
+	return true
 }
 
-func GetPaymentByOrderID(userID uint, orderID uint) (*models.Payment, error) {
-	payment, err := repositories.GetPaymentByOrderID(orderID)
+// nextPaymentStatus maps a gateway status onto the payment. A card capture
+// only counts once the fraud check accepted it, and notifications arriving out
+// of order never move a payment back: a successful or refunded payment keeps
+// its status and a failed one does not return to pending.
+func nextPaymentStatus(current string, req dto.PaymentWebhookRequest) string {
+	next := current
+	switch req.TransactionStatus {
+	case "capture":
+		if req.FraudStatus == "accept" {
+			next = "success"
+		} else {
+			next = "pending"
+		}
+	case "settlement":
+		next = "success"
+	case "pending":
+		next = "pending"
+	case "deny", "cancel", "expire":
+		next = "failed"
+	}
+
+	switch current {
+	case "success", "partially_refunded", "refunded":
+		return current
+	case "failed", "expired":
+		if next == "pending" {
+			return current
+		}
+	}
+	return next
+}
+
+// verifyMidtransSignature checks signature_key, which Midtrans computes as
+// SHA512(order_id + status_code + gross_amount + server key).
+func verifyMidtransSignature(req dto.PaymentWebhookRequest, serverKey string) bool {
+	if serverKey == "" || req.SignatureKey == "" {
+		return false
+	}
+
+	sum := sha512.Sum512([]byte(req.OrderID + req.StatusCode + req.GrossAmount + serverKey))
+	expected := hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(req.SignatureKey))) == 1
+}
+
+// grossAmountMatches compares Midtrans' decimal string (e.g. "150000.00")
+// with the amount we asked for, to the cent.
+func grossAmountMatches(grossAmount string, amount float64) bool {
+	gross, err := strconv.ParseFloat(grossAmount, 64)
 	if err != nil {
-		return nil, errors.New("payment not found")
+		return false
 	}
+	return math.Round(gross*100) == math.Round(amount*100)
+}
+
+// webhookDedupKey identifies one notification. Midtrans retries the same
+// status for the same transaction, so those fields are enough.
+func webhookDedupKey(req dto.PaymentWebhookRequest) string {
+	return strings.Join([]string{req.OrderID, req.TransactionID, req.TransactionStatus, req.StatusCode, req.FraudStatus}, ":")
+}
 
-	// Verify ownership
-	if payment.UserID != userID {
-		return nil, errors.New("unauthorized")
+// GetOrderPayments returns the latest payment attempt of the order together
+// with every attempt made so far, oldest first.
+func GetOrderPayments(userID uint, orderID uint) (dto.OrderPaymentsResponse, error) {
+	attempts, err := paymentRepo.FindAllByOrderID(orderID)
+	if err != nil || len(attempts) == 0 {
+		return dto.OrderPaymentsResponse{}, errors.New("payment not found")
 	}
 
-	return payment, nil
+	latest := attempts[len(attempts)-1]
+	if latest.UserID != userID {
+		return dto.OrderPaymentsResponse{}, policies.ErrForbidden
+	}
+
+	res := dto.OrderPaymentsResponse{
+		PaymentID:     latest.ID,
+		AttemptNumber: latest.AttemptNumber,
+		Status:        latest.Status,
+		Amount:        latest.Amount,
+		Attempts:      []dto.PaymentAttemptResponse{},
+	}
+	if latest.Status == "pending" {
+		res.SnapToken = latest.SnapToken
+	}
+	for _, p := range attempts {
+		res.Attempts = append(res.Attempts, dto.PaymentAttemptResponse{
+			PaymentID:      p.ID,
+			AttemptNumber:  p.AttemptNumber,
+			Status:         p.Status,
+			Amount:         p.Amount,
+			RefundedAmount: p.RefundedAmount,
+			FeeAmount:      p.FeeAmount,
+			PaymentMethod:  p.PaymentMethod,
+			TransactionID:  p.TransactionID,
+			CreatedAt:      p.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return res, nil
+}
+
+// startPaymentAttempt adds a pending payment attempt to the order. The order
+// row lock serializes attempts so there is never more than one pending
+// attempt per order: a gateway attempt for the same amount is resumed, any
+// other one is expired and returned so its charge can be cancelled at the
+// gateway once the transaction commits. A manual bank transfer under review
+// blocks new attempts so the buyer cannot pay twice. channel is gateway or
+// manual; the payment method fee of the order's fee schedule is added on top
+// of amount.
+func startPaymentAttempt(tx *gorm.DB, orderID uint, userID uint, amount float64, channel string, prefix string) (models.Payment, bool, *models.Payment, error) {
+	txPaymentRepo := paymentRepo.WithTx(tx)
+
+	order, err := orderRepo.WithTx(tx).FindByIDForUpdate(orderID)
+	if err != nil {
+		return models.Payment{}, false, nil, err
+	}
+
+	method := ""
+	if channel == "manual" {
+		method = "bank_transfer"
+	}
+
+	var fee float64
+	if order.FeeScheduleID != nil {
+		schedule, err := feeRepo.WithTx(tx).FindScheduleByID(*order.FeeScheduleID)
+		if err != nil {
+			return models.Payment{}, false, nil, err
+		}
+		fee, _ = paymentMethodFee(schedule, method)
+	}
+	charge := roundRupiah(amount + fee)
+
+	attempts, err := txPaymentRepo.FindAllByOrderID(orderID)
+	if err != nil {
+		return models.Payment{}, false, nil, err
+	}
+
+	var superseded *models.Payment
+	if active := activePaymentAttempt(attempts); active != nil {
+		if active.Channel == "manual" {
+			return models.Payment{}, false, nil, errors.New("a payment proof is already awaiting review")
+		}
+		// Re-opening checkout for the same amount resumes the attempt in progress
+		if channel == "gateway" && active.Amount == charge && active.SnapToken != "" {
+			return *active, true, nil, nil
+		}
+		log.Printf("[PaymentService] Attempt %d of order %d superseded by a new attempt", active.AttemptNumber, orderID)
+		active.Status = "expired"
+		if err := txPaymentRepo.Update(active); err != nil {
+			return models.Payment{}, false, nil, err
+		}
+		superseded = active
+	}
+
+	attemptNumber := len(attempts) + 1
+	payment := models.Payment{
+		OrderID:       orderID,
+		UserID:        userID,
+		Amount:        charge,
+		FeeAmount:     fee,
+		Status:        "pending",
+		Channel:       channel,
+		PaymentMethod: method,
+		AttemptNumber: attemptNumber,
+		TransactionID: fmt.Sprintf("%s-%03d-%d-%d", prefix, orderID, attemptNumber, time.Now().Unix()),
+	}
+	return payment, false, superseded, txPaymentRepo.Create(&payment)
+}
+
+// cancelSupersededAttempt stops the gateway charge of an attempt replaced by
+// a new one, so the buyer cannot pay both. Should it be paid anyway, its
+// settlement is flagged for refund by applyPaymentNotification.
+func cancelSupersededAttempt(superseded *models.Payment) {
+	if superseded == nil || superseded.SnapToken == "" {
+		return
+	}
+	if err := paymentGateway.Cancel(superseded.TransactionID); err != nil {
+		log.Printf("[PaymentService] Failed to cancel superseded payment %d (%s) at the gateway: %v", superseded.ID, superseded.TransactionID, err)
+	}
+}
+
+// activePaymentAttempt returns the attempt still waiting for the buyer, if any.
+func activePaymentAttempt(attempts []models.Payment) *models.Payment {
+	for i := range attempts {
+		if attempts[i].Status == "pending" {
+			return &attempts[i]
+		}
+	}
+	return nil
 }
 
 func ConfirmMockPayment(paymentID uint) error {
-	serverKey := strings.TrimSpace(os.Getenv("MIDTRANS_SERVER_KEY"))
-	if serverKey != "" && serverKey != "YOUR_MIDTRANS_SERVER_KEY_HERE" && !strings.Contains(serverKey, "PLACEHOLDER") {
+	if paymentGateway.Name() != "fake" {
 		return errors.New("cannot confirm mock payment in production/real mode")
 	}
 
@@ -197,16 +475,122 @@ func ConfirmMockPayment(paymentID uint) error {
 		return errors.New("payment not found")
 	}
 
+	if payment.Status == "partially_refunded" || payment.Status == "refunded" {
+		return errors.New("payment was already refunded")
+	}
+	wasSuccessful := payment.Status == "success"
 	payment.Status = "success"
-	if err := repositories.UpdatePayment(payment); err != nil {
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+
+		txOrderRepo := orderRepo.WithTx(tx)
+		txProductRepo := productRepo.WithTx(tx)
+		order, err := txOrderRepo.FindByIDForUpdate(payment.OrderID)
+		if err != nil {
+			return err
+		}
+
+		if !wasSuccessful {
+			if err := recordOrderPayment(txOrderRepo, &order, payment); err != nil {
+				return err
+			}
+		}
+
+		return changeOrderStatus(txOrderRepo, txProductRepo, &order, paidStatusFor(order), systemActor, "mock payment confirmed")
+	})
+}
+
+// recordOrderPayment adds a successful payment to what the order has been
+// paid. Its payment method fee is not part of the order total, so it is kept
+// apart as a fee line instead.
+func recordOrderPayment(orderRepo repositories.OrderRepository, order *models.Order, payment *models.Payment) error {
+	amount := payment.Amount - payment.FeeAmount
+	if err := orderRepo.AddAmountPaid(order.ID, amount); err != nil {
 		return err
 	}
+	order.AmountPaid += amount
 
-	order, err := orderRepo.FindByID(payment.OrderID)
-	if err != nil {
+	if payment.FeeAmount <= 0 {
+		return nil
+	}
+	description := "Payment fee"
+	if payment.Channel == "manual" {
+		description = "Bank transfer fee"
+	}
+	paymentID := payment.ID
+	fee := models.OrderFee{
+		OrderID:     order.ID,
+		PaymentID:   &paymentID,
+		Type:        "payment_method",
+		Payer:       "buyer",
+		Description: description,
+		Amount:      payment.FeeAmount,
+	}
+	if err := orderRepo.CreateFees([]models.OrderFee{fee}); err != nil {
 		return err
 	}
+	order.Fees = append(order.Fees, fee)
+	return nil
+}
+
+// flagPaymentForRefund records a payment that went through after it stopped
+// counting towards the order as refund due on the order, instead of adding it
+// to what the order has been paid. Its payment method fee is not refunded.
+func flagPaymentForRefund(orderRepo repositories.OrderRepository, order *models.Order, payment *models.Payment) error {
+	order.RefundDue += payment.Amount - payment.FeeAmount
+	log.Printf("[PaymentService] ⚠️ Payment %d of order %d settled after it stopped counting, refund due: %.2f", payment.ID, order.ID, order.RefundDue)
+	return orderRepo.SetRefundDue(order.ID, order.RefundDue)
+}
+
+// paidStatusFor returns "reserved" while a pre-order has only its deposit
+// paid and "paid" once the whole order is covered.
+func paidStatusFor(order models.Order) string {
+	if order.DepositAmount > 0 && order.AmountPaid < orderPayableTotal(order) {
+		return "reserved"
+	}
+	return "paid"
+}
 
-	order.Status = "paid"
-	return orderRepo.Update(&order)
+// orderPayableTotal is what the buyer owes for the order: the items plus
+// every farmer's shipping cost and the service fee, in whole rupiah.
+func orderPayableTotal(order models.Order) float64 {
+	total := order.TotalPrice + order.ServiceFee
+	for _, f := range order.Fulfillments {
+		if f.Status != "cancelled" {
+			total += f.ShippingCost
+		}
+	}
+	return roundRupiah(total)
+}
+
+// paymentAmountFor prices the next payment for the order. Normally that is
+// the outstanding balance; a pre-order payment plan also allows paying just
+// the deposit first. A requested amount of 0 picks the smallest allowed one.
+func paymentAmountFor(order models.Order, requested float64) (float64, error) {
+	if order.Status != "pending" && order.Status != "reserved" {
+		return 0, errors.New("order is not awaiting payment")
+	}
+
+	outstanding := orderPayableTotal(order) - order.AmountPaid
+	if outstanding <= 0 {
+		return 0, errors.New("order is not awaiting payment")
+	}
+
+	allowed := []float64{outstanding}
+	if order.DepositAmount > 0 && order.AmountPaid == 0 && order.DepositAmount < outstanding {
+		allowed = []float64{order.DepositAmount, outstanding}
+	}
+
+	if requested == 0 {
+		return allowed[0], nil
+	}
+	for _, amount := range allowed {
+		if math.Round(amount*100) == math.Round(requested*100) {
+			return amount, nil
+		}
+	}
+	return 0, fmt.Errorf("amount mismatch: expected %.2f", allowed[len(allowed)-1])
 }
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyMidtransSignature(t *testing.T) {
+	serverKey := "SB-Mid-server-test"
+	req := dto.PaymentWebhookRequest{
+		OrderID:           "ORD-001-1700000000",
+		StatusCode:        "200",
+		GrossAmount:       "150000.00",
+		TransactionStatus: "settlement",
+	}
+	sum := sha512.Sum512([]byte(req.OrderID + req.StatusCode + req.GrossAmount + serverKey))
+	req.SignatureKey = hex.EncodeToString(sum[:])
+
+	assert.True(t, verifyMidtransSignature(req, serverKey))
+	assert.False(t, verifyMidtransSignature(req, "another-key"))
+	assert.False(t, verifyMidtransSignature(req, ""))
+
+	tampered := req
+	tampered.GrossAmount = "1.00"
+	assert.False(t, verifyMidtransSignature(tampered, serverKey))
+
+	unsigned := req
+	unsigned.SignatureKey = ""
+	assert.False(t, verifyMidtransSignature(unsigned, serverKey))
+}
+
+func TestGrossAmountMatches(t *testing.T) {
+	assert.True(t, grossAmountMatches("150000.00", 150000))
+	assert.True(t, grossAmountMatches("150000", 150000))
+	assert.False(t, grossAmountMatches("149999.00", 150000))
+	assert.False(t, grossAmountMatches("abc", 150000))
+}
+
+func TestWebhookDedupKey(t *testing.T) {
+	pending := dto.PaymentWebhookRequest{OrderID: "ORD-1", TransactionID: "tx-1", TransactionStatus: "pending", StatusCode: "201"}
+	settled := pending
+	settled.TransactionStatus = "settlement"
+	settled.StatusCode = "200"
+
+	assert.Equal(t, webhookDedupKey(pending), webhookDedupKey(pending))
+	assert.NotEqual(t, webhookDedupKey(pending), webhookDedupKey(settled))
+}
+
+func TestNextPaymentStatus(t *testing.T) {
+	status := func(transactionStatus, fraudStatus string) dto.PaymentWebhookRequest {
+		return dto.PaymentWebhookRequest{TransactionStatus: transactionStatus, FraudStatus: fraudStatus}
+	}
+
+	assert.Equal(t, "success", nextPaymentStatus("pending", status("settlement", "")))
+	assert.Equal(t, "success", nextPaymentStatus("pending", status("capture", "accept")))
+	assert.Equal(t, "pending", nextPaymentStatus("pending", status("capture", "challenge")), "a challenged capture waits for review")
+	assert.Equal(t, "failed", nextPaymentStatus("pending", status("expire", "")))
+
+	// Late or replayed notifications never move a payment back
+	assert.Equal(t, "success", nextPaymentStatus("success", status("pending", "")))
+	assert.Equal(t, "success", nextPaymentStatus("success", status("expire", "")))
+	assert.Equal(t, "partially_refunded", nextPaymentStatus("partially_refunded", status("settlement", "")))
+	assert.Equal(t, "refunded", nextPaymentStatus("refunded", status("capture", "accept")))
+	assert.Equal(t, "failed", nextPaymentStatus("failed", status("pending", "")))
+	assert.Equal(t, "pending", nextPaymentStatus("pending", status("refund", "")))
+}
+
+func TestFailedAttemptCancelsOrder(t *testing.T) {
+	pending := models.Order{Status: "pending"}
+	failed := models.Payment{ID: 1, Status: "failed"}
+
+	assert.True(t, failedAttemptCancelsOrder(pending, []models.Payment{failed}, 1))
+	assert.True(t, failedAttemptCancelsOrder(pending, []models.Payment{failed, {ID: 2, Status: "expired"}}, 1))
+
+	// A retry in progress or one that went through keeps the order
+	assert.False(t, failedAttemptCancelsOrder(pending, []models.Payment{failed, {ID: 2, Status: "pending"}}, 1))
+	assert.False(t, failedAttemptCancelsOrder(pending, []models.Payment{failed, {ID: 2, Status: "success"}}, 1))
+	assert.False(t, failedAttemptCancelsOrder(models.Order{Status: "paid"}, []models.Payment{failed}, 1))
+	assert.False(t, failedAttemptCancelsOrder(models.Order{Status: "reserved"}, []models.Payment{failed}, 1))
+}
+
+func TestPaymentAmountFor(t *testing.T) {
+	order := models.Order{
+		Status:       "pending",
+		TotalPrice:   100000,
+		Fulfillments: []models.OrderFulfillment{{Status: "pending", ShippingCost: 10000}},
+	}
+
+	amount, err := paymentAmountFor(order, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 110000.0, amount)
+
+	_, err = paymentAmountFor(order, 1)
+	assert.EqualError(t, err, "amount mismatch: expected 110000.00")
+
+	// A pre-order plan allows the deposit first, then only the balance
+	order.DepositAmount = 30000
+	amount, err = paymentAmountFor(order, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 30000.0, amount)
+	amount, err = paymentAmountFor(order, 110000)
+	assert.NoError(t, err)
+	assert.Equal(t, 110000.0, amount)
+
+	order.Status = "reserved"
+	order.AmountPaid = 30000
+	_, err = paymentAmountFor(order, 30000)
+	assert.Error(t, err)
+	amount, err = paymentAmountFor(order, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 80000.0, amount)
+
+	// The service fee is part of what the buyer owes
+	order.ServiceFee = 2000
+	amount, err = paymentAmountFor(order, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 82000.0, amount)
+
+	// Payments are whole rupiah so the gateway charges exactly the amount
+	order.TotalPrice = 100000.4
+	amount, err = paymentAmountFor(order, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 82000.0, amount)
+
+	order.Status = "paid"
+	_, err = paymentAmountFor(order, 0)
+	assert.EqualError(t, err, "order is not awaiting payment")
+}
+
+func TestPaymentAttempts_OnlyOneActive(t *testing.T) {
+	attempts := []models.Payment{
+		{ID: 1, OrderID: 9, AttemptNumber: 1, Status: "failed"},
+		{ID: 2, OrderID: 9, AttemptNumber: 2, Status: "pending"},
+	}
+	active := activePaymentAttempt(attempts)
+	assert.NotNil(t, active)
+	assert.Equal(t, uint(2), active.ID)
+	assert.Nil(t, activePaymentAttempt(attempts[:1]))
+
+	// The unique active key exists only while an attempt is pending
+	assert.NoError(t, active.BeforeSave(nil))
+	assert.Equal(t, "order-9", *active.ActiveKey)
+	active.Status = "expired"
+	assert.NoError(t, active.BeforeSave(nil))
+	assert.Nil(t, active.ActiveKey)
+}
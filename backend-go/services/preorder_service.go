@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/policies"
+	"smartfarm-api/repositories"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PreOrderService interface {
+	RescheduleHarvest(productID uint, farmerID uint, req dto.RescheduleHarvestRequest) (dto.ProductResponse, error)
+}
+
+type preOrderService struct {
+	productRepo      repositories.ProductRepository
+	orderRepo        repositories.OrderRepository
+	notificationRepo repositories.NotificationRepository
+}
+
+func NewPreOrderService(productRepo repositories.ProductRepository, orderRepo repositories.OrderRepository, notificationRepo repositories.NotificationRepository) PreOrderService {
+	return &preOrderService{productRepo, orderRepo, notificationRepo}
+}
+
+// RescheduleHarvest moves the harvest date of a pre-order product. Every buyer
+// with an open order for it is notified and may cancel that order for a refund.
+func (s *preOrderService) RescheduleHarvest(productID uint, farmerID uint, req dto.RescheduleHarvestRequest) (dto.ProductResponse, error) {
+	harvestDate, err := time.Parse("2006-01-02", req.HarvestDate)
+	if err != nil {
+		return dto.ProductResponse{}, errors.New("invalid harvest date: use YYYY-MM-DD")
+	}
+
+	var product models.Product
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		txProductRepo := s.productRepo.WithTx(tx)
+		txOrderRepo := s.orderRepo.WithTx(tx)
+		txNotificationRepo := s.notificationRepo.WithTx(tx)
+
+		product, err = txProductRepo.FindByIDForUpdate(productID)
+		if err != nil {
+			return errors.New("product not found")
+		}
+		if !policies.OwnsProduct(farmerID, product) {
+			return policies.ErrForbidden
+		}
+		if !product.IsPreOrder {
+			return errors.New("product is not a pre-order")
+		}
+		if product.HarvestDate != nil && product.HarvestDate.Equal(harvestDate) {
+			return nil
+		}
+
+		product.HarvestDate = &harvestDate
+		if err := txProductRepo.Update(&product); err != nil {
+			return err
+		}
+
+		orders, err := txOrderRepo.FindOpenByProductID(product.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		message := fmt.Sprintf("The harvest of %s has moved to %s. You can keep your order or cancel it for a refund.",
+			product.Name, harvestDate.Format("2006-01-02"))
+		if req.Note != "" {
+			message += " Note from the farmer: " + req.Note
+		}
+
+		for _, order := range orders {
+			if err := txOrderRepo.MarkHarvestChanged(order.ID, now); err != nil {
+				return err
+			}
+
+			orderID := order.ID
+			if err := txNotificationRepo.Create(&models.Notification{
+				UserID:  order.UserID,
+				Type:    "harvest_date_changed",
+				Title:   "Harvest date changed",
+				Message: message,
+				OrderID: &orderID,
+			}); err != nil {
+				return err
+			}
+		}
+
+		log.Printf("[PreOrder] Product %d harvest moved to %s, %d buyers notified", product.ID, harvestDate.Format("2006-01-02"), len(orders))
+		return nil
+	})
+	if err != nil {
+		return dto.ProductResponse{}, err
+	}
+
+	return mapProductToResponse(product), nil
+}
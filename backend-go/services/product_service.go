@@ -1,16 +1,22 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"smartfarm-api/config"
 	"smartfarm-api/dto"
 	"smartfarm-api/models"
+	"smartfarm-api/policies"
 	"smartfarm-api/repositories"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type ProductService interface {
@@ -31,6 +37,16 @@ func NewProductService(repo repositories.ProductRepository) ProductService {
 }
 
 func (s *productService) CreateProduct(req dto.CreateProductRequest, farmerID uint) (dto.ProductResponse, error) {
+	if err := farmerCanSell(farmerID); err != nil {
+		return dto.ProductResponse{}, err
+	}
+	if err := validateSubscriptionSettings(req); err != nil {
+		return dto.ProductResponse{}, err
+	}
+	if err := validatePreOrderSettings(req); err != nil {
+		return dto.ProductResponse{}, err
+	}
+
 	// Handle Image Upload
 	imageURL := ""
 	if req.Image != nil {
@@ -62,6 +78,13 @@ func (s *productService) CreateProduct(req dto.CreateProductRequest, farmerID ui
 		HarvestDate:        harvestDate,
 		IsSubscription:     req.IsSubscription,
 		SubscriptionPeriod: req.SubscriptionPeriod,
+
+		HarvestQuantity:        req.HarvestQuantity,
+		PreOrderDepositPercent: req.PreOrderDepositPercent,
+
+		SubscriptionPriceWeekly:  req.SubscriptionPriceWeekly,
+		SubscriptionPriceMonthly: req.SubscriptionPriceMonthly,
+		SubscriptionMinPeriods:   req.SubscriptionMinPeriods,
 	}
 
 	err := s.repo.Create(&product)
@@ -163,40 +186,73 @@ func (s *productService) FindProductsByFarmerID(farmerID uint, page int, limit i
 }
 
 func (s *productService) UpdateProduct(id uint, req dto.CreateProductRequest, farmerID uint) (dto.ProductResponse, error) {
-	product, err := s.repo.FindByID(id)
-	if err != nil {
+	if err := farmerCanSell(farmerID); err != nil {
 		return dto.ProductResponse{}, err
 	}
 
-	if product.FarmerID != farmerID {
-		return dto.ProductResponse{}, fmt.Errorf("unauthorized to update this product")
+	if err := validateSubscriptionSettings(req); err != nil {
+		return dto.ProductResponse{}, err
+	}
+	if err := validatePreOrderSettings(req); err != nil {
+		return dto.ProductResponse{}, err
 	}
 
-	// Update fields
-	product.Name = req.Name
-	product.Description = req.Description
-	product.Price = req.Price
-	product.Stock = req.Stock
-	product.Category = req.Category
-	product.IsPreOrder = req.IsPreOrder
-	product.IsSubscription = req.IsSubscription
-	product.SubscriptionPeriod = req.SubscriptionPeriod
+	var harvestDate *time.Time
+	if req.IsPreOrder && req.HarvestDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.HarvestDate)
+		if err == nil {
+			harvestDate = &parsed
+		}
+	}
 
+	var imageURL string
 	if req.Image != nil {
 		filename, err := saveImage(req.Image)
 		if err == nil {
-			product.ImageURL = filename
+			imageURL = filename
 		}
 	}
 
-	if req.IsPreOrder && req.HarvestDate != "" {
-		parsed, err := time.Parse("2006-01-02", req.HarvestDate)
-		if err == nil {
-			product.HarvestDate = &parsed
+	var product models.Product
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txRepo := s.repo.WithTx(tx)
+
+		// Locked so an order reserving the harvest meanwhile is not lost
+		var err error
+		product, err = txRepo.FindByIDForUpdate(id)
+		if err != nil {
+			return err
+		}
+		if !policies.OwnsProduct(farmerID, product) {
+			return policies.ErrForbidden
+		}
+		if err := validateProductEdit(product, req, harvestDate); err != nil {
+			return err
 		}
-	}
 
-	err = s.repo.Update(&product)
+		// Update fields
+		product.Name = req.Name
+		product.Description = req.Description
+		product.Price = req.Price
+		product.Stock = req.Stock
+		product.Category = req.Category
+		product.IsPreOrder = req.IsPreOrder
+		product.HarvestQuantity = req.HarvestQuantity
+		product.PreOrderDepositPercent = req.PreOrderDepositPercent
+		product.IsSubscription = req.IsSubscription
+		product.SubscriptionPeriod = req.SubscriptionPeriod
+		product.SubscriptionPriceWeekly = req.SubscriptionPriceWeekly
+		product.SubscriptionPriceMonthly = req.SubscriptionPriceMonthly
+		product.SubscriptionMinPeriods = req.SubscriptionMinPeriods
+		if imageURL != "" {
+			product.ImageURL = imageURL
+		}
+		if product.HarvestDate == nil {
+			product.HarvestDate = harvestDate
+		}
+
+		return txRepo.UpdateDetails(&product)
+	})
 	if err != nil {
 		return dto.ProductResponse{}, err
 	}
@@ -204,49 +260,107 @@ func (s *productService) UpdateProduct(id uint, req dto.CreateProductRequest, fa
 	return mapProductToResponse(product), nil
 }
 
+// validateProductEdit checks a form edit against what orders already hold:
+// the harvest cannot shrink below what is reserved, and a harvest date once
+// set only moves through RescheduleHarvest so buyers are told about it.
+func validateProductEdit(product models.Product, req dto.CreateProductRequest, harvestDate *time.Time) error {
+	if product.ReservedQuantity > 0 && (!req.IsPreOrder || req.HarvestQuantity < product.ReservedQuantity) {
+		return fmt.Errorf("invalid pre-order settings: %d of the harvest is already reserved", product.ReservedQuantity)
+	}
+	if product.HarvestDate != nil && harvestDate != nil && !product.HarvestDate.Equal(*harvestDate) {
+		return errors.New("invalid pre-order settings: reschedule the harvest to change its date")
+	}
+	return nil
+}
+
 func (s *productService) DeleteProduct(id uint, farmerID uint) error {
 	product, err := s.repo.FindByID(id)
 	if err != nil {
 		return err
 	}
 
-	if product.FarmerID != farmerID {
-		return fmt.Errorf("unauthorized to delete this product")
+	if !policies.OwnsProduct(farmerID, product) {
+		return policies.ErrForbidden
 	}
 
 	return s.repo.Delete(id)
 }
 
+// validateSubscriptionSettings checks the periods a farmer offers and the
+// per-period prices before a product is saved.
+func validateSubscriptionSettings(req dto.CreateProductRequest) error {
+	if !req.IsSubscription {
+		return nil
+	}
+
+	periods := strings.Split(req.SubscriptionPeriod, ",")
+	for _, period := range periods {
+		period = strings.TrimSpace(period)
+		if period != "weekly" && period != "monthly" {
+			return fmt.Errorf("invalid subscription period %q: use weekly, monthly or weekly,monthly", period)
+		}
+	}
+
+	if req.SubscriptionPriceWeekly < 0 || req.SubscriptionPriceMonthly < 0 || req.SubscriptionMinPeriods < 0 {
+		return fmt.Errorf("invalid subscription settings: prices and minimum periods cannot be negative")
+	}
+	return nil
+}
+
+// validatePreOrderSettings checks the expected harvest and deposit of a
+// pre-order product.
+func validatePreOrderSettings(req dto.CreateProductRequest) error {
+	if !req.IsPreOrder {
+		return nil
+	}
+
+	if req.HarvestQuantity < 0 {
+		return fmt.Errorf("invalid pre-order settings: harvest quantity cannot be negative")
+	}
+	if req.PreOrderDepositPercent < 0 || req.PreOrderDepositPercent > 100 {
+		return fmt.Errorf("invalid pre-order settings: deposit percent must be between 0 and 100")
+	}
+	return nil
+}
+
 // Helpers
 func saveImage(file *multipart.FileHeader) (string, error) {
-	uploadDir := "uploads/products"
+	return saveUpload(file, "products")
+}
 
-	// pastikan folder ada
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
+// saveUpload stores the file under uploads/<subdir> and returns the path the
+// /uploads static route serves it from.
+func saveUpload(file *multipart.FileHeader, subdir string) (string, error) {
+	ext := filepath.Ext(file.Filename)
+	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
+	if err := writeUpload(file, filepath.Join("uploads", subdir), filename); err != nil {
 		return "", err
 	}
 
-	ext := filepath.Ext(file.Filename)
-	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	dst := filepath.Join(uploadDir, filename)
+	return fmt.Sprintf("%s/%s", subdir, filename), nil
+}
+
+// writeUpload copies the uploaded file to dir/filename.
+func writeUpload(file *multipart.FileHeader, dir string, filename string) error {
+	// pastikan folder ada
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
 
 	src, err := file.Open()
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer src.Close()
 
-	out, err := os.Create(dst)
+	out, err := os.Create(filepath.Join(dir, filename))
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer out.Close()
 
-	if _, err = io.Copy(out, src); err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("products/%s", filename), nil
+	_, err = io.Copy(out, src)
+	return err
 }
 
 func mapProductToResponse(p models.Product) dto.ProductResponse {
@@ -269,5 +383,21 @@ func mapProductToResponse(p models.Product) dto.ProductResponse {
 		HarvestDate:        harvestDateStr,
 		IsSubscription:     p.IsSubscription,
 		SubscriptionPeriod: p.SubscriptionPeriod,
+
+		HarvestQuantity:        p.HarvestQuantity,
+		ReservedQuantity:       p.ReservedQuantity,
+		PreOrderDepositPercent: p.PreOrderDepositPercent,
+
+		SubscriptionPriceWeekly:  p.SubscriptionPriceWeekly,
+		SubscriptionPriceMonthly: p.SubscriptionPriceMonthly,
+		SubscriptionMinPeriods:   p.SubscriptionMinPeriods,
+	}
+}
+
+func farmerCanSell(farmerID uint) error {
+	farmer, err := repositories.FindUserByID(farmerID)
+	if err != nil {
+		return policies.ErrForbidden
 	}
+	return policies.CanSell(*farmer)
 }
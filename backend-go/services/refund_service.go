@@ -0,0 +1,522 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/policies"
+	"smartfarm-api/repositories"
+
+	"gorm.io/gorm"
+)
+
+type RefundService interface {
+	RefundOrder(orderID uint, actor OrderActor, req dto.RefundOrderRequest) (dto.RefundOrderResponse, error)
+}
+
+type refundService struct {
+	orderRepo   repositories.OrderRepository
+	productRepo repositories.ProductRepository
+	paymentRepo repositories.PaymentRepository
+	refundRepo  repositories.RefundRepository
+	ledgerRepo  repositories.LedgerRepository
+	gateway     PaymentGateway
+}
+
+func NewRefundService(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, paymentRepo repositories.PaymentRepository, refundRepo repositories.RefundRepository, ledgerRepo repositories.LedgerRepository, gateway PaymentGateway) RefundService {
+	return &refundService{orderRepo, productRepo, paymentRepo, refundRepo, ledgerRepo, gateway}
+}
+
+// refundLine is part of one order item being refunded.
+type refundLine struct {
+	item     *models.OrderItem
+	quantity int
+	amount   float64
+	reason   string
+}
+
+// refundAllocation is the share of a refund taken from one payment.
+type refundAllocation struct {
+	payment models.Payment
+	amount  float64
+}
+
+// RefundOrder gives money back through the payment gateway, or records it to
+// be transferred back by hand for manual payments, fully or for part of the
+// items. Admins may refund any order; a farmer only the items they
+// supplied. A cancelled order that was already paid has no items left to
+// refund, so its refund due is paid back instead.
+//
+// The refund is recorded as pending, holding the money and items it takes so
+// a concurrent refund cannot spend them too, before the gateway is called
+// outside of any transaction. The outcome is then recorded: a failed refund
+// gives back what it held. A request repeated with the same idempotency key
+// returns the refunds already made.
+func (s *refundService) RefundOrder(orderID uint, actor OrderActor, req dto.RefundOrderRequest) (dto.RefundOrderResponse, error) {
+	refunds, transactionIDs, err := s.startRefund(orderID, actor, req)
+	if err != nil {
+		return dto.RefundOrderResponse{}, err
+	}
+
+	var order models.Order
+	if transactionIDs == nil {
+		order, err = s.orderRepo.FindByID(orderID)
+		if err != nil {
+			return dto.RefundOrderResponse{}, errors.New("order not found")
+		}
+		log.Printf("[Refund] Order %d: refund %s already requested, not repeated", orderID, req.IdempotencyKey)
+		for _, refund := range refunds {
+			if refund.Status == "failed" {
+				return dto.RefundOrderResponse{}, errors.New("refund failed: this request already failed, retry with a new idempotency key")
+			}
+		}
+		return mapRefundOrderToResponse(order, refunds), nil
+	}
+
+	gatewayErr := s.sendRefunds(orderID, refunds, transactionIDs, req.Reason)
+
+	order, err = s.finishRefund(orderID, actor, req, refunds)
+	if err != nil {
+		log.Printf("[Refund] ⚠️ Order %d: failed to record the gateway outcome of refunds %s, reconcile manually: %v", orderID, req.IdempotencyKey, err)
+		return dto.RefundOrderResponse{}, err
+	}
+	if gatewayErr != nil {
+		return dto.RefundOrderResponse{}, fmt.Errorf("refund failed: %v", gatewayErr)
+	}
+	return mapRefundOrderToResponse(order, refunds), nil
+}
+
+// sendRefunds asks the gateway for each pending refund and sets its status.
+// Refunds of manual payments are left to be transferred back by hand. Once
+// one gateway refund fails the rest are not attempted and its error is
+// returned.
+func (s *refundService) sendRefunds(orderID uint, refunds []models.Refund, transactionIDs []string, reason string) error {
+	var gatewayErr error
+	for i := range refunds {
+		if gatewayErr != nil {
+			refunds[i].Status = "failed"
+			continue
+		}
+		if refunds[i].Gateway == "manual" {
+			refunds[i].Status = "manual"
+			log.Printf("[Refund] Order %d: %.2f of manual payment %d to be transferred back to the buyer", orderID, refunds[i].Amount, refunds[i].PaymentID)
+			continue
+		}
+		if err := s.gateway.Refund(transactionIDs[i], refunds[i].Amount, reason); err != nil {
+			if i > 0 {
+				log.Printf("[Refund] ⚠️ Order %d: gateway refund of %s failed after earlier payments were refunded, reconcile manually", orderID, transactionIDs[i])
+			}
+			gatewayErr = err
+			refunds[i].Status = "failed"
+			continue
+		}
+		refunds[i].Status = "succeeded"
+	}
+	return gatewayErr
+}
+
+// startRefund plans the refund and records it as pending refunds, one per
+// payment it is taken from. The refunded amount of those payments, the
+// refunded quantity of the items and the order's refund due are taken right
+// away. It returns the transaction ID of each refund's payment, or nil when
+// the idempotency key was already used and the refunds returned are the ones
+// made then.
+func (s *refundService) startRefund(orderID uint, actor OrderActor, req dto.RefundOrderRequest) ([]models.Refund, []string, error) {
+	var refunds []models.Refund
+	var transactionIDs []string
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txOrderRepo := s.orderRepo.WithTx(tx)
+		txPaymentRepo := s.paymentRepo.WithTx(tx)
+		txRefundRepo := s.refundRepo.WithTx(tx)
+
+		order, err := txOrderRepo.FindByIDForUpdate(orderID)
+		if err != nil {
+			return errors.New("order not found")
+		}
+
+		if !policies.CanReviewOrder(actor, order) {
+			return policies.ErrForbidden
+		}
+
+		refunds, err = txRefundRepo.FindByIdempotencyKey(order.ID, req.IdempotencyKey)
+		if err != nil || len(refunds) > 0 {
+			return err
+		}
+
+		lines, amount, err := planRefund(&order, actor, req)
+		if err != nil {
+			return err
+		}
+
+		payments, err := txPaymentRepo.FindRefundableByOrderIDForUpdate(order.ID)
+		if err != nil {
+			return err
+		}
+		allocations, amount := allocateRefund(payments, amount)
+		if amount == 0 {
+			return errors.New("nothing to refund")
+		}
+
+		key := req.IdempotencyKey
+		for i, a := range allocations {
+			payment := a.payment
+			payment.RefundedAmount += a.amount
+			if err := txPaymentRepo.Update(&payment); err != nil {
+				return err
+			}
+
+			gateway := s.gateway.Name()
+			if payment.Channel == "manual" {
+				gateway = "manual"
+			}
+			refund := models.Refund{
+				OrderID:        order.ID,
+				PaymentID:      payment.ID,
+				Status:         "pending",
+				IdempotencyKey: &key,
+				Amount:         a.amount,
+				Reason:         req.Reason,
+				Restocked:      req.Restock && len(lines) > 0,
+				Gateway:        gateway,
+				ActorID:        actor.UserID,
+				ActorRole:      actor.Role,
+			}
+			if i == 0 {
+				for _, line := range lines {
+					refund.Items = append(refund.Items, models.RefundItem{
+						OrderItemID: line.item.ID,
+						ProductID:   line.item.ProductID,
+						Quantity:    line.quantity,
+						Amount:      line.amount,
+						Reason:      line.reason,
+					})
+				}
+			}
+			if err := txRefundRepo.Create(&refund); err != nil {
+				return err
+			}
+			refunds = append(refunds, refund)
+			transactionIDs = append(transactionIDs, payment.TransactionID)
+		}
+
+		for _, line := range lines {
+			if err := txOrderRepo.UpdateItemRefundedQuantity(line.item.ID, line.item.RefundedQuantity+line.quantity); err != nil {
+				return err
+			}
+		}
+
+		if len(lines) == 0 {
+			if err := txOrderRepo.SetRefundDue(order.ID, math.Max(0, order.RefundDue-amount)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return refunds, transactionIDs, nil
+}
+
+// finishRefund records what the gateway did with each pending refund. When
+// they all succeeded the payments are marked refunded, farmers are debited,
+// items are restocked and the order follows; otherwise the failed refunds
+// give back the money they held, and the items are released because the
+// refund as a whole did not go through.
+func (s *refundService) finishRefund(orderID uint, actor OrderActor, req dto.RefundOrderRequest, refunds []models.Refund) (models.Order, error) {
+	var order models.Order
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txOrderRepo := s.orderRepo.WithTx(tx)
+		txProductRepo := s.productRepo.WithTx(tx)
+		txPaymentRepo := s.paymentRepo.WithTx(tx)
+		txRefundRepo := s.refundRepo.WithTx(tx)
+
+		var err error
+		order, err = txOrderRepo.FindByIDForUpdate(orderID)
+		if err != nil {
+			return errors.New("order not found")
+		}
+
+		succeeded := true
+		var released float64
+		for i := range refunds {
+			refund := &refunds[i]
+			payment, err := txPaymentRepo.FindByIDForUpdate(refund.PaymentID)
+			if err != nil {
+				return err
+			}
+
+			if refund.Status == "succeeded" || refund.Status == "manual" {
+				payment.Status = "partially_refunded"
+				if math.Round(payment.RefundedAmount*100) >= math.Round((payment.Amount-payment.FeeAmount)*100) {
+					payment.Status = "refunded"
+				}
+			} else {
+				succeeded = false
+				payment.RefundedAmount = math.Max(0, payment.RefundedAmount-refund.Amount)
+				released += refund.Amount
+			}
+			if err := txPaymentRepo.Update(payment); err != nil {
+				return err
+			}
+			if err := txRefundRepo.Update(refund); err != nil {
+				return err
+			}
+		}
+
+		lines := refundedLines(&order, refunds[0].Items)
+		if !succeeded {
+			for _, line := range lines {
+				line.item.RefundedQuantity = max(0, line.item.RefundedQuantity-line.quantity)
+				if err := txOrderRepo.UpdateItemRefundedQuantity(line.item.ID, line.item.RefundedQuantity); err != nil {
+					return err
+				}
+			}
+			if len(lines) == 0 && released > 0 {
+				order.RefundDue += released
+				return txOrderRepo.SetRefundDue(order.ID, order.RefundDue)
+			}
+			return nil
+		}
+
+		// Farmers already credited for these items give the money back
+		if err := debitRefundedItems(s.ledgerRepo.WithTx(tx), order, refunds[0].ID, lines); err != nil {
+			return err
+		}
+
+		if req.Restock {
+			var restock []models.OrderItem
+			for _, line := range lines {
+				returned := *line.item
+				returned.Quantity = line.quantity
+				restock = append(restock, returned)
+			}
+			if err := restockItems(txProductRepo, order.ID, restock); err != nil {
+				return err
+			}
+		}
+
+		var amount float64
+		for _, refund := range refunds {
+			amount += refund.Amount
+		}
+		log.Printf("[Refund] Order %d refunded %.2f by %s %d: %s", order.ID, amount, actor.Role, actor.UserID, req.Reason)
+		return applyRefundStatus(txOrderRepo, txProductRepo, &order, actor, "refund: "+req.Reason)
+	})
+	return order, err
+}
+
+// refundedLines matches the items of a refund with the order's items.
+func refundedLines(order *models.Order, items []models.RefundItem) []refundLine {
+	var lines []refundLine
+	for _, refunded := range items {
+		for i := range order.OrderItems {
+			if order.OrderItems[i].ID == refunded.OrderItemID {
+				lines = append(lines, refundLine{
+					item:     &order.OrderItems[i],
+					quantity: refunded.Quantity,
+					amount:   refunded.Amount,
+					reason:   refunded.Reason,
+				})
+				break
+			}
+		}
+	}
+	return lines
+}
+
+// planRefund works out which items are refunded and for how much. With no
+// items requested, everything the actor may refund and that has not been
+// refunded yet is included, unless the order has a refund due.
+func planRefund(order *models.Order, actor OrderActor, req dto.RefundOrderRequest) ([]refundLine, float64, error) {
+	// Money paid on top of the order, e.g. by a superseded attempt that was
+	// paid anyway, is given back by an admin before any item
+	if order.Status != "cancelled" && order.RefundDue > 0 && len(req.Items) == 0 && actor.Role == "admin" {
+		return nil, order.RefundDue, nil
+	}
+
+	switch order.Status {
+	case "cancelled":
+		// Items were already returned to stock when the order was cancelled
+		if len(req.Items) > 0 {
+			return nil, 0, errors.New("invalid refund: a cancelled order can only be refunded as a whole")
+		}
+		if order.RefundDue <= 0 {
+			return nil, 0, errors.New("nothing to refund")
+		}
+		return nil, order.RefundDue, nil
+	case "reserved", "paid", "shipped", "completed":
+	default:
+		return nil, 0, errors.New("nothing to refund")
+	}
+
+	var lines []refundLine
+	var amount float64
+	addLine := func(item *models.OrderItem, quantity int, reason string) {
+		value := item.Price * float64(quantity)
+		lines = append(lines, refundLine{item: item, quantity: quantity, amount: value, reason: reason})
+		amount += value
+	}
+
+	if len(req.Items) == 0 {
+		for i := range order.OrderItems {
+			item := &order.OrderItems[i]
+			left := item.Quantity - item.RefundedQuantity
+			if left <= 0 || !policies.CanRefundItem(actor, *order, *item) {
+				continue
+			}
+			addLine(item, left, "")
+		}
+		if len(lines) == 0 {
+			return nil, 0, errors.New("nothing to refund")
+		}
+		return lines, roundRupiah(amount), nil
+	}
+
+	requested := map[uint]int{}
+	for _, itemReq := range req.Items {
+		var item *models.OrderItem
+		for i := range order.OrderItems {
+			if order.OrderItems[i].ID == itemReq.OrderItemID {
+				item = &order.OrderItems[i]
+				break
+			}
+		}
+		if item == nil {
+			return nil, 0, fmt.Errorf("invalid refund: item %d is not part of this order", itemReq.OrderItemID)
+		}
+		if !policies.CanRefundItem(actor, *order, *item) {
+			return nil, 0, policies.ErrForbidden
+		}
+
+		requested[item.ID] += itemReq.Quantity
+		left := item.Quantity - item.RefundedQuantity
+		if requested[item.ID] > left {
+			return nil, 0, fmt.Errorf("invalid refund: only %d of item %d left to refund", left, item.ID)
+		}
+		addLine(item, itemReq.Quantity, itemReq.Reason)
+	}
+	return lines, roundRupiah(amount), nil
+}
+
+// allocateRefund takes the refund from the newest payments first and caps it
+// at what is left on them, e.g. only the deposit of a reserved pre-order.
+// Payment method fees are not refunded.
+func allocateRefund(payments []models.Payment, amount float64) ([]refundAllocation, float64) {
+	var allocations []refundAllocation
+	total := 0.0
+	for _, payment := range payments {
+		if amount-total <= 0 {
+			break
+		}
+		left := payment.Amount - payment.FeeAmount - payment.RefundedAmount
+		if left <= 0 {
+			continue
+		}
+		share := math.Min(left, amount-total)
+		allocations = append(allocations, refundAllocation{payment: payment, amount: share})
+		total += share
+	}
+	return allocations, total
+}
+
+// applyRefundStatus marks fulfillments whose items were all refunded as
+// refunded and lets the order follow; orders without fulfillments move once
+// every item is refunded.
+func applyRefundStatus(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, order *models.Order, actor OrderActor, note string) error {
+	if order.Status == "cancelled" {
+		return nil
+	}
+
+	if len(order.Fulfillments) == 0 {
+		for _, item := range order.OrderItems {
+			if item.RefundedQuantity < item.Quantity {
+				return nil
+			}
+		}
+		return changeOrderStatus(orderRepo, productRepo, order, "refunded", actor, note)
+	}
+
+	for i := range order.Fulfillments {
+		f := &order.Fulfillments[i]
+		if f.Status == "refunded" || f.Status == "cancelled" || !fulfillmentFullyRefunded(*order, f.ID) {
+			continue
+		}
+
+		from := f.Status
+		if !canTransitionOrder(from, "refunded") {
+			return fmt.Errorf("invalid status transition: %s -> refunded", from)
+		}
+		f.Status = "refunded"
+		if err := orderRepo.SaveFulfillment(f); err != nil {
+			return err
+		}
+
+		fulfillmentID := f.ID
+		if err := orderRepo.CreateStatusLog(&models.OrderStatusLog{
+			OrderID:       order.ID,
+			FulfillmentID: &fulfillmentID,
+			FromStatus:    from,
+			ToStatus:      "refunded",
+			ActorID:       actor.UserID,
+			ActorRole:     actor.Role,
+			Note:          note,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return changeOrderStatus(orderRepo, productRepo, order, aggregateFulfillmentStatus(*order), actor, note)
+}
+
+func fulfillmentFullyRefunded(order models.Order, fulfillmentID uint) bool {
+	found := false
+	for _, item := range order.OrderItems {
+		if item.FulfillmentID == nil || *item.FulfillmentID != fulfillmentID {
+			continue
+		}
+		found = true
+		if item.RefundedQuantity < item.Quantity {
+			return false
+		}
+	}
+	return found
+}
+
+func mapRefundOrderToResponse(order models.Order, refunds []models.Refund) dto.RefundOrderResponse {
+	res := dto.RefundOrderResponse{Order: mapOrderToResponse(order), Refunds: []dto.RefundResponse{}}
+	for _, refund := range refunds {
+		res.Refunds = append(res.Refunds, mapRefundToResponse(refund))
+	}
+	return res
+}
+
+func mapRefundToResponse(r models.Refund) dto.RefundResponse {
+	res := dto.RefundResponse{
+		ID:        r.ID,
+		OrderID:   r.OrderID,
+		PaymentID: r.PaymentID,
+		Amount:    r.Amount,
+		Status:    r.Status,
+		Reason:    r.Reason,
+		Restocked: r.Restocked,
+		Items:     []dto.RefundItemResponse{},
+		CreatedAt: r.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	for _, item := range r.Items {
+		res.Items = append(res.Items, dto.RefundItemResponse{
+			OrderItemID: item.OrderItemID,
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+			Amount:      item.Amount,
+			Reason:      item.Reason,
+		})
+	}
+	return res
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func refundTestOrder() models.Order {
+	f1, f2 := uint(10), uint(20)
+	return models.Order{
+		ID:     1,
+		Status: "paid",
+		Fulfillments: []models.OrderFulfillment{
+			{ID: 10, FarmerID: 7, Status: "paid"},
+			{ID: 20, FarmerID: 8, Status: "paid"},
+		},
+		OrderItems: []models.OrderItem{
+			{ID: 100, FulfillmentID: &f1, ProductID: 1, Quantity: 2, Price: 10000},
+			{ID: 200, FulfillmentID: &f2, ProductID: 2, Quantity: 1, Price: 50000},
+		},
+	}
+}
+
+func TestPlanRefund(t *testing.T) {
+	admin := OrderActor{UserID: 1, Role: "admin"}
+	farmer := OrderActor{UserID: 7, Role: "petani"}
+
+	order := refundTestOrder()
+	lines, amount, err := planRefund(&order, admin, dto.RefundOrderRequest{Reason: "damaged"})
+	assert.NoError(t, err)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, 70000.0, amount)
+
+	// Farmers only get their own items when refunding everything
+	lines, amount, err = planRefund(&order, farmer, dto.RefundOrderRequest{Reason: "damaged"})
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1)
+	assert.Equal(t, 20000.0, amount)
+
+	_, _, err = planRefund(&order, farmer, dto.RefundOrderRequest{Items: []dto.RefundItemRequest{{OrderItemID: 200, Quantity: 1}}})
+	assert.EqualError(t, err, "unauthorized")
+
+	order.OrderItems[0].RefundedQuantity = 1
+	_, _, err = planRefund(&order, admin, dto.RefundOrderRequest{Items: []dto.RefundItemRequest{{OrderItemID: 100, Quantity: 2}}})
+	assert.EqualError(t, err, "invalid refund: only 1 of item 100 left to refund")
+
+	cancelled := models.Order{Status: "cancelled", RefundDue: 30000}
+	_, amount, err = planRefund(&cancelled, admin, dto.RefundOrderRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 30000.0, amount)
+
+	// A superseded attempt paid anyway is given back before any item
+	overpaid := refundTestOrder()
+	overpaid.RefundDue = 25000
+	lines, amount, err = planRefund(&overpaid, admin, dto.RefundOrderRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+	assert.Equal(t, 25000.0, amount)
+	lines, _, err = planRefund(&overpaid, farmer, dto.RefundOrderRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1)
+
+	_, _, err = planRefund(&models.Order{Status: "pending"}, admin, dto.RefundOrderRequest{})
+	assert.EqualError(t, err, "nothing to refund")
+}
+
+func TestAllocateRefund(t *testing.T) {
+	payments := []models.Payment{
+		{ID: 2, Amount: 70000},                        // balance
+		{ID: 1, Amount: 30000, RefundedAmount: 10000}, // deposit
+	}
+
+	allocations, total := allocateRefund(payments, 80000)
+	assert.Equal(t, 80000.0, total)
+	assert.Len(t, allocations, 2)
+	assert.Equal(t, 70000.0, allocations[0].amount)
+	assert.Equal(t, 10000.0, allocations[1].amount)
+
+	// Capped at what is left to refund
+	_, total = allocateRefund(payments, 200000)
+	assert.Equal(t, 90000.0, total)
+}
+
+type refundsGateway struct {
+	PaymentGateway
+	refunded []string
+	fail     map[string]bool
+}
+
+func (g *refundsGateway) Name() string { return "fake" }
+
+func (g *refundsGateway) Refund(transactionID string, amount float64, reason string) error {
+	if g.fail[transactionID] {
+		return errors.New("gateway down")
+	}
+	g.refunded = append(g.refunded, transactionID)
+	return nil
+}
+
+func TestSendRefunds_ManualPaymentsAreNotSentToTheGateway(t *testing.T) {
+	gateway := &refundsGateway{}
+	s := &refundService{gateway: gateway}
+
+	refunds := []models.Refund{{Gateway: "fake", Amount: 10000}, {Gateway: "manual", Amount: 5000}}
+	assert.NoError(t, s.sendRefunds(1, refunds, []string{"ORD-001-2-1", "TRF-001-1-1"}, "damaged"))
+	assert.Equal(t, []string{"ORD-001-2-1"}, gateway.refunded)
+	assert.Equal(t, "succeeded", refunds[0].Status)
+	assert.Equal(t, "manual", refunds[1].Status)
+
+	// Nothing after a failed gateway refund is attempted
+	gateway = &refundsGateway{fail: map[string]bool{"ORD-001-2-1": true}}
+	s.gateway = gateway
+	refunds = []models.Refund{{Gateway: "fake"}, {Gateway: "fake"}}
+	assert.EqualError(t, s.sendRefunds(1, refunds, []string{"ORD-001-2-1", "ORD-001-1-1"}, "damaged"), "gateway down")
+	assert.Empty(t, gateway.refunded)
+	assert.Equal(t, "failed", refunds[0].Status)
+	assert.Equal(t, "failed", refunds[1].Status)
+}
+
+func TestRefundedLines(t *testing.T) {
+	order := refundTestOrder()
+	lines := refundedLines(&order, []models.RefundItem{
+		{OrderItemID: 200, Quantity: 1, Amount: 50000},
+		{OrderItemID: 999, Quantity: 1, Amount: 1},
+	})
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, 50000.0, lines[0].amount)
+		// Lines point into the order so releasing them updates its items
+		lines[0].item.RefundedQuantity = 1
+		assert.Equal(t, 1, order.OrderItems[1].RefundedQuantity)
+	}
+	assert.Empty(t, refundedLines(&order, nil))
+}
+
+func TestAggregateFulfillmentStatus_Refunded(t *testing.T) {
+	order := refundTestOrder()
+	order.Fulfillments[0].Status = "refunded"
+	assert.Equal(t, "paid", aggregateFulfillmentStatus(order))
+
+	order.Fulfillments[1].Status = "cancelled"
+	assert.Equal(t, "refunded", aggregateFulfillmentStatus(order))
+}
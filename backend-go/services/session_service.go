@@ -0,0 +1,307 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"smartfarm-api/auth"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"smartfarm-api/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var sessionRepo repositories.SessionRepository
+
+// AuthTokens is what a sign-in or a refresh hands to the client.
+type AuthTokens struct {
+	SessionID        uint
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+func InitSessionService() {
+	sessionRepo = repositories.NewSessionRepository(config.DB)
+}
+
+// accessTokenTTL keeps access tokens short-lived (ACCESS_TOKEN_TTL, default
+// 15m); clients refresh them with their refresh token.
+func accessTokenTTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// refreshTokenTTL is how long a device stays signed in without using the app
+// (REFRESH_TOKEN_TTL, default 30 days). Every refresh starts it over.
+func refreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// refreshRaceGrace is how long after a refresh token was used presenting it
+// again is taken for a second tab that refreshed at the same moment rather
+// than for a stolen copy.
+var refreshRaceGrace = 30 * time.Second
+
+// StartSession signs the user in on a new device.
+func StartSession(user models.User, userAgent string, ip string) (AuthTokens, error) {
+	var tokens AuthTokens
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := models.Session{
+			UserID:     user.ID,
+			UserAgent:  truncate(userAgent, 255),
+			IP:         ip,
+			LastUsedAt: now,
+			ExpiresAt:  now.Add(refreshTokenTTL()),
+		}
+		txSessionRepo := sessionRepo.WithTx(tx)
+		if err := txSessionRepo.Create(&session); err != nil {
+			return err
+		}
+
+		var err error
+		tokens, err = issueSessionTokens(txSessionRepo, &session, user, now)
+		return err
+	})
+	return tokens, err
+}
+
+// RefreshSession trades a refresh token for a new access token and a new
+// refresh token. A refresh token works once: presenting one that was already
+// used means someone else holds a copy, so the whole session is logged out.
+// Within refreshRaceGrace of the first use it only fails with "refresh token
+// already rotated": the browser already holds the new token, which another tab
+// received, and can simply retry.
+func RefreshSession(refreshToken string, userAgent string, ip string) (AuthTokens, error) {
+	if refreshToken == "" {
+		return AuthTokens{}, errors.New("invalid refresh token")
+	}
+
+	var tokens AuthTokens
+	var reusedSessionID uint
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		txSessionRepo := sessionRepo.WithTx(tx)
+
+		token, err := txSessionRepo.FindRefreshTokenForUpdate(utils.HashToken(refreshToken))
+		if err != nil {
+			return errors.New("invalid refresh token")
+		}
+		session, err := txSessionRepo.FindByIDForUpdate(token.SessionID)
+		if err != nil || session.RevokedAt != nil || !now.Before(session.ExpiresAt) || !now.Before(token.ExpiresAt) {
+			return errors.New("invalid refresh token")
+		}
+
+		if token.UsedAt != nil {
+			if now.Sub(*token.UsedAt) < refreshRaceGrace {
+				return errors.New("refresh token already rotated")
+			}
+			// Commit the logout rather than roll it back with an error
+			reusedSessionID = session.ID
+			return revokeSession(txSessionRepo, &session, now)
+		}
+
+		user, err := repositories.FindUserByID(session.UserID)
+		if err != nil {
+			return errors.New("invalid refresh token")
+		}
+
+		if err := txSessionRepo.MarkRefreshTokenUsed(token.ID, now); err != nil {
+			return err
+		}
+		// The access token being replaced goes with the refresh token
+		if err := revokeAccessToken(txSessionRepo, session, now); err != nil {
+			return err
+		}
+
+		session.UserAgent = truncate(userAgent, 255)
+		session.IP = ip
+		session.ExpiresAt = now.Add(refreshTokenTTL())
+		tokens, err = issueSessionTokens(txSessionRepo, &session, *user, now)
+		return err
+	})
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	if reusedSessionID != 0 {
+		log.Printf("[Session] Refresh token of session %d was reused; session logged out", reusedSessionID)
+		return AuthTokens{}, errors.New("invalid refresh token")
+	}
+	return tokens, nil
+}
+
+// EndSession logs one of the user's devices out. Its refresh token stops
+// working and its current access token is revoked.
+func EndSession(userID uint, sessionID uint) error {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txSessionRepo := sessionRepo.WithTx(tx)
+		session, err := txSessionRepo.FindByIDForUpdate(sessionID)
+		if err != nil || session.UserID != userID {
+			return errors.New("session not found")
+		}
+		if session.RevokedAt != nil {
+			return nil
+		}
+		return revokeSession(txSessionRepo, &session, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+
+	purgeRevokedTokens()
+	return nil
+}
+
+// EndSessionByRefreshToken logs out the device holding the refresh token, for
+// a logout whose access token has already expired.
+func EndSessionByRefreshToken(refreshToken string) error {
+	token, err := sessionRepo.FindRefreshToken(utils.HashToken(refreshToken))
+	if err != nil {
+		return errors.New("session not found")
+	}
+	session, err := sessionRepo.FindByID(token.SessionID)
+	if err != nil {
+		return errors.New("session not found")
+	}
+	return EndSession(session.UserID, token.SessionID)
+}
+
+// EndAllSessions logs the user out everywhere except on keepSessionID, which
+// may be 0 to keep nothing. It returns how many sessions were ended.
+func EndAllSessions(userID uint, keepSessionID uint) (int, error) {
+	ended := 0
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		txSessionRepo := sessionRepo.WithTx(tx)
+
+		sessions, err := txSessionRepo.FindActiveByUserID(userID, now)
+		if err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			if s.ID == keepSessionID {
+				continue
+			}
+			session, err := txSessionRepo.FindByIDForUpdate(s.ID)
+			if err != nil {
+				return err
+			}
+			if session.RevokedAt != nil {
+				continue
+			}
+			if err := revokeSession(txSessionRepo, &session, now); err != nil {
+				return err
+			}
+			ended++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purgeRevokedTokens()
+	return ended, nil
+}
+
+// GetSessions lists the devices the user is signed in on.
+func GetSessions(userID uint, currentSessionID uint) ([]dto.SessionResponse, error) {
+	sessions, err := sessionRepo.FindActiveByUserID(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	res := []dto.SessionResponse{}
+	for _, s := range sessions {
+		res = append(res, dto.SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			Current:    s.ID == currentSessionID,
+			CreatedAt:  s.CreatedAt.Format(time.RFC3339),
+			LastUsedAt: s.LastUsedAt.Format(time.RFC3339),
+			ExpiresAt:  s.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	return res, nil
+}
+
+// IsTokenRevoked checks the access token revocation list.
+func IsTokenRevoked(jti string) (bool, error) {
+	if sessionRepo == nil {
+		return false, errors.New("session service is not initialised")
+	}
+	return sessionRepo.IsTokenRevoked(jti)
+}
+
+// issueSessionTokens creates the session's next refresh token and a new
+// access token, and saves the session with the access token's ID.
+func issueSessionTokens(txSessionRepo repositories.SessionRepository, session *models.Session, user models.User, now time.Time) (AuthTokens, error) {
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	if err := txSessionRepo.CreateRefreshToken(&models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	}); err != nil {
+		return AuthTokens{}, err
+	}
+
+	accessToken, claims, err := auth.GenerateToken(user.ID, user.Role, session.ID, accessTokenTTL())
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	session.AccessJTI = claims.ID
+	session.AccessExpiresAt = claims.ExpiresAt.Time
+	session.LastUsedAt = now
+	if err := txSessionRepo.Update(session); err != nil {
+		return AuthTokens{}, err
+	}
+
+	return AuthTokens{
+		SessionID:        session.ID,
+		AccessToken:      accessToken,
+		AccessExpiresAt:  session.AccessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+func revokeSession(txSessionRepo repositories.SessionRepository, session *models.Session, now time.Time) error {
+	session.RevokedAt = &now
+	if err := txSessionRepo.Update(session); err != nil {
+		return err
+	}
+	return revokeAccessToken(txSessionRepo, *session, now)
+}
+
+// revokeAccessToken puts the session's current access token on the
+// revocation list unless it has expired already.
+func revokeAccessToken(txSessionRepo repositories.SessionRepository, session models.Session, now time.Time) error {
+	if session.AccessJTI == "" || !session.AccessExpiresAt.After(now) {
+		return nil
+	}
+	return txSessionRepo.RevokeToken(session.AccessJTI, session.AccessExpiresAt)
+}
+
+// purgeRevokedTokens keeps the revocation list down to tokens that have not
+// expired on their own yet.
+func purgeRevokedTokens() {
+	if err := sessionRepo.PurgeRevokedTokens(time.Now()); err != nil {
+		log.Printf("[Session] Failed to purge revoked tokens: %v", err)
+	}
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
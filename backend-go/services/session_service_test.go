@@ -0,0 +1,86 @@
+package services
+
+import (
+	"smartfarm-api/auth"
+	"smartfarm-api/config"
+	"smartfarm-api/models"
+	"smartfarm-api/repositories"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRefreshSession_RotatesAndDetectsReuse refreshes a session twice with
+// the same refresh token; once the grace for racing tabs is over the second
+// attempt must log the session out.
+func TestRefreshSession_RotatesAndDetectsReuse(t *testing.T) {
+	db := config.DB
+	if db == nil {
+		t.Skip("Database not available for testing")
+	}
+	sessionRepo = repositories.NewSessionRepository(db)
+
+	user := models.User{Name: "Test Session User", Email: "testsession" + time.Now().Format("150405.000") + "@race.com", Password: "hashed", Role: "pembeli"}
+	db.Create(&user)
+
+	first, err := StartSession(user, "test", "127.0.0.1")
+	assert.NoError(t, err)
+
+	second, err := RefreshSession(first.RefreshToken, "test", "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, first.SessionID, second.SessionID)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// The replaced access token is revoked with the refresh token it came with
+	revoked, _ := sessionRepo.IsTokenRevoked(accessJTI(t, first.AccessToken))
+	assert.True(t, revoked)
+
+	// Right away it is another tab racing for the same refresh, not reuse
+	_, err = RefreshSession(first.RefreshToken, "test", "127.0.0.1")
+	assert.EqualError(t, err, "refresh token already rotated")
+
+	refreshRaceGrace = 0
+	defer func() { refreshRaceGrace = 30 * time.Second }()
+
+	_, err = RefreshSession(first.RefreshToken, "test", "127.0.0.1")
+	assert.EqualError(t, err, "invalid refresh token")
+
+	// Reuse ended the session, so the current tokens stop working as well
+	_, err = RefreshSession(second.RefreshToken, "test", "127.0.0.1")
+	assert.EqualError(t, err, "invalid refresh token")
+	revoked, _ = sessionRepo.IsTokenRevoked(accessJTI(t, second.AccessToken))
+	assert.True(t, revoked)
+}
+
+func TestEndAllSessions_KeepsCurrent(t *testing.T) {
+	db := config.DB
+	if db == nil {
+		t.Skip("Database not available for testing")
+	}
+	sessionRepo = repositories.NewSessionRepository(db)
+
+	user := models.User{Name: "Test Session User", Email: "testsessions" + time.Now().Format("150405.000") + "@race.com", Password: "hashed", Role: "pembeli"}
+	db.Create(&user)
+
+	phone, _ := StartSession(user, "phone", "127.0.0.1")
+	laptop, _ := StartSession(user, "laptop", "127.0.0.1")
+
+	ended, err := EndAllSessions(user.ID, laptop.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ended)
+
+	sessions, err := GetSessions(user.ID, laptop.SessionID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.True(t, sessions[0].Current)
+
+	_, err = RefreshSession(phone.RefreshToken, "phone", "127.0.0.1")
+	assert.EqualError(t, err, "invalid refresh token")
+}
+
+func accessJTI(t *testing.T, token string) string {
+	claims, err := auth.ParseToken(token)
+	assert.NoError(t, err)
+	return claims.ID
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"log"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/repositories"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SubscriptionScheduler creates an order for every active subscription whose
+// next delivery is due, through the same stock-locking path as CreateOrder.
+// Once the schedule passes EndDate the subscription is marked expired.
+//
+// Like the order expiry sweeper it is safe to run on several replicas: each
+// subscription is re-read under a row lock before a delivery is created.
+type SubscriptionScheduler struct {
+	orders    *orderService
+	batchSize int
+	now       func() time.Time
+}
+
+func NewSubscriptionScheduler(orderRepo repositories.OrderRepository, productRepo repositories.ProductRepository, feeRepo repositories.FeeRepository, now func() time.Time) *SubscriptionScheduler {
+	if now == nil {
+		now = time.Now
+	}
+	return &SubscriptionScheduler{
+		orders:    &orderService{orderRepo: orderRepo, productRepo: productRepo, feeRepo: feeRepo},
+		batchSize: 100,
+		now:       now,
+	}
+}
+
+// StartSubscriptionScheduler runs the scheduler in the background every
+// SUBSCRIPTION_SCHEDULER_INTERVAL (default 1h).
+func StartSubscriptionScheduler() {
+	interval := durationFromEnv("SUBSCRIPTION_SCHEDULER_INTERVAL", time.Hour)
+
+	scheduler := NewSubscriptionScheduler(
+		repositories.NewOrderRepository(config.DB),
+		repositories.NewProductRepository(config.DB),
+		repositories.NewFeeRepository(config.DB),
+		nil,
+	)
+
+	log.Printf("[Subscription] Creating due deliveries every %v", interval)
+	go scheduler.Run(context.Background(), interval)
+}
+
+// Run processes due subscriptions once per interval until ctx is cancelled.
+func (s *SubscriptionScheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunDue(); err != nil {
+			log.Printf("[Subscription] Run failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue creates every delivery that is due now and returns how many orders
+// were created. A subscription that fell behind gets one order per run until
+// it has caught up.
+func (s *SubscriptionScheduler) RunDue() (int, error) {
+	now := s.now()
+
+	subs, err := s.orders.orderRepo.FindDueSubscriptions(now, s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, sub := range subs {
+		ok, err := s.deliver(sub.ID, now)
+		if err != nil {
+			log.Printf("[Subscription] Failed to process subscription %d: %v", sub.ID, err)
+			continue
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, nil
+}
+
+func (s *SubscriptionScheduler) deliver(subscriptionID uint, now time.Time) (bool, error) {
+	created := false
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		txOrderRepo := s.orders.orderRepo.WithTx(tx)
+
+		sub, err := txOrderRepo.FindSubscriptionByIDForUpdate(subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		due := subscriptionNextDelivery(sub)
+		// Another replica got here first, or the buyer changed the subscription
+		if sub.Status != "active" || due.After(now) {
+			return nil
+		}
+
+		if !due.Before(sub.EndDate) {
+			sub.Status = "expired"
+			log.Printf("[Subscription] Subscription %d expired", sub.ID)
+			return txOrderRepo.UpdateSubscription(&sub)
+		}
+
+		req := dto.CreateOrderRequest{
+			Items: []dto.OrderItemRequest{{ProductID: sub.ProductID, Quantity: sub.Quantity}},
+		}
+		if sub.AddressID != nil {
+			req.AddressID = *sub.AddressID
+		}
+
+		// A failed delivery (e.g. out of stock) rolls back only its savepoint; the
+		// schedule still moves on so the buyer is not charged twice later
+		var orderID uint
+		deliveryErr := tx.Transaction(func(orderTx *gorm.DB) error {
+			opts := orderOptions{SubscriptionID: &sub.ID}
+			// Subscriptions made before per-period pricing have no locked-in price
+			if sub.Price > 0 {
+				opts.UnitPrices = map[uint]float64{sub.ProductID: sub.Price}
+			}
+			order, err := s.orders.createOrderTx(orderTx, req, sub.UserID, opts)
+			orderID = order.ID
+			return err
+		})
+
+		if deliveryErr != nil {
+			log.Printf("[Subscription] Delivery for subscription %d due %s skipped: %v", sub.ID, due.Format("2006-01-02"), deliveryErr)
+			sub.LastDeliveryError = deliveryErr.Error()
+		} else {
+			log.Printf("[Subscription] Created order %d for subscription %d", orderID, sub.ID)
+			sub.LastDeliveryError = ""
+			created = true
+		}
+
+		next := nextDeliveryAfter(due, sub.Frequency)
+		sub.NextDeliveryAt = &next
+		if !next.Before(sub.EndDate) {
+			sub.Status = "expired"
+			log.Printf("[Subscription] Subscription %d expired after its last delivery", sub.ID)
+		}
+
+		return txOrderRepo.UpdateSubscription(&sub)
+	})
+
+	return created, err
+}
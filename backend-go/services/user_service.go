@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"smartfarm-api/config"
+	"smartfarm-api/dto"
+	"smartfarm-api/models"
+	"smartfarm-api/policies"
+	"smartfarm-api/repositories"
+	"strings"
+	"time"
+)
+
+var farmerStatuses = map[string]bool{"pending": true, "verified": true, "rejected": true}
+
+// CreateUserByAdmin lets an admin open an account of any role. Farmers made
+// this way are verified straight away.
+func CreateUserByAdmin(req dto.CreateUserRequest) (*models.User, error) {
+	switch req.Role {
+	case policies.RoleAdmin, policies.RoleFarmer, policies.RoleBuyer:
+	default:
+		return nil, errors.New("invalid role: use admin, petani or pembeli")
+	}
+	return createUser(req.Name, req.Email, req.Password, req.Role, "verified", "verified")
+}
+
+// CreateAdmin is the create-admin command's way in, for the first admin.
+func CreateAdmin(name string, email string, password string) (*models.User, error) {
+	if strings.TrimSpace(name) == "" || strings.TrimSpace(email) == "" || len(password) < 6 {
+		return nil, errors.New("invalid admin: name, email and a password of at least 6 characters are required")
+	}
+	return createUser(name, email, password, policies.RoleAdmin, "verified", "verified")
+}
+
+// GetFarmers lists farmers, only those with the verification status when it
+// is set.
+func GetFarmers(status string) ([]models.User, error) {
+	if status != "" && !farmerStatuses[status] {
+		return nil, errors.New("invalid status: use pending, verified or rejected")
+	}
+	return repositories.FindUsersByRole(policies.RoleFarmer, status)
+}
+
+// ApproveFarmer lets a farmer awaiting verification start selling.
+func ApproveFarmer(adminID uint, farmerID uint) (*models.User, error) {
+	return decideFarmer(adminID, farmerID, "verified", "", "farmer_verified", "Account verified",
+		"Your farmer account has been verified. You can now list products.")
+}
+
+// RejectFarmer turns a farmer's verification down with a reason.
+func RejectFarmer(adminID uint, farmerID uint, reason string) (*models.User, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("invalid rejection: a reason is required")
+	}
+	return decideFarmer(adminID, farmerID, "rejected", reason, "farmer_rejected", "Account not verified",
+		fmt.Sprintf("Your farmer account was not verified: %s", reason))
+}
+
+func decideFarmer(adminID uint, farmerID uint, status string, reason string, notificationType string, title string, message string) (*models.User, error) {
+	decided, err := repositories.SetFarmerVerification(farmerID, status, adminID, time.Now(), reason)
+	if err != nil {
+		return nil, err
+	}
+	if !decided {
+		if user, err := repositories.FindUserByID(farmerID); err != nil || user.Role != policies.RoleFarmer {
+			return nil, errors.New("farmer not found")
+		}
+		return nil, errors.New("farmer is not awaiting verification")
+	}
+
+	if err := repositories.NewNotificationRepository(config.DB).Create(&models.Notification{
+		UserID:  farmerID,
+		Type:    notificationType,
+		Title:   title,
+		Message: message,
+	}); err != nil {
+		log.Printf("[FarmerVerification] Failed to notify farmer %d: %v", farmerID, err)
+	}
+
+	log.Printf("[FarmerVerification] Farmer %d %s by admin %d", farmerID, status, adminID)
+	return repositories.FindUserByID(farmerID)
+}
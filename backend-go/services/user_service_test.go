@@ -0,0 +1,26 @@
+package services
+
+import (
+	"smartfarm-api/dto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterUser_RejectsSelfServiceAdmin(t *testing.T) {
+	for _, role := range []string{"admin", "Admin", "superuser", ""} {
+		_, err := RegisterUser(dto.RegisterRequest{Name: "Eve", Email: "eve@example.com", Password: "secret123", Role: role})
+		assert.EqualError(t, err, "invalid role: sign up as pembeli or petani", role)
+	}
+}
+
+func TestFarmerVerificationInput(t *testing.T) {
+	_, err := GetFarmers("approved")
+	assert.EqualError(t, err, "invalid status: use pending, verified or rejected")
+
+	_, err = RejectFarmer(1, 2, "   ")
+	assert.EqualError(t, err, "invalid rejection: a reason is required")
+
+	_, err = CreateUserByAdmin(dto.CreateUserRequest{Name: "Eve", Email: "eve@example.com", Password: "secret123", Role: "root"})
+	assert.EqualError(t, err, "invalid role: use admin, petani or pembeli")
+}
@@ -3,6 +3,7 @@ export interface User {
   name: string
   email: string
   role: string
+  email_status?: 'unverified' | 'verified'
   created_at: string
   updated_at: string
 }
@@ -6,5 +6,37 @@ const http = axios.create({
   timeout: 10000
 })
 
+// Access tokens are short-lived: on a 401, trade the refresh_token cookie for
+// a new one once and retry. Concurrent 401s share a single refresh, since a
+// refresh token only works once. Another tab may refresh with the same cookie
+// at the same moment: the loser gets a 409 and the winner's new cookies are
+// already in the browser, so the request is simply retried with those.
+let refreshing: Promise<unknown> | null = null
+
+const refresh = () =>
+  http.post("/auth/refresh").catch((error) => {
+    if (error.response?.status !== 409) {
+      throw error
+    }
+  })
+
+http.interceptors.response.use(undefined, async (error) => {
+  const original = error.config
+  const url: string = original?.url ?? ""
+  if (error.response?.status !== 401 || !original || original._retried || url.startsWith("/auth/")) {
+    return Promise.reject(error)
+  }
+
+  original._retried = true
+  refreshing ??= refresh().finally(() => {
+    refreshing = null
+  })
+  try {
+    await refreshing
+  } catch {
+    return Promise.reject(error)
+  }
+  return http(original)
+})
+
 export default http
-  
\ No newline at end of file
@@ -237,6 +237,30 @@ const router = createRouter({
         title: 'Signup',
       },
     },
+    {
+      path: '/verify-email',
+      name: 'VerifyEmail',
+      component: () => import('../views/Auth/VerifyEmail.vue'),
+      meta: {
+        title: 'Verify Email',
+      },
+    },
+    {
+      path: '/confirm-email',
+      name: 'ConfirmEmail',
+      component: () => import('../views/Auth/VerifyEmail.vue'),
+      meta: {
+        title: 'Confirm Email',
+      },
+    },
+    {
+      path: '/reset-password',
+      name: 'ResetPassword',
+      component: () => import('../views/Auth/ResetPassword.vue'),
+      meta: {
+        title: 'Reset Password',
+      },
+    },
   ],
 })
 
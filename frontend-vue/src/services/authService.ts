@@ -7,7 +7,11 @@ export function login(payload: LoginRequest) {
 }
 
 export function logout() {
-  return http.post("/logout")
+  return http.post("/auth/logout")
+}
+
+export function logoutAll() {
+  return http.post("/auth/logout-all")
 }
 
 export interface RegisterRequest {
@@ -31,5 +35,34 @@ export interface UpdateProfileRequest {
 }
 
 export function updateProfile(payload: UpdateProfileRequest) {
-  return http.put("/me", payload)
+  return http.put<{ message: string; pending_email?: string }>("/me", payload)
+}
+
+export interface ChangePasswordRequest {
+  current_password: string
+  new_password: string
+}
+
+export function changePassword(payload: ChangePasswordRequest) {
+  return http.put("/me/password", payload)
+}
+
+export function confirmEmailChange(token: string) {
+  return http.post("/auth/confirm-email", { token })
+}
+
+export function verifyEmail(token: string) {
+  return http.post("/auth/verify", { token })
+}
+
+export function resendVerification() {
+  return http.post("/auth/verify/resend")
+}
+
+export function forgotPassword(email: string) {
+  return http.post("/auth/forgot-password", { email })
+}
+
+export function resetPassword(token: string, password: string) {
+  return http.post("/auth/reset-password", { token, password })
 }
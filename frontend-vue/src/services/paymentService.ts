@@ -56,6 +56,13 @@ class PaymentService {
       return
     }
 
+    // Local fake gateway: the backend settles the payment through its own webhook
+    if (snapToken.startsWith('fake-token')) {
+      console.log('🛠️ Fake payment gateway. Waiting for the backend to settle the payment...')
+      if (options?.onSuccess) options.onSuccess()
+      return
+    }
+
     return new Promise((resolve) => {
       if (!window.snap) {
         console.error('Snap not loaded')